@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"strings"
+)
+
+// runCommand runs a maintenance command instead of starting the server
+func runCommand(environment string, args []string) error {
+	initLogging(environment)
+	if err := config.Init(environment); err != nil {
+		return fmt.Errorf("config initialization error: %w", err)
+	}
+
+	switch strings.Join(args, " ") {
+	case "tokens rotate-key":
+		return rotateTokenKey()
+	default:
+		return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+	}
+}
+
+// rotateTokenKey re-encrypts every stored Plex token with the current
+// encryption key, so previous keys can be removed from the configuration
+func rotateTokenKey() error {
+	if config.C.Tokens.EncryptionKey == "" {
+		return fmt.Errorf("tokens.encryption_key must be set to the new key")
+	}
+	if err := initDB(); err != nil {
+		return err
+	}
+	rotated, err := db.DB.RotatePlexTokenKey(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to rotate token encryption key: %w", err)
+	}
+	slog.Info("Plex tokens re-encrypted with the current key", "tokens", rotated)
+	return nil
+}
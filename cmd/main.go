@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -12,8 +13,12 @@ import (
 	"os/signal"
 	"plefi/internal/config"
 	"plefi/internal/db"
+	"plefi/internal/jobs"
+	"plefi/internal/secrets"
 	"plefi/internal/server"
 	"plefi/internal/services"
+	"plefi/internal/services/plex"
+	"plefi/internal/services/plex/fake"
 	"syscall"
 	"time"
 
@@ -23,40 +28,63 @@ import (
 func main() {
 	// Parse command line flags
 	environment := flag.String("e", "development", "Environment to run the application (development, production)")
+	fakePlex := flag.String("fake-plex", "", "Start a fake Plex server on the given address (e.g. 127.0.0.1:32401) and use it for all Plex API calls")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s [-e environment]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s [-e environment] [-fake-plex address]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s [-e environment] tokens rotate-key\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  tokens rotate-key\tRe-encrypt all stored Plex tokens with tokens.encryption_key\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	if flag.NArg() > 0 {
+		if err := runCommand(*environment, flag.Args()); err != nil {
+			slog.Error("Command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize and run application components
-	if err := runApp(*environment); err != nil {
+	if err := runApp(*environment, *fakePlex); err != nil {
 		slog.Error("Failed to run application", "error", err)
 		os.Exit(1)
 	}
 }
 
-// initApp initializes all application components
-func initApp(environment string) (*server.Server, error) {
+// initLogging sets up the default logger for the environment
+func initLogging(environment string) {
 	if environment == "development" {
 		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, nil)))
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 	} else {
 		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 	}
+}
+
+// initApp initializes all application components
+func initApp(environment, fakePlexAddr string) (*server.Server, *jobs.Scheduler, error) {
+	initLogging(environment)
 	slog.Info("Starting application in environment", "environment", environment)
 	// Initialize configuration
 	if err := config.Init(environment); err != nil {
-		return nil, fmt.Errorf("config initialization error: %w", err)
+		return nil, nil, fmt.Errorf("config initialization error: %w", err)
+	}
+
+	if fakePlexAddr != "" {
+		if err := startFakePlex(fakePlexAddr); err != nil {
+			return nil, nil, fmt.Errorf("fake Plex server error: %w", err)
+		}
 	}
 
 	// Create HTTP client with reasonable timeout
 	httpClient := &http.Client{
 		Timeout: 10 * time.Second,
 	}
-	if config.C.Proxy.Enabled {
+	if config.C.Proxy.Enabled && fakePlexAddr == "" {
 		slog.Info("Proxy enabled, setting up HTTP client with proxy")
 		proxyURL, _ := url.Parse(config.C.Proxy.Url)
 		httpClient.Transport = &http.Transport{
@@ -71,60 +99,163 @@ func initApp(environment string) (*server.Server, error) {
 	if config.C.Plex.AdminUserID == 0 {
 		plexUser, err := svcs.Plex.GetUserDetails(context.Background(), config.C.Plex.Token.Value())
 		if err != nil {
-			return nil, fmt.Errorf("failed to get Plex admin user details: %w", err)
+			return nil, nil, fmt.Errorf("failed to get Plex admin user details: %w", err)
 		}
 		config.C.Plex.AdminUserID = plexUser.ID
 		slog.Info("Plex admin user ID set in config",
 			"plex_admin_user_id", config.C.Plex.AdminUserID,
 			"plex_username", plexUser.Username)
 	}
-	if config.C.Plex.MachineIdentifier == "" {
-		machineID, err := svcs.Plex.GetMachineIdentity(context.Background(), config.C.Plex.Url, config.C.Plex.Token.Value())
+	for i := range config.C.Plex.Servers {
+		server := &config.C.Plex.Servers[i]
+		if server.MachineIdentifier != "" {
+			continue
+		}
+		machineID, err := svcs.Plex.GetMachineIdentity(context.Background(), server.Url, server.Token.Value())
 		if err != nil {
-			return nil, fmt.Errorf("failed to get Plex machine identifier: %w", err)
+			return nil, nil, fmt.Errorf("failed to get machine identifier of Plex server %s: %w", server.Name, err)
 		}
-		config.C.Plex.MachineIdentifier = machineID
+		server.MachineIdentifier = machineID
 		slog.Info("Plex machine identifier set in config",
-			"plex_machine_identifier", config.C.Plex.MachineIdentifier)
+			"plex_server", server.Name,
+			"plex_machine_identifier", server.MachineIdentifier)
+	}
+
+	sectionIDs, err := svcs.Plex.ResolveSharedLibraries(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve shared libraries: %w", err)
+	}
+	for _, server := range config.C.Plex.Servers {
+		slog.Info("Resolved shared Plex libraries",
+			"plex_server", server.Name,
+			"libraries", server.SharedLibraries,
+			"section_ids", sectionIDs[server.MachineIdentifier])
+	}
+	if err := checkPlanLibraries(svcs.Plex); err != nil {
+		return nil, nil, err
 	}
 
 	// Set Stripe API key
 	stripe.Key = config.C.Stripe.SecretKey.Value()
 	if stripe.Key == "" {
-		return nil, fmt.Errorf("stripe API key not configured")
+		return nil, nil, fmt.Errorf("stripe API key not configured")
 	}
 	stripe.SetHTTPClient(httpClient)
 
+	if err := initDB(); err != nil {
+		return nil, nil, err
+	}
+
+	// Register background jobs
+	scheduler := jobs.NewScheduler()
+	scheduler.Register(jobs.PlexShareSyncJob, config.C.Plex.ShareSyncInterval, jobs.SyncPlexShares(svcs.Plex))
+	scheduler.Register(jobs.PlexTokenValidationJob, config.C.Plex.TokenValidationInterval, jobs.ValidatePlexTokens(svcs.Plex))
+	scheduler.Register(jobs.PlexSessionPollJob, config.C.Plex.SessionPollInterval, jobs.PollPlexSessions(svcs.Plex))
+	if config.C.HasStreamLimits() {
+		scheduler.Register(jobs.StreamLimitJob, config.C.Plex.StreamCheckInterval, jobs.EnforceStreamLimits(svcs.Plex))
+	}
+	scheduler.Register(jobs.InviteAccessExpiryJob, config.C.InviteCodes.ExpiryCheckInterval, jobs.ExpireInviteAccess(svcs.Plex, svcs.Stripe))
+	if config.C.Inactivity.Enabled() {
+		scheduler.Register(jobs.InactivityJob, config.C.Inactivity.CheckInterval, jobs.EnforceInactivity(svcs.Plex, svcs.Stripe))
+	}
+
+	// Initialize server components
+	srv, err := server.Init(svcs, httpClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server initialization error: %w", err)
+	}
+
+	return srv, scheduler, nil
+}
+
+// checkPlanLibraries verifies that the libraries of every plan exist on the
+// plan's servers. Unknown libraries are an error unless plex.strict_libraries
+// is disabled, in which case they are logged.
+func checkPlanLibraries(plexService plex.PlexServicer) error {
+	for _, plan := range config.C.Plans {
+		if len(plan.Libraries) == 0 {
+			continue
+		}
+		for _, server := range config.C.ServersForPlan(plan) {
+			_, err := plexService.GetSectionIDsByNames(context.Background(), server.MachineIdentifier, plan.Libraries)
+			var unknownErr *plex.UnknownLibrariesError
+			if errors.As(err, &unknownErr) && !config.C.Plex.StrictLibraries {
+				slog.Warn("Plan shares unknown libraries",
+					"plan", plan.Name,
+					"server", server.Name,
+					"unknown", unknownErr.Unknown,
+					"available", unknownErr.Available)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to resolve libraries of plan %s on server %s: %w", plan.Name, server.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// initDB opens and migrates the database, encrypting stored Plex tokens with
+// the configured keys
+func initDB() error {
+	keyring, err := secrets.NewKeyring(config.C.Tokens.EncryptionKey.Value(), config.C.Tokens.PreviousKeyValues())
+	if err != nil {
+		return fmt.Errorf("invalid token encryption keys: %w", err)
+	}
+	if !keyring.Enabled() {
+		slog.Warn("No token encryption key configured, Plex tokens will be stored in plaintext")
+	}
+
 	slog.Info("Initializing database connection",
 		"driver", config.C.Database.Driver,
 		"dsn", config.C.Database.Dsn)
 	// Initialize database connection
-	if err := db.Init(config.C.Database.Driver, config.C.Database.Dsn.Value()); err != nil {
+	if err := db.Init(config.C.Database.Driver, config.C.Database.Dsn.Value(), keyring); err != nil {
 		slog.Error("db failed to open", "error", err)
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return fmt.Errorf("failed to open database: %w", err)
 	}
 	if err := db.DB.Migrate(context.Background()); err != nil {
 		slog.Error("db failed to migrate", "error", err)
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	return nil
+}
 
-	// Initialize server components
-	srv, err := server.Init(svcs, httpClient)
+// startFakePlex starts the bundled fake Plex server and points all Plex
+// configuration at it, so the application can run without plex.tv.
+func startFakePlex(addr string) error {
+	fakeServer := fake.NewServer()
+	baseURL, err := fakeServer.Start(addr)
 	if err != nil {
-		return nil, fmt.Errorf("server initialization error: %w", err)
+		return err
 	}
-
-	return srv, nil
+	config.C.Plex.ApiUrl = baseURL
+	config.C.Plex.ClientsUrl = baseURL
+	config.C.Plex.AppUrl = baseURL
+	config.C.Plex.Token = config.Secret(fake.OwnerToken)
+	config.C.Plex.Servers = []config.PlexServerConfig{{
+		Name:              fake.DefaultServerName,
+		Url:               baseURL,
+		Token:             config.Secret(fake.OwnerToken),
+		MachineIdentifier: fakeServer.MachineIdentifier(),
+		SharedLibraries:   []string{"Movies", "TV Shows"},
+	}}
+	config.C.Plex.AdminUserID = fakeServer.Owner().ID
+	slog.Warn("Using fake Plex server, no requests will be sent to plex.tv", "url", baseURL)
+	return nil
 }
 
 // runApp initializes the application and starts the server with graceful shutdown
-func runApp(environment string) error {
+func runApp(environment, fakePlexAddr string) error {
 	// Initialize application
-	srv, err := initApp(environment)
+	srv, scheduler, err := initApp(environment, fakePlexAddr)
 	if err != nil {
 		return err
 	}
 
+	// Start background jobs
+	scheduler.Start(context.Background())
+
 	// Start server in a goroutine
 	go func() {
 		if err := srv.Start(); err != nil {
@@ -138,6 +269,7 @@ func runApp(environment string) error {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	slog.Info("Shutting down server...")
+	scheduler.Stop()
 
 	// Create context with timeout for shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
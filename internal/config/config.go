@@ -8,6 +8,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
+
+	"plefi/internal/models"
 
 	"github.com/spf13/viper"
 )
@@ -38,10 +41,138 @@ type AppConfig struct {
 	Plex             PlexConfig
 	Proxy            ProxyConfig
 	Database         DatabaseConfig
+	Plans            []PlanConfig
+	SharingProfiles  []SharingProfileConfig
+	Inactivity       InactivityConfig
+	InviteCodes      InviteCodesConfig
+	Referrals        ReferralsConfig
+	Tokens           TokensConfig
 	Debug            bool
 	OnboardingConfig OnboardingConfig
 }
 
+// PlexServerConfig describes a single Plex Media Server and the libraries it shares
+type PlexServerConfig struct {
+	Name              string   `mapstructure:"name" json:"name"`
+	Url               string   `mapstructure:"url" json:"url"`
+	Token             Secret   `mapstructure:"token" json:"token"`
+	MachineIdentifier string   `mapstructure:"machine_identifier" json:"machine_identifier"`
+	SharedLibraries   []string `mapstructure:"shared_libraries" json:"shared_libraries"`
+}
+
+// Server returns the configured server with the given machine identifier
+func (c PlexConfig) Server(machineIdentifier string) (PlexServerConfig, bool) {
+	for _, server := range c.Servers {
+		if server.MachineIdentifier == machineIdentifier {
+			return server, true
+		}
+	}
+	return PlexServerConfig{}, false
+}
+
+// ServerByName returns the configured server with the given name
+func (c PlexConfig) ServerByName(name string) (PlexServerConfig, bool) {
+	for _, server := range c.Servers {
+		if strings.EqualFold(server.Name, name) {
+			return server, true
+		}
+	}
+	return PlexServerConfig{}, false
+}
+
+// PlanConfig maps a Stripe entitlement to the sharing settings its subscribers receive
+type PlanConfig struct {
+	Name            string                 `mapstructure:"name"`
+	EntitlementName string                 `mapstructure:"entitlement_name"`
+	Sharing         models.SharingSettings `mapstructure:"sharing"`
+	// Servers lists the names of the servers shared by the plan, all servers when empty
+	Servers []string `mapstructure:"servers"`
+	// Libraries lists the names of the libraries shared on each of the plan's
+	// servers, the server's shared_libraries when empty
+	Libraries []string `mapstructure:"libraries"`
+	// MaxStreams is the number of concurrent streams allowed, unlimited when zero
+	MaxStreams int `mapstructure:"max_streams"`
+	// SharingProfile is the name of the sharing profile restricting the plan's content
+	SharingProfile string `mapstructure:"sharing_profile"`
+}
+
+// SharingProfileConfig is a named set of content restrictions, such as a
+// "kids" profile, applied to the movie and TV libraries of a share
+type SharingProfileConfig struct {
+	Name string `mapstructure:"name"`
+	// ContentRatings are the only content ratings shown, all ratings when empty
+	ContentRatings []string `mapstructure:"content_ratings"`
+	// Labels are the labels an item needs to be shown, any item when empty
+	Labels []string `mapstructure:"labels"`
+	// ExcludeLabels are the labels that hide an item
+	ExcludeLabels []string `mapstructure:"exclude_labels"`
+}
+
+// Apply returns the settings with their movie and TV filters replaced by the profile's restrictions
+func (p SharingProfileConfig) Apply(settings models.SharingSettings) models.SharingSettings {
+	filter := models.LibraryFilter{
+		Labels:         p.Labels,
+		ExcludeLabels:  p.ExcludeLabels,
+		ContentRatings: p.ContentRatings,
+	}
+	settings.FilterMovies = filter
+	settings.FilterTelevision = filter
+	return settings
+}
+
+// SharingProfile returns the sharing profile with the given name
+func (c AppConfig) SharingProfile(name string) (SharingProfileConfig, bool) {
+	for _, profile := range c.SharingProfiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, true
+		}
+	}
+	return SharingProfileConfig{}, false
+}
+
+// ServersForPlan returns the servers a plan shares
+func (c AppConfig) ServersForPlan(plan PlanConfig) []PlexServerConfig {
+	if len(plan.Servers) == 0 {
+		return c.Plex.Servers
+	}
+	var servers []PlexServerConfig
+	for _, name := range plan.Servers {
+		if server, ok := c.Plex.ServerByName(name); ok {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// PlanForEntitlement returns the plan granted by a Stripe entitlement lookup key
+func (c AppConfig) PlanForEntitlement(entitlementName string) (PlanConfig, bool) {
+	for _, plan := range c.Plans {
+		if plan.EntitlementName == entitlementName {
+			return plan, true
+		}
+	}
+	return PlanConfig{}, false
+}
+
+// PlanForUser returns the plan of a user given the entitlement they were
+// granted access through, falling back to the plan of stripe.entitlement_name
+func (c AppConfig) PlanForUser(entitlementName string) (PlanConfig, bool) {
+	if entitlementName == "" {
+		entitlementName = c.Stripe.EntitlementName
+	}
+	return c.PlanForEntitlement(entitlementName)
+}
+
+// HasStreamLimits reports whether any plan limits concurrent streams
+func (c AppConfig) HasStreamLimits() bool {
+	for _, plan := range c.Plans {
+		if plan.MaxStreams > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 type AuthConfig struct {
 	SessionSecret Secret
 	SessionName   string
@@ -65,13 +196,113 @@ type StripeConfig struct {
 }
 
 type PlexConfig struct {
-	ClientID          string
-	AdminUserID       int
-	ProductName       string
-	SharedLibraries   []string
-	Token             Secret
-	Url               string
-	MachineIdentifier string
+	ClientID        string
+	AdminUserID     int
+	ProductName     string
+	StrictLibraries bool
+	Token           Secret
+	ApiUrl          string
+	ClientsUrl      string
+	AppUrl          string
+
+	// Retry and circuit breaker settings for Plex API requests
+	MaxRetries              int
+	RetryBaseDelay          time.Duration
+	RetryMaxDelay           time.Duration
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+
+	// Servers are the Plex Media Servers managed by this instance. The first
+	// server is the primary one.
+	Servers []PlexServerConfig
+
+	// UsersCacheTTL is how long the fetched users list is reused before calling Plex again
+	UsersCacheTTL time.Duration
+	// ShareSyncInterval is how often the users list is synced to the plex_shares table
+	ShareSyncInterval time.Duration
+	// TokenValidationInterval is how often stored user tokens are validated against plex.tv
+	TokenValidationInterval time.Duration
+	// SessionPollInterval is how often active sessions are recorded in the session history
+	SessionPollInterval time.Duration
+	// StreamCheckInterval is how often plans' concurrent stream limits are enforced
+	StreamCheckInterval time.Duration
+	// StreamLimitMessage is shown to users whose stream is terminated for exceeding their limit
+	StreamLimitMessage string
+}
+
+// InactivityConfig is the policy for removing access from users that don't
+// use it. A policy with neither warn_days nor revoke_days set is disabled.
+type InactivityConfig struct {
+	// WarnDays is how many days without activity before a user is warned
+	WarnDays int
+	// RevokeDays is how many days without activity before a user's access is revoked
+	RevokeDays int
+	// CheckInterval is how often the policy is enforced
+	CheckInterval time.Duration
+}
+
+// Enabled reports whether the policy warns or revokes anyone
+func (c InactivityConfig) Enabled() bool {
+	return c.WarnDays > 0 || c.RevokeDays > 0
+}
+
+// TokensConfig holds the keys that encrypt stored Plex user tokens. Keys are
+// formatted as "<id>:<base64 encoded 32 byte key>". Without an encryption key,
+// tokens are stored in plaintext.
+type TokensConfig struct {
+	// EncryptionKey encrypts newly stored tokens
+	EncryptionKey Secret
+	// PreviousKeys decrypt tokens stored before the encryption key was rotated
+	PreviousKeys []Secret
+}
+
+// PreviousKeyValues returns the values of the previous keys
+func (c TokensConfig) PreviousKeyValues() []string {
+	values := make([]string, len(c.PreviousKeys))
+	for i, key := range c.PreviousKeys {
+		values[i] = key.Value()
+	}
+	return values
+}
+
+// InviteCodesConfig holds the settings of invite codes
+type InviteCodesConfig struct {
+	// ExpiryCheckInterval is how often access granted by invite codes is revoked once it ends
+	ExpiryCheckInterval time.Duration
+	// MaxFailedAttempts is how many failed claims a user can make within
+	// AttemptWindow before being locked out, unlimited when zero
+	MaxFailedAttempts int
+	// MaxFailedAttemptsPerIP is how many failed claims can come from an IP
+	// address within AttemptWindow before it is locked out, unlimited when zero
+	MaxFailedAttemptsPerIP int
+	// AttemptWindow is the period over which failed claims are counted
+	AttemptWindow time.Duration
+	// LockoutDuration is how long a locked out user or IP address can't claim codes
+	LockoutDuration time.Duration
+}
+
+// Rewards a member can earn for referring a paying user
+const (
+	ReferralRewardCredit = "credit" // Credit applied to the referrer's Stripe customer balance
+	ReferralRewardCoupon = "coupon" // Coupon applied to the referrer's active subscription
+)
+
+// ReferralsConfig holds the reward members earn when a user they referred
+// pays their first invoice. Referrals aren't rewarded without a reward type.
+type ReferralsConfig struct {
+	// RewardType is ReferralRewardCredit or ReferralRewardCoupon
+	RewardType string
+	// CreditAmount is the credit in the smallest unit of Currency, such as cents
+	CreditAmount int64
+	// Currency is the three-letter ISO code of the credit
+	Currency string
+	// CouponID is the Stripe coupon applied to the referrer's subscription
+	CouponID string
+}
+
+// Enabled reports whether referrals are rewarded
+func (c ReferralsConfig) Enabled() bool {
+	return c.RewardType != ""
 }
 
 type ProxyConfig struct {
@@ -127,8 +358,7 @@ func Init(env string) error {
 	config.SetEnvKeyReplacer(strings.NewReplacer(".", "__"))
 	config.AutomaticEnv()
 	setDefaults(config)
-	generateConfig(config)
-	return nil
+	return generateConfig(config)
 }
 
 func setDefaults(config *viper.Viper) {
@@ -139,11 +369,33 @@ func setDefaults(config *viper.Viper) {
 	config.SetDefault("stripe.payment_method_types", []string{"card"})
 	config.SetDefault("auth.session_secret", "changeme")
 	config.SetDefault("auth.session_name", "plefi_session")
+	config.SetDefault("plex.strict_libraries", true)
+	config.SetDefault("plex.api_url", "https://plex.tv")
+	config.SetDefault("plex.clients_url", "https://clients.plex.tv")
+	config.SetDefault("plex.app_url", "https://app.plex.tv")
+	config.SetDefault("plex.max_retries", 3)
+	config.SetDefault("plex.retry_base_delay", "500ms")
+	config.SetDefault("plex.retry_max_delay", "30s")
+	config.SetDefault("plex.circuit_breaker_threshold", 5)
+	config.SetDefault("plex.circuit_breaker_cooldown", "1m")
+	config.SetDefault("plex.users_cache_ttl", "5m")
+	config.SetDefault("plex.share_sync_interval", "15m")
+	config.SetDefault("plex.token_validation_interval", "24h")
+	config.SetDefault("plex.session_poll_interval", "1m")
+	config.SetDefault("plex.stream_check_interval", "1m")
+	config.SetDefault("plex.stream_limit_message", "You have reached the maximum number of simultaneous streams for your plan.")
+	config.SetDefault("inactivity.check_interval", "24h")
+	config.SetDefault("invite_codes.expiry_check_interval", "1h")
+	config.SetDefault("invite_codes.max_failed_attempts", 5)
+	config.SetDefault("invite_codes.max_failed_attempts_per_ip", 20)
+	config.SetDefault("invite_codes.attempt_window", "15m")
+	config.SetDefault("invite_codes.lockout_duration", "1h")
+	config.SetDefault("referrals.currency", "usd")
 	config.SetDefault("debug", false)
 	config.SetDefault("database.migrations_path", filepath.Join(filepath.Dir(b), "../../migrations"))
 }
 
-func generateConfig(config *viper.Viper) {
+func generateConfig(config *viper.Viper) error {
 	_, ipNet, err := net.ParseCIDR(config.GetString("server.trusted_proxies"))
 	if err != nil {
 		slog.Warn("error on parsing trusted proxies", "error", err)
@@ -170,13 +422,41 @@ func generateConfig(config *viper.Viper) {
 			DonationPriceID:     config.GetString("stripe.donation_price_id"),
 		},
 		Plex: PlexConfig{
-			ClientID:          config.GetString("plex.client_id"),
-			AdminUserID:       config.GetInt("plex.admin_user_id"),
-			ProductName:       config.GetString("plex.product_name"),
-			SharedLibraries:   strings.Split(config.GetString("plex.shared_libraries"), ","),
-			Token:             Secret(config.GetString("plex.token")),
-			Url:               config.GetString("plex.url"),
-			MachineIdentifier: config.GetString("plex.machine_identifier"),
+			ClientID:        config.GetString("plex.client_id"),
+			AdminUserID:     config.GetInt("plex.admin_user_id"),
+			ProductName:     config.GetString("plex.product_name"),
+			StrictLibraries: config.GetBool("plex.strict_libraries"),
+			Token:           Secret(config.GetString("plex.token")),
+			ApiUrl:          strings.TrimSuffix(config.GetString("plex.api_url"), "/"),
+			ClientsUrl:      strings.TrimSuffix(config.GetString("plex.clients_url"), "/"),
+			AppUrl:          strings.TrimSuffix(config.GetString("plex.app_url"), "/"),
+
+			MaxRetries:              config.GetInt("plex.max_retries"),
+			RetryBaseDelay:          config.GetDuration("plex.retry_base_delay"),
+			RetryMaxDelay:           config.GetDuration("plex.retry_max_delay"),
+			CircuitBreakerThreshold: config.GetInt("plex.circuit_breaker_threshold"),
+			CircuitBreakerCooldown:  config.GetDuration("plex.circuit_breaker_cooldown"),
+			UsersCacheTTL:           config.GetDuration("plex.users_cache_ttl"),
+			ShareSyncInterval:       config.GetDuration("plex.share_sync_interval"),
+			TokenValidationInterval: config.GetDuration("plex.token_validation_interval"),
+			SessionPollInterval:     config.GetDuration("plex.session_poll_interval"),
+			StreamCheckInterval:     config.GetDuration("plex.stream_check_interval"),
+			StreamLimitMessage:      config.GetString("plex.stream_limit_message"),
+		},
+		Inactivity: InactivityConfig{
+			WarnDays:      config.GetInt("inactivity.warn_days"),
+			RevokeDays:    config.GetInt("inactivity.revoke_days"),
+			CheckInterval: config.GetDuration("inactivity.check_interval"),
+		},
+		InviteCodes: InviteCodesConfig{
+			ExpiryCheckInterval:    config.GetDuration("invite_codes.expiry_check_interval"),
+			MaxFailedAttempts:      config.GetInt("invite_codes.max_failed_attempts"),
+			MaxFailedAttemptsPerIP: config.GetInt("invite_codes.max_failed_attempts_per_ip"),
+			AttemptWindow:          config.GetDuration("invite_codes.attempt_window"),
+			LockoutDuration:        config.GetDuration("invite_codes.lockout_duration"),
+		},
+		Tokens: TokensConfig{
+			EncryptionKey: Secret(config.GetString("tokens.encryption_key")),
 		},
 		Proxy: ProxyConfig{
 			Enabled: config.GetBool("proxy.enabled"),
@@ -194,9 +474,134 @@ func generateConfig(config *viper.Viper) {
 			Features:         config.GetStringSlice("onboarding.features"),
 		},
 	}
+	C.Plex.Servers = loadServers(config)
+	C.Plans = loadPlans(config)
+	if err := checkPlanServers(C.Plans, C.Plex); err != nil {
+		return err
+	}
+	C.SharingProfiles = loadSharingProfiles(config)
+	for _, plan := range C.Plans {
+		if _, ok := C.SharingProfile(plan.SharingProfile); plan.SharingProfile != "" && !ok {
+			slog.Warn("plan uses an unknown sharing profile", "plan", plan.Name, "sharing_profile", plan.SharingProfile)
+		}
+	}
+	C.Referrals = loadReferrals(config)
+	for _, key := range splitList(config.GetString("tokens.previous_keys")) {
+		C.Tokens.PreviousKeys = append(C.Tokens.PreviousKeys, Secret(key))
+	}
 	if C.Debug {
 		printJSON(C)
 	}
+	return nil
+}
+
+// loadServers reads the configured Plex servers. Without plex.servers, a single
+// server is built from plex.url, plex.machine_identifier and plex.shared_libraries.
+// Servers without their own token or libraries inherit plex.token and
+// plex.shared_libraries.
+func loadServers(config *viper.Viper) []PlexServerConfig {
+	var servers []PlexServerConfig
+	if err := config.UnmarshalKey("plex.servers", &servers); err != nil {
+		slog.Warn("error on parsing plex servers", "error", err)
+	}
+	if len(servers) == 0 {
+		servers = []PlexServerConfig{{
+			Name:              "default",
+			Url:               config.GetString("plex.url"),
+			MachineIdentifier: config.GetString("plex.machine_identifier"),
+		}}
+	}
+	for i := range servers {
+		server := &servers[i]
+		server.Url = strings.TrimSuffix(server.Url, "/")
+		if server.Name == "" {
+			server.Name = fmt.Sprintf("server-%d", i+1)
+		}
+		if server.Token == "" {
+			server.Token = Secret(config.GetString("plex.token"))
+		}
+		if len(server.SharedLibraries) == 0 {
+			server.SharedLibraries = splitList(config.GetString("plex.shared_libraries"))
+		}
+	}
+	return servers
+}
+
+// loadPlans reads the configured plans, falling back to a single default plan
+// for stripe.entitlement_name with the most restrictive sharing settings.
+func loadPlans(config *viper.Viper) []PlanConfig {
+	var plans []PlanConfig
+	if err := config.UnmarshalKey("plans", &plans); err != nil {
+		slog.Warn("error on parsing plans", "error", err)
+	}
+	if len(plans) == 0 {
+		plans = []PlanConfig{{
+			Name:            "default",
+			EntitlementName: config.GetString("stripe.entitlement_name"),
+		}}
+	}
+	return plans
+}
+
+// checkPlanServers verifies that the servers of every plan are configured, so
+// a misspelled server name doesn't silently share fewer servers
+func checkPlanServers(plans []PlanConfig, plex PlexConfig) error {
+	for _, plan := range plans {
+		for _, name := range plan.Servers {
+			if _, ok := plex.ServerByName(name); !ok {
+				return fmt.Errorf("plan %s shares unknown server %q", plan.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// loadReferrals reads the referral reward, disabling referrals when the
+// reward is unknown or incomplete
+func loadReferrals(config *viper.Viper) ReferralsConfig {
+	referrals := ReferralsConfig{
+		RewardType:   strings.ToLower(config.GetString("referrals.reward_type")),
+		CreditAmount: config.GetInt64("referrals.credit_amount"),
+		Currency:     strings.ToLower(config.GetString("referrals.currency")),
+		CouponID:     config.GetString("referrals.coupon_id"),
+	}
+	switch referrals.RewardType {
+	case "":
+	case ReferralRewardCredit:
+		if referrals.CreditAmount <= 0 {
+			slog.Warn("referral credit amount must be positive, referrals won't be rewarded")
+			referrals.RewardType = ""
+		}
+	case ReferralRewardCoupon:
+		if referrals.CouponID == "" {
+			slog.Warn("no referral coupon configured, referrals won't be rewarded")
+			referrals.RewardType = ""
+		}
+	default:
+		slog.Warn("unknown referral reward type, referrals won't be rewarded", "reward_type", referrals.RewardType)
+		referrals.RewardType = ""
+	}
+	return referrals
+}
+
+// loadSharingProfiles reads the configured sharing profiles
+func loadSharingProfiles(config *viper.Viper) []SharingProfileConfig {
+	var profiles []SharingProfileConfig
+	if err := config.UnmarshalKey("sharing_profiles", &profiles); err != nil {
+		slog.Warn("error on parsing sharing profiles", "error", err)
+	}
+	return profiles
+}
+
+// splitList splits a comma separated list, trimming whitespace and dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func printJSON(obj interface{}) {
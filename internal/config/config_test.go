@@ -8,6 +8,8 @@ import (
 	"strings" // new import
 	"testing"
 
+	"plefi/internal/models"
+
 	"github.com/spf13/viper"
 )
 
@@ -59,6 +61,12 @@ func TestSetDefaults(t *testing.T) {
 	if mt := v.GetStringSlice("stripe.payment_method_types"); len(mt) != 1 || mt[0] != "card" {
 		t.Errorf("default stripe.payment_method_types = %v, want [card]", mt)
 	}
+	if got := v.GetString("plex.api_url"); got != "https://plex.tv" {
+		t.Errorf("default plex.api_url = %q, want %q", got, "https://plex.tv")
+	}
+	if got := v.GetString("plex.clients_url"); got != "https://clients.plex.tv" {
+		t.Errorf("default plex.clients_url = %q, want %q", got, "https://clients.plex.tv")
+	}
 }
 
 func TestGenerateConfig(t *testing.T) {
@@ -92,7 +100,9 @@ func TestGenerateConfig(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	generateConfig(v)
+	if err := generateConfig(v); err != nil {
+		t.Fatalf("generateConfig() error = %v", err)
+	}
 
 	w.Close()
 	os.Stdout = oldOut
@@ -198,3 +208,144 @@ plex:
 		t.Errorf("Init TrustedProxies = %v, want 192.168.1.0/24", C.Server.TrustedProxies)
 	}
 }
+
+func TestLoadPlans(t *testing.T) {
+	v := viper.New()
+	v.Set("stripe.entitlement_name", "plex")
+	if plans := loadPlans(v); len(plans) != 1 || plans[0].EntitlementName != "plex" || plans[0].Sharing.AllowSync {
+		t.Errorf("loadPlans() without plans = %+v, want restrictive default plan for %q", plans, "plex")
+	}
+
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(strings.NewReader(`
+[[plans]]
+name = "premium"
+entitlement_name = "plex-premium"
+[plans.sharing]
+allow_sync = true
+allow_tuners = 2
+[plans.sharing.filter_movies]
+exclude_content_ratings = ["R"]
+`)); err != nil {
+		t.Fatal(err)
+	}
+	plans := loadPlans(v)
+	if len(plans) != 1 || plans[0].Name != "premium" {
+		t.Fatalf("loadPlans() = %+v, want premium plan", plans)
+	}
+	sharing := plans[0].Sharing
+	if !sharing.AllowSync || sharing.AllowTuners != 2 || sharing.FilterMovies.String() != "contentRating!=R" {
+		t.Errorf("loadPlans() sharing = %+v, want sync, DVR and movie rating filter", sharing)
+	}
+}
+
+func TestCheckPlanServers(t *testing.T) {
+	plex := PlexConfig{Servers: []PlexServerConfig{{Name: "Main"}, {Name: "4K"}}}
+	tests := []struct {
+		name    string
+		servers []string
+		wantErr bool
+	}{
+		{"all servers", nil, false},
+		{"known servers", []string{"main", "4K"}, false},
+		{"unknown server", []string{"Main", "4k-typo"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plans := []PlanConfig{{Name: "default"}, {Name: "premium", Servers: tt.servers}}
+			if err := checkPlanServers(plans, plex); (err != nil) != tt.wantErr {
+				t.Errorf("checkPlanServers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadServers(t *testing.T) {
+	v := viper.New()
+	v.Set("plex.url", "http://plex:32400/")
+	v.Set("plex.token", "tok")
+	v.Set("plex.shared_libraries", "Movies, TV Shows")
+	servers := loadServers(v)
+	if len(servers) != 1 || servers[0].Url != "http://plex:32400" || servers[0].Token.Value() != "tok" ||
+		len(servers[0].SharedLibraries) != 2 || servers[0].SharedLibraries[1] != "TV Shows" {
+		t.Errorf("loadServers() without plex.servers = %+v, want single server from plex.url", servers)
+	}
+
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(strings.NewReader(`
+[[plex.servers]]
+name = "main"
+url = "http://main:32400"
+
+[[plex.servers]]
+name = "4k"
+url = "http://4k:32400"
+token = "4k-token"
+shared_libraries = ["Movies 4K"]
+`)); err != nil {
+		t.Fatal(err)
+	}
+	servers = loadServers(v)
+	if len(servers) != 2 {
+		t.Fatalf("loadServers() = %+v, want 2 servers", servers)
+	}
+	if servers[0].Token.Value() != "tok" || len(servers[0].SharedLibraries) != 2 {
+		t.Errorf("loadServers() main = %+v, want inherited token and libraries", servers[0])
+	}
+	if servers[1].Token.Value() != "4k-token" || servers[1].SharedLibraries[0] != "Movies 4K" {
+		t.Errorf("loadServers() 4k = %+v, want own token and libraries", servers[1])
+	}
+}
+
+func TestLoadSharingProfiles(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(strings.NewReader(`
+[[sharing_profiles]]
+name = "kids"
+content_ratings = ["G", "PG", "TV-Y", "TV-G"]
+exclude_labels = ["scary"]
+`)); err != nil {
+		t.Fatal(err)
+	}
+	C = AppConfig{SharingProfiles: loadSharingProfiles(v)}
+
+	profile, ok := C.SharingProfile("Kids")
+	if !ok {
+		t.Fatalf("SharingProfile(%q) not found in %+v", "Kids", C.SharingProfiles)
+	}
+	settings := profile.Apply(models.SharingSettings{AllowSync: true})
+	want := "label!=scary|contentRating=G%2CPG%2CTV-Y%2CTV-G"
+	if !settings.AllowSync || settings.FilterMovies.String() != want || settings.FilterTelevision.String() != want {
+		t.Errorf("Apply() = %+v, want sync kept and movie and TV filters %q", settings, want)
+	}
+	if _, ok := C.SharingProfile("teens"); ok {
+		t.Error("SharingProfile() found an unknown profile")
+	}
+}
+
+func TestLoadReferrals(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]any
+		want     string
+	}{
+		{"disabled", map[string]any{}, ""},
+		{"credit", map[string]any{"referrals.reward_type": "Credit", "referrals.credit_amount": 500}, ReferralRewardCredit},
+		{"credit without amount", map[string]any{"referrals.reward_type": "credit"}, ""},
+		{"coupon", map[string]any{"referrals.reward_type": "coupon", "referrals.coupon_id": "FRIEND"}, ReferralRewardCoupon},
+		{"coupon without id", map[string]any{"referrals.reward_type": "coupon"}, ""},
+		{"unknown", map[string]any{"referrals.reward_type": "cash", "referrals.credit_amount": 500}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			for key, value := range tt.settings {
+				v.Set(key, value)
+			}
+			if got := loadReferrals(v); got.RewardType != tt.want || got.Enabled() != (tt.want != "") {
+				t.Errorf("loadReferrals() = %+v, want reward type %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package v1controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxAccessRequestMessage is the longest message, in characters, of an access request
+const maxAccessRequestMessage = 1000
+
+// CreateAccessRequestRequest represents the request body for requesting access
+type CreateAccessRequestRequest struct {
+	Message string `json:"message"`
+}
+
+// ReviewAccessRequestRequest represents the request body for approving or rejecting an access request
+type ReviewAccessRequestRequest struct {
+	Note string `json:"note"`
+}
+
+// AccessRequestResponse represents the response containing an access request
+type AccessRequestResponse struct {
+	models.BaseResponse
+	AccessRequest models.AccessRequest `json:"access_request"`
+}
+
+// ListAccessRequestsResponse represents the response for listing access requests
+type ListAccessRequestsResponse struct {
+	models.BaseResponse
+	AccessRequests []models.AccessRequest `json:"access_requests"`
+}
+
+// CreateAccessRequest lets a user without access ask an admin for it
+func (h *V1) CreateAccessRequest(c echo.Context, user *models.UserInfo) error {
+	var req CreateAccessRequestRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "A message is required")
+	}
+	if utf8.RuneCountInString(message) > maxAccessRequestMessage {
+		return echo.NewHTTPError(http.StatusBadRequest, "Message must be at most "+strconv.Itoa(maxAccessRequestMessage)+" characters")
+	}
+
+	hasAccess, err := hasServerAccess(c.Request().Context(), user.ID)
+	if err != nil {
+		slog.Error("Failed to check server access", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check server access")
+	}
+	if hasAccess {
+		return echo.NewHTTPError(http.StatusConflict, "You already have access")
+	}
+
+	request, err := db.DB.CreateAccessRequest(c.Request().Context(), user.ID, message)
+	if errors.Is(err, models.ErrAccessRequestPending) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		slog.Error("Failed to create access request", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create access request")
+	}
+	slog.Info("Access requested", "user_id", user.ID, "request_id", request.ID)
+
+	return c.JSON(http.StatusCreated, AccessRequestResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Access request submitted successfully",
+		},
+		AccessRequest: *request,
+	})
+}
+
+// GetMyAccessRequest returns the user's most recent access request, so they
+// can poll whether it was reviewed
+func (h *V1) GetMyAccessRequest(c echo.Context, user *models.UserInfo) error {
+	request, err := db.DB.GetLatestAccessRequest(c.Request().Context(), user.ID)
+	if err != nil {
+		slog.Error("Failed to get access request", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get access request")
+	}
+	if request == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "No access request found")
+	}
+
+	return c.JSON(http.StatusOK, AccessRequestResponse{
+		BaseResponse: models.BaseResponse{
+			Status: "success",
+		},
+		AccessRequest: *request,
+	})
+}
+
+// ListAccessRequests lists the access requests with the status given by the
+// status query parameter, pending ones by default, or "all" (admin only)
+func (h *V1) ListAccessRequests(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "":
+		status = models.AccessRequestPending
+	case "all":
+		status = ""
+	case models.AccessRequestPending, models.AccessRequestApproved, models.AccessRequestRejected:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid status "+strconv.Quote(status))
+	}
+
+	requests, err := db.DB.ListAccessRequests(c.Request().Context(), status)
+	if err != nil {
+		slog.Error("Failed to list access requests", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve access requests")
+	}
+
+	return c.JSON(http.StatusOK, ListAccessRequestsResponse{
+		BaseResponse: models.BaseResponse{
+			Status: "success",
+		},
+		AccessRequests: requests,
+	})
+}
+
+// ApproveAccessRequest shares the default plan's servers with the user of a
+// pending access request, accepting the invites with their stored token
+// when we have one (admin only)
+func (h *V1) ApproveAccessRequest(c echo.Context, admin *models.UserInfo) error {
+	request, req, err := pendingAccessRequest(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := db.DB.GetPlexUser(c.Request().Context(), request.UserID)
+	if err != nil || user == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+	if user.Email == "" && !user.IsManaged {
+		return echo.NewHTTPError(http.StatusBadRequest, "User has no email address")
+	}
+
+	plan := planFor(config.C.Stripe.EntitlementName)
+	settings, err := sharingSettings(plan, nil, "")
+	if err != nil {
+		slog.Error("Failed to resolve sharing settings", "error", err, "plan", plan.Name)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve sharing settings")
+	}
+
+	access, err := serverAccess(c.Request().Context(), user.ID)
+	if err != nil {
+		slog.Error("Failed to check server access", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check server access")
+	}
+	shared := sharedServers(access)
+
+	// Share each server of the plan the user doesn't have access to or an invite for yet
+	for _, server := range config.C.ServersForPlan(plan) {
+		if shared[server.MachineIdentifier] {
+			continue
+		}
+		if _, err := h.shareServer(c.Request().Context(), server, user, plan.Libraries, settings, ""); err != nil {
+			slog.Error("Failed to share Plex library with user", "error", err, "user_id", user.ID, "server", server.Name)
+			return plexHTTPError(err, "Failed to grant Plex access")
+		}
+	}
+	assignPlan(c.Request().Context(), user.ID, plan)
+
+	return reviewAccessRequest(c, request, models.AccessRequestApproved, admin, req.Note)
+}
+
+// RejectAccessRequest refuses a pending access request (admin only)
+func (h *V1) RejectAccessRequest(c echo.Context, admin *models.UserInfo) error {
+	request, req, err := pendingAccessRequest(c)
+	if err != nil {
+		return err
+	}
+	return reviewAccessRequest(c, request, models.AccessRequestRejected, admin, req.Note)
+}
+
+// pendingAccessRequest loads the pending access request given by the id path
+// parameter and binds the review request body
+func pendingAccessRequest(c echo.Context) (*models.AccessRequest, ReviewAccessRequestRequest, error) {
+	var req ReviewAccessRequestRequest
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, req, echo.NewHTTPError(http.StatusBadRequest, "Invalid access request ID")
+	}
+	if err := c.Bind(&req); err != nil {
+		return nil, req, echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	request, err := db.DB.GetAccessRequest(c.Request().Context(), id)
+	if err != nil {
+		slog.Error("Failed to get access request", "error", err, "request_id", id)
+		return nil, req, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get access request")
+	}
+	if request == nil {
+		return nil, req, echo.NewHTTPError(http.StatusNotFound, "Access request not found")
+	}
+	if request.Status != models.AccessRequestPending {
+		return nil, req, echo.NewHTTPError(http.StatusConflict, models.ErrAccessRequestReviewed.Error())
+	}
+	return request, req, nil
+}
+
+// reviewAccessRequest records the review of an access request and responds with it
+func reviewAccessRequest(c echo.Context, request *models.AccessRequest, status string, admin *models.UserInfo, note string) error {
+	err := db.DB.ReviewAccessRequest(c.Request().Context(), request.ID, status, admin.ID, strings.TrimSpace(note))
+	if errors.Is(err, models.ErrAccessRequestReviewed) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		slog.Error("Failed to review access request", "error", err, "request_id", request.ID, "status", status)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to review access request")
+	}
+	slog.Info("Access request reviewed", "request_id", request.ID, "user_id", request.UserID, "status", status, "admin_id", admin.ID)
+
+	reviewed, err := db.DB.GetAccessRequest(c.Request().Context(), request.ID)
+	if err != nil || reviewed == nil {
+		slog.Error("Failed to get access request", "error", err, "request_id", request.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get access request")
+	}
+
+	return c.JSON(http.StatusOK, AccessRequestResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Access request " + status + " successfully",
+		},
+		AccessRequest: *reviewed,
+	})
+}
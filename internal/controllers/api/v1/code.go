@@ -1,25 +1,66 @@
 package v1controller
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"log/slog"
-	"math/rand"
+	"math/big"
 	"net/http"
+	"plefi/internal/config"
 	"plefi/internal/db"
 	"plefi/internal/models"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/labstack/echo/v4"
 )
 
-// CreateInviteCodeRequest represents the request body for creating an invite code
-type CreateInviteCodeRequest struct {
-	Code            string     `json:"code"`
+// InviteCodeSettings are the settings of new invite codes
+type InviteCodeSettings struct {
 	MaxUses         *int       `json:"max_uses"`
 	ExpiresAt       *time.Time `json:"expires_at"`
 	EntitlementName string     `json:"entitlement_name"`
-	Duration        *time.Time `json:"duration"`
+	// DurationDays is how many days of access each claim grants, unlimited when omitted
+	DurationDays *int `json:"duration_days"`
+	// SharingSettings overrides the sharing settings of the entitlement's plan
+	SharingSettings *models.SharingSettings `json:"sharing_settings"`
+	// SharingProfile is the name of a sharing profile restricting the content shared
+	SharingProfile string `json:"sharing_profile"`
+	// AllowedUsers are the Plex account IDs, as "id:<ID>", emails and usernames
+	// allowed to claim the code
+	AllowedUsers []string `json:"allowed_users"`
+}
+
+// CreateInviteCodeRequest represents the request body for creating an invite code
+type CreateInviteCodeRequest struct {
+	Code string `json:"code"`
+	InviteCodeSettings
+}
+
+// UpdateInviteCodeRequest represents the request body for changing an invite
+// code. Omitted fields are left unchanged, and max_uses, expires_at,
+// duration_days and allowed_users are removed when set to null.
+type UpdateInviteCodeRequest struct {
+	MaxUses         models.Optional[int]       `json:"max_uses"`
+	ExpiresAt       models.Optional[time.Time] `json:"expires_at"`
+	DurationDays    models.Optional[int]       `json:"duration_days"`
+	EntitlementName *string                    `json:"entitlement_name"`
+	AllowedUsers    models.Optional[[]string]  `json:"allowed_users"`
+}
+
+// CreateInviteCodesRequest represents the request body for generating invite codes in bulk
+type CreateInviteCodesRequest struct {
+	Count    int    `json:"count"`    // Number of codes to generate
+	Prefix   string `json:"prefix"`   // Prefix of every code, e.g. "EVENT-"
+	Length   int    `json:"length"`   // Number of random characters after the prefix
+	Alphabet string `json:"alphabet"` // Characters codes are drawn from
+	Format   string `json:"format"`   // Response format, "json" or "csv"
+	InviteCodeSettings
 }
 
 // CreateInviteCodeResponse represents the response for create invite code request
@@ -54,20 +95,125 @@ type ClaimInviteCodeRequest struct {
 // ClaimInviteCodeResponse represents the response for claim invite code request
 type ClaimInviteCodeResponse struct {
 	models.BaseResponse
-	InviteCode models.InviteCode `json:"invite_code"`
+	InviteCode   ClaimedInviteCode `json:"invite_code"`
+	AccessEndsAt *time.Time        `json:"access_ends_at,omitempty"` // When the access granted by the code ends
+}
+
+// ClaimedInviteCode is the part of an invite code shown to the user claiming
+// it, leaving out the allowlist and admin settings
+type ClaimedInviteCode struct {
+	Code         string     `json:"code"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	DurationDays *int       `json:"duration_days,omitempty"` // Days of access granted, unlimited when omitted
 }
 
-// generateRandomCode creates a random invite code of specified length
-func generateRandomCode() string {
-	const charset = "ABCDEFGHJKMNPQRSTUVWXYZ" // Exclude O, I, L
+// CreateInviteCodesResponse represents the response for generating invite codes in bulk
+type CreateInviteCodesResponse struct {
+	models.BaseResponse
+	InviteCodes []models.InviteCode `json:"invite_codes"`
+}
+
+// Limits of generated invite codes
+const (
+	defaultCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ" // Exclude O, I, L
+	defaultCodeLength   = 6
+	minCodeLength       = 4
+	maxCodeLength       = 32
+	maxCodePrefixLength = 16
+	maxBulkCodes        = 1000
+	maxAllowedUsers     = 100
+)
+
+// generateCode creates a random invite code of the given length drawn from
+// alphabet with a cryptographically secure generator
+func generateCode(prefix, alphabet string, length int) (string, error) {
 	var sb strings.Builder
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sb.WriteString(prefix)
+	size := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(alphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
 
-	for i := 0; i < 6; i++ {
-		sb.WriteByte(charset[r.Intn(len(charset))])
+// inviteCode validates the settings and returns an invite code using them
+func (s InviteCodeSettings) inviteCode() (models.InviteCode, error) {
+	if s.EntitlementName == "" {
+		s.EntitlementName = config.C.Stripe.EntitlementName
+	}
+	if err := validateEntitlement(s.EntitlementName); err != nil {
+		return models.InviteCode{}, err
+	}
+	if s.SharingSettings != nil {
+		if err := s.SharingSettings.Validate(); err != nil {
+			return models.InviteCode{}, err
+		}
+	}
+	if s.MaxUses != nil && *s.MaxUses <= 0 {
+		return models.InviteCode{}, errors.New("max_uses must be positive")
+	}
+	if s.DurationDays != nil && *s.DurationDays <= 0 {
+		return models.InviteCode{}, errors.New("duration_days must be positive")
+	}
+	if _, ok := config.C.SharingProfile(s.SharingProfile); s.SharingProfile != "" && !ok {
+		return models.InviteCode{}, errors.New("unknown sharing profile")
+	}
+	allowedUsers, err := normalizeAllowedUsers(s.AllowedUsers)
+	if err != nil {
+		return models.InviteCode{}, err
 	}
 
-	return sb.String()
+	return models.InviteCode{
+		MaxUses:         s.MaxUses,
+		ExpiresAt:       s.ExpiresAt,
+		EntitlementName: s.EntitlementName,
+		DurationDays:    s.DurationDays,
+		SharingSettings: s.SharingSettings,
+		SharingProfile:  s.SharingProfile,
+		AllowedUsers:    allowedUsers,
+	}, nil
+}
+
+// normalizeAllowedUsers trims and lower cases the entries of an allowlist,
+// dropping empty and repeated ones, so they compare the way Plex does. Account
+// ID entries must be a positive number after the "id:" prefix.
+func normalizeAllowedUsers(allowedUsers []string) ([]string, error) {
+	normalized := make([]string, 0, len(allowedUsers))
+	seen := make(map[string]bool, len(allowedUsers))
+	for _, allowed := range allowedUsers {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" || seen[allowed] {
+			continue
+		}
+		if id, ok := strings.CutPrefix(allowed, models.AllowedUserIDPrefix); ok {
+			n, err := strconv.Atoi(id)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("allowed_users entry %q must be id: followed by a Plex account ID", allowed)
+			}
+			if allowed = models.AllowedUserID(n); seen[allowed] {
+				continue
+			}
+		}
+		seen[allowed] = true
+		normalized = append(normalized, allowed)
+	}
+	if len(normalized) > maxAllowedUsers {
+		return nil, fmt.Errorf("allowed_users must have at most %d entries", maxAllowedUsers)
+	}
+	return normalized, nil
+}
+
+// validateEntitlement checks that an entitlement grants a configured plan, so
+// that codes can only hand out libraries and settings that exist
+func validateEntitlement(entitlementName string) error {
+	if _, ok := config.C.PlanForEntitlement(entitlementName); !ok {
+		return fmt.Errorf("unknown entitlement %q, it must match a configured plan", entitlementName)
+	}
+	return nil
 }
 
 // CreateInviteCode creates a new invite code
@@ -79,25 +225,62 @@ func (h *V1) CreateInviteCode(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	// Generate random code if not provided
-	if req.Code == "" {
-		req.Code = generateRandomCode() // Generate an 8-character code
+	inviteCode, err := req.inviteCode()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
+	return createInviteCode(c, inviteCode, req.Code)
+}
 
-	// Validation
-	if req.EntitlementName == "" {
-		req.EntitlementName = "plex" // Default entitlement name
+// CreatePlexUserInviteCode creates an invite code only the user can claim,
+// to send to them without it working for anyone they forward it to. The code
+// can be used once unless max_uses says otherwise.
+func (h *V1) CreatePlexUserInviteCode(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	var req CreateInviteCodeRequest
+	if err := c.Bind(&req); err != nil {
+		slog.Error("Failed to bind request", "error", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	// Create invite code model
-	inviteCode := models.InviteCode{
-		Code:            req.Code,
-		MaxUses:         req.MaxUses,
-		ExpiresAt:       req.ExpiresAt,
-		EntitlementName: req.EntitlementName,
-		Duration:        req.Duration,
-		UsedCount:       0,
-		IsDisabled:      false,
+	user, err := db.DB.GetPlexUser(c.Request().Context(), id)
+	if err != nil {
+		slog.Error("Failed to get user", "error", err, "user_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get user")
+	}
+	if user == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+
+	// The account ID is bound rather than the email or username, which the
+	// user can change on Plex
+	req.AllowedUsers = []string{models.AllowedUserID(user.ID)}
+	if req.MaxUses == nil {
+		oneUse := 1
+		req.MaxUses = &oneUse
+	}
+	inviteCode, err := req.inviteCode()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return createInviteCode(c, inviteCode, req.Code)
+}
+
+// createInviteCode saves an invite code with the given code, or a generated
+// one when empty, and responds with it
+func createInviteCode(c echo.Context, inviteCode models.InviteCode, code string) error {
+	var err error
+
+	// Generate random code if not provided
+	inviteCode.Code = code
+	if inviteCode.Code == "" {
+		if inviteCode.Code, err = generateCode("", defaultCodeAlphabet, defaultCodeLength); err != nil {
+			slog.Error("Failed to generate invite code", "error", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create invite code")
+		}
 	}
 
 	// Save to database
@@ -120,6 +303,128 @@ func (h *V1) CreateInviteCode(c echo.Context) error {
 	})
 }
 
+// CreateInviteCodes generates invite codes in bulk with the same settings,
+// returned as JSON or as a CSV download
+func (h *V1) CreateInviteCodes(c echo.Context) error {
+	var req CreateInviteCodesRequest
+	if err := c.Bind(&req); err != nil {
+		slog.Error("Failed to bind request", "error", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Count < 1 || req.Count > maxBulkCodes {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", maxBulkCodes))
+	}
+	if req.Length == 0 {
+		req.Length = defaultCodeLength
+	}
+	if req.Length < minCodeLength || req.Length > maxCodeLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("length must be between %d and %d", minCodeLength, maxCodeLength))
+	}
+	if err := validatePrefix(req.Prefix); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Alphabet == "" {
+		req.Alphabet = defaultCodeAlphabet
+	}
+	if err := validateAlphabet(req.Alphabet); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Format != "" && req.Format != "json" && req.Format != "csv" {
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be json or csv")
+	}
+	inviteCode, err := req.inviteCode()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	codes, err := db.DB.SaveGeneratedInviteCodes(c.Request().Context(), inviteCode, req.Count, func() (string, error) {
+		return generateCode(req.Prefix, req.Alphabet, req.Length)
+	})
+	if errors.Is(err, models.ErrInviteCodeTaken) {
+		return echo.NewHTTPError(http.StatusConflict, "Not enough unused codes, use a longer length or larger alphabet")
+	}
+	if err != nil {
+		slog.Error("Failed to save invite codes", "error", err, "count", req.Count)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create invite codes")
+	}
+	slog.Info("Generated invite codes", "count", len(codes), "prefix", req.Prefix, "entitlement", inviteCode.EntitlementName)
+
+	if req.Format == "csv" {
+		return writeInviteCodesCSV(c, codes)
+	}
+	return c.JSON(http.StatusCreated, CreateInviteCodesResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Invite codes created successfully",
+		},
+		InviteCodes: codes,
+	})
+}
+
+// validatePrefix checks that a prefix of generated codes is short and only
+// contains ASCII letters, digits and hyphens, so codes can be typed in and
+// are safe to show and export
+func validatePrefix(prefix string) error {
+	if len(prefix) > maxCodePrefixLength {
+		return fmt.Errorf("prefix must be at most %d characters", maxCodePrefixLength)
+	}
+	for _, r := range prefix {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-') {
+			return errors.New("prefix must only contain ASCII letters, digits and hyphens")
+		}
+	}
+	return nil
+}
+
+// validateAlphabet checks that codes drawn from an alphabet are random and
+// can be typed in
+func validateAlphabet(alphabet string) error {
+	seen := make(map[rune]bool, len(alphabet))
+	for _, r := range alphabet {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return errors.New("alphabet must only contain printable ASCII characters")
+		}
+		if seen[r] {
+			return fmt.Errorf("alphabet contains %q more than once", r)
+		}
+		seen[r] = true
+	}
+	if len(seen) < 2 {
+		return errors.New("alphabet must contain at least 2 characters")
+	}
+	return nil
+}
+
+// writeInviteCodesCSV sends invite codes as a CSV file download
+func writeInviteCodesCSV(c echo.Context, codes []models.InviteCode) error {
+	filename := fmt.Sprintf("invite-codes-%s.csv", time.Now().Format("20060102-150405"))
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusCreated)
+
+	optional := func(value *int) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.Itoa(*value)
+	}
+	w := csv.NewWriter(c.Response())
+	if err := w.Write([]string{"code", "entitlement_name", "max_uses", "expires_at", "duration_days"}); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		expiresAt := ""
+		if code.ExpiresAt != nil {
+			expiresAt = code.ExpiresAt.Format(time.RFC3339)
+		}
+		if err := w.Write([]string{code.Code, code.EntitlementName, optional(code.MaxUses), expiresAt, optional(code.DurationDays)}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
 // GetInviteCodeUsers retrieves all Plex users who have used a specific invite code
 func (h *V1) GetInviteCode(c echo.Context) error {
 	// Get code ID from path parameter
@@ -153,14 +458,42 @@ func (h *V1) GetInviteCode(c echo.Context) error {
 	})
 }
 
-// ListInviteCodes lists all active invite codes
+// ListInviteCodes lists invite codes, filtered by the comma separated
+// statuses of the status query parameter or "all". Without a filter, every
+// code but disabled ones is listed.
 func (h *V1) ListInviteCodes(c echo.Context) error {
-	// Get active invite codes from database
-	codes, err := db.DB.ListActiveInviteCodes(c.Request().Context())
+	statuses := map[string]bool{
+		models.InviteCodeStatusActive:    true,
+		models.InviteCodeStatusExpired:   true,
+		models.InviteCodeStatusExhausted: true,
+	}
+	if filter := c.QueryParam("status"); filter == "all" {
+		statuses[models.InviteCodeStatusDisabled] = true
+	} else if filter != "" {
+		statuses = make(map[string]bool)
+		for _, status := range strings.Split(filter, ",") {
+			switch status = strings.TrimSpace(status); status {
+			case models.InviteCodeStatusActive, models.InviteCodeStatusDisabled,
+				models.InviteCodeStatusExpired, models.InviteCodeStatusExhausted:
+				statuses[status] = true
+			default:
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid status "+strconv.Quote(status))
+			}
+		}
+	}
+
+	allCodes, err := db.DB.ListInviteCodes(c.Request().Context())
 	if err != nil {
 		slog.Error("Failed to list invite codes", "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve invite codes")
 	}
+	now := time.Now()
+	codes := make([]models.InviteCode, 0, len(allCodes))
+	for _, code := range allCodes {
+		if statuses[code.Status(now)] {
+			codes = append(codes, code)
+		}
+	}
 
 	// Return success response
 	return c.JSON(http.StatusOK, ListInviteCodesResponse{
@@ -172,6 +505,112 @@ func (h *V1) ListInviteCodes(c echo.Context) error {
 	})
 }
 
+// UpdateInviteCode changes the limits and entitlement of an invite code.
+// Access already granted by the code is unaffected.
+func (h *V1) UpdateInviteCode(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid invite code ID")
+	}
+	var req UpdateInviteCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	code, err := db.DB.GetInviteCode(c.Request().Context(), id)
+	if err != nil {
+		slog.Error("Failed to get invite code", "error", err, "code_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch invite code")
+	}
+	if code == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "code not found")
+	}
+
+	if req.MaxUses.Set {
+		if req.MaxUses.Value != nil && *req.MaxUses.Value <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "max_uses must be positive")
+		}
+		code.MaxUses = req.MaxUses.Value
+	}
+	if req.ExpiresAt.Set {
+		code.ExpiresAt = req.ExpiresAt.Value
+	}
+	if req.DurationDays.Set {
+		if req.DurationDays.Value != nil && *req.DurationDays.Value <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "duration_days must be positive")
+		}
+		code.DurationDays = req.DurationDays.Value
+	}
+	if req.EntitlementName != nil {
+		if err := validateEntitlement(*req.EntitlementName); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		code.EntitlementName = *req.EntitlementName
+	}
+	if req.AllowedUsers.Set {
+		var allowedUsers []string
+		if req.AllowedUsers.Value != nil {
+			allowedUsers = *req.AllowedUsers.Value
+		}
+		if code.AllowedUsers, err = normalizeAllowedUsers(allowedUsers); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	if err := db.DB.UpdateInviteCode(c.Request().Context(), *code); err != nil {
+		slog.Error("Failed to update invite code", "error", err, "code_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update invite code")
+	}
+
+	return c.JSON(http.StatusOK, CreateInviteCodeResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Invite code updated successfully",
+		},
+		InviteCode: *code,
+	})
+}
+
+// EnableInviteCode enables a disabled invite code again
+func (h *V1) EnableInviteCode(c echo.Context) error {
+	return setInviteCodeDisabled(c, false)
+}
+
+// DisableInviteCode disables an invite code, so it can't be claimed anymore
+func (h *V1) DisableInviteCode(c echo.Context) error {
+	return setInviteCodeDisabled(c, true)
+}
+
+// setInviteCodeDisabled disables or enables the invite code given by the id path parameter
+func setInviteCodeDisabled(c echo.Context, disabled bool) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid invite code ID")
+	}
+	action := "enabled"
+	if disabled {
+		action = "disabled"
+	}
+
+	code, err := db.DB.GetInviteCode(c.Request().Context(), id)
+	if err != nil {
+		slog.Error("Failed to get invite code", "error", err, "code_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch invite code")
+	}
+	if code == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "code not found")
+	}
+	if err := db.DB.SetInviteCodeDisabled(c.Request().Context(), id, disabled); err != nil {
+		slog.Error("Failed to update invite code", "error", err, "code_id", id, "disabled", disabled)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update invite code")
+	}
+
+	return c.JSON(http.StatusOK, models.BaseResponse{
+		Status:  "success",
+		Message: "Invite code " + action + " successfully",
+	})
+}
+
 // ClaimInviteCode allows a Plex user to claim an invite code
 func (h *V1) ClaimInviteCode(c echo.Context, user *models.UserInfo) error {
 	// Parse request body
@@ -180,65 +619,68 @@ func (h *V1) ClaimInviteCode(c echo.Context, user *models.UserInfo) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	// Get all active codes and find the matching one
-	inviteCode, err := db.DB.GetInviteCodeByCode(c.Request().Context(), req.Code)
-	if err != nil || inviteCode == nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "code not found")
+	// The attempt counts as failed until the claim gets far enough, so that
+	// parallel guesses can't all get past the limits
+	attemptID, err := reserveClaim(c, user.ID, c.RealIP(), req.Code)
+	if err != nil {
+		return err
 	}
+	failure := ""
+	defer func() {
+		finishClaim(context.WithoutCancel(c.Request().Context()), attemptID, failure)
+	}()
 
-	now := time.Now()
-	if inviteCode.IsDisabled ||
-		(inviteCode.Duration != nil && inviteCode.Duration.Before(now)) ||
-		(inviteCode.ExpiresAt != nil && inviteCode.ExpiresAt.Before(now)) ||
-		(inviteCode.UsedCount >= *inviteCode.MaxUses) {
-		slog.Error("invite code is disabled or expired",
-			"code_id", inviteCode.ID,
-			"code", req.Code,
-			"duration", inviteCode.Duration,
-			"expires_at", inviteCode.ExpiresAt,
-			"used_count", inviteCode.UsedCount,
-			"max_uses", *inviteCode.MaxUses)
-		return echo.NewHTTPError(http.StatusBadRequest, "code not found")
-	}
-
-	// Associate the code with the user
-	err = db.DB.AssociatePlexUserWithInviteCode(c.Request().Context(), user.ID, inviteCode.ID)
+	inviteCode, err := db.DB.GetInviteCodeByCode(c.Request().Context(), req.Code)
 	if err != nil {
-		slog.Error("Failed to associate user with invite code", "error", err, "user_id", user.ID, "code_id", inviteCode.ID)
+		slog.Error("Failed to get invite code", "error", err, "code", req.Code)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to claim invite code")
 	}
+	if inviteCode == nil {
+		failure = models.InviteCodeAttemptNotFound
+		return echo.NewHTTPError(http.StatusNotFound, "code not found")
+	}
+	if !inviteCode.AllowsUser(user) {
+		slog.Info("Invite code claimed by a user it isn't allowed for", "code_id", inviteCode.ID, "user_id", user.ID)
+		failure = models.InviteCodeAttemptNotAllowed
+		return echo.NewHTTPError(http.StatusForbidden, models.ErrInviteCodeNotAllowed.Error())
+	}
 
-	// Update the usage count of the invite code
-	err = db.DB.UpdateInviteCodeUsage(c.Request().Context(), inviteCode.ID)
+	// Sharing without the code's restrictions could expose unsuitable content,
+	// so the code can't be claimed while its plan or sharing profile is unknown
+	plan, ok := config.C.PlanForEntitlement(inviteCode.EntitlementName)
+	if !ok {
+		slog.Error("Invite code grants an unknown entitlement", "code_id", inviteCode.ID, "entitlement", inviteCode.EntitlementName)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Invite code is misconfigured, please contact an administrator")
+	}
+	settings, err := sharingSettings(plan, inviteCode.SharingSettings, inviteCode.SharingProfile)
 	if err != nil {
-		slog.Error("Failed to update invite code usage", "error", err, "code_id", inviteCode.ID)
-		// Not returning an error here as the code was already claimed
+		slog.Error("Failed to resolve sharing settings of invite code", "error", err, "code_id", inviteCode.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Invite code is misconfigured, please contact an administrator")
 	}
 
+	// Associate the code with the user and count the use
+	now := time.Now()
+	inviteCode, err = db.DB.RedeemInviteCode(c.Request().Context(), inviteCode.ID, user.ID, now)
+	if err != nil {
+		failure = failedClaimReason(err)
+		return redeemHTTPError(err, user.ID, req.Code)
+	}
+	accessEndsAt := inviteCode.AccessEndsAt(now)
+
 	// Get the user's details to get email address
 	plexUser, err := db.DB.GetPlexUser(c.Request().Context(), user.ID)
 	if err != nil {
 		slog.Error("Failed to get user details", "error", err, "user_id", user.ID)
 		// Continue despite error, as the code was claimed successfully
 	} else if plexUser != nil && plexUser.Email != "" {
-		// Share the Plex library with the user
-		invite, err := h.services.Plex.ShareLibrary(c.Request().Context(), plexUser.Email)
-		if err != nil {
-			slog.Error("Failed to share Plex library with user", "error", err, "user_id", user.ID, "email", plexUser.Email)
-			// Continue despite error, as the code was claimed successfully
-		} else {
-			slog.Info("Plex library shared with user", "user_id", user.ID, "email", plexUser.Email, "invite_id", invite.ID)
-
-			// Try to auto-accept the invitation if we have the user's Plex token
-			token, tokenErr := db.DB.GetPlexToken(c.Request().Context(), user.ID)
-			if tokenErr == nil && token != nil && token.AccessToken != "" {
-				if acceptErr := h.services.Plex.AcceptInvite(c.Request().Context(), token.AccessToken, invite.ID); acceptErr != nil {
-					slog.Error("Failed to auto-accept Plex invite", "error", acceptErr, "user_id", user.ID, "invite_id", invite.ID)
-				} else {
-					slog.Info("Plex invite auto-accepted", "user_id", user.ID, "invite_id", invite.ID)
-				}
+		// Share the servers of the code's plan with the user
+		for _, server := range config.C.ServersForPlan(plan) {
+			if _, err := h.shareServer(c.Request().Context(), server, plexUser, plan.Libraries, settings, inviteCode.SharingProfile); err != nil {
+				slog.Error("Failed to share Plex library with user", "error", err, "user_id", user.ID, "email", plexUser.Email, "server", server.Name)
+				// Continue despite error, as the code was claimed successfully
 			}
 		}
+		assignPlan(c.Request().Context(), plexUser.ID, plan)
 	}
 
 	// Return success response
@@ -247,11 +689,48 @@ func (h *V1) ClaimInviteCode(c echo.Context, user *models.UserInfo) error {
 			Status:  "success",
 			Message: "Invite code claimed successfully",
 		},
-		InviteCode: *inviteCode,
+		InviteCode: ClaimedInviteCode{
+			Code:         inviteCode.Code,
+			ExpiresAt:    inviteCode.ExpiresAt,
+			DurationDays: inviteCode.DurationDays,
+		},
+		AccessEndsAt: accessEndsAt,
 	})
 }
 
-// DeleteInviteCode disables an existing invite code
+// failedClaimReason returns the reason a code couldn't be redeemed that
+// counts as a failed attempt, or "" when it doesn't count
+func failedClaimReason(err error) string {
+	switch {
+	case errors.Is(err, models.ErrInviteCodeDisabled):
+		return models.InviteCodeStatusDisabled
+	case errors.Is(err, models.ErrInviteCodeExpired):
+		return models.InviteCodeStatusExpired
+	case errors.Is(err, models.ErrInviteCodeExhausted):
+		return models.InviteCodeStatusExhausted
+	default:
+		return ""
+	}
+}
+
+// redeemHTTPError maps the reason an invite code couldn't be redeemed to an HTTP error
+func redeemHTTPError(err error, userID int, code string) error {
+	switch {
+	case errors.Is(err, models.ErrInviteCodeDisabled),
+		errors.Is(err, models.ErrInviteCodeExpired),
+		errors.Is(err, models.ErrInviteCodeExhausted):
+		slog.Info("Invite code can't be redeemed", "reason", err, "user_id", userID, "code", code)
+		return echo.NewHTTPError(http.StatusGone, err.Error())
+	case errors.Is(err, models.ErrInviteCodeAlreadyClaimed):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		slog.Error("Failed to redeem invite code", "error", err, "user_id", userID, "code", code)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to claim invite code")
+	}
+}
+
+// DeleteInviteCode permanently deletes an invite code that nobody has
+// claimed. Claimed codes can only be disabled.
 func (h *V1) DeleteInviteCode(c echo.Context) error {
 	// Get code ID from path parameter
 	idStr := c.Param("id")
@@ -260,18 +739,29 @@ func (h *V1) DeleteInviteCode(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid invite code ID")
 	}
 
-	// Disable the invite code in database
-	err = db.DB.DisableInviteCode(c.Request().Context(), id)
+	code, err := db.DB.GetInviteCode(c.Request().Context(), id)
+	if err != nil {
+		slog.Error("Failed to get invite code", "error", err, "code_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch invite code")
+	}
+	if code == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "code not found")
+	}
+
+	deleted, err := db.DB.DeleteUnusedInviteCode(c.Request().Context(), id)
 	if err != nil {
-		slog.Error("Failed to disable invite code", "error", err, "code_id", id)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to disable invite code")
+		slog.Error("Failed to delete invite code", "error", err, "code_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete invite code")
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusConflict, "Invite code has been claimed, disable it instead")
 	}
 
 	// Return success response
 	return c.JSON(http.StatusOK, DeleteInviteCodeResponse{
 		BaseResponse: models.BaseResponse{
 			Status:  "success",
-			Message: "Invite code disabled successfully",
+			Message: "Invite code deleted successfully",
 		},
 	})
 }
@@ -0,0 +1,145 @@
+package v1controller
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxListedAttempts is how many of the most recent failed attempts are listed
+const maxListedAttempts = 200
+
+// ListInviteCodeLockoutsResponse represents the response for listing lockouts
+type ListInviteCodeLockoutsResponse struct {
+	models.BaseResponse
+	Lockouts []models.InviteCodeLockout `json:"lockouts"`
+}
+
+// ListInviteCodeAttemptsResponse represents the response for listing failed attempts
+type ListInviteCodeAttemptsResponse struct {
+	models.BaseResponse
+	Attempts []models.InviteCodeAttempt `json:"attempts"`
+}
+
+// claimLimits returns the limits that apply to a claim by a user from an IP
+// address, leaving out the disabled ones. The user's limit comes first, so
+// that subjects are always locked in the same order.
+func claimLimits(userID int, ip string) []models.ClaimLimit {
+	limits := make([]models.ClaimLimit, 0, 2)
+	if maxFailed := config.C.InviteCodes.MaxFailedAttempts; maxFailed > 0 {
+		limits = append(limits, models.ClaimLimit{
+			SubjectType: models.LockoutSubjectUser,
+			Subject:     strconv.Itoa(userID),
+			UserID:      &userID,
+			MaxFailed:   maxFailed,
+		})
+	}
+	if maxFailed := config.C.InviteCodes.MaxFailedAttemptsPerIP; maxFailed > 0 && ip != "" {
+		limits = append(limits, models.ClaimLimit{
+			SubjectType: models.LockoutSubjectIP,
+			Subject:     ip,
+			MaxFailed:   maxFailed,
+		})
+	}
+	return limits
+}
+
+// reserveClaim records a claim attempt before the code is looked up, and
+// returns a 429 error when the user or their IP address is locked out of
+// claiming invite codes. Claims are refused when the limits can't be checked.
+func reserveClaim(c echo.Context, userID int, ip, code string) (int, error) {
+	attemptID, lockout, err := db.DB.ReserveInviteCodeClaim(c.Request().Context(), models.InviteCodeAttempt{
+		UserID:    userID,
+		IPAddress: ip,
+		Code:      code,
+		CreatedAt: time.Now(),
+	}, claimLimits(userID, ip), config.C.InviteCodes.AttemptWindow, config.C.InviteCodes.LockoutDuration)
+	if err != nil {
+		slog.Error("Failed to reserve invite code claim", "error", err, "user_id", userID, "ip", ip)
+		return 0, echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to claim invite code, try again later")
+	}
+	if lockout != nil {
+		slog.Warn("Invite code claim refused by lockout",
+			"subject_type", lockout.SubjectType,
+			"subject", lockout.Subject,
+			"failed_attempts", lockout.FailedAttempts,
+			"locked_until", lockout.LockedUntil)
+		retryAfter := int(math.Ceil(time.Until(lockout.EndsAt()).Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		return 0, echo.NewHTTPError(http.StatusTooManyRequests, "Too many failed attempts, try again later")
+	}
+	return attemptID, nil
+}
+
+// finishClaim records why a reserved claim failed, or forgets the attempt
+// when reason is empty because the claim succeeded or doesn't count as failed
+func finishClaim(ctx context.Context, attemptID int, reason string) {
+	if err := db.DB.FinishInviteCodeClaim(ctx, attemptID, reason); err != nil {
+		slog.Error("Failed to record invite code attempt", "error", err, "attempt_id", attemptID, "reason", reason)
+	}
+}
+
+// ListInviteCodeLockouts lists the users and IP addresses currently locked
+// out of claiming invite codes (admin only)
+func (h *V1) ListInviteCodeLockouts(c echo.Context) error {
+	lockouts, err := db.DB.ListActiveInviteCodeLockouts(c.Request().Context(), time.Now())
+	if err != nil {
+		slog.Error("Failed to list invite code lockouts", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve lockouts")
+	}
+
+	return c.JSON(http.StatusOK, ListInviteCodeLockoutsResponse{
+		BaseResponse: models.BaseResponse{
+			Status: "success",
+		},
+		Lockouts: lockouts,
+	})
+}
+
+// LiftInviteCodeLockout ends a lockout early (admin only)
+func (h *V1) LiftInviteCodeLockout(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid lockout ID")
+	}
+
+	lifted, err := db.DB.LiftInviteCodeLockout(c.Request().Context(), id, time.Now())
+	if err != nil {
+		slog.Error("Failed to lift invite code lockout", "error", err, "lockout_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to lift lockout")
+	}
+	if !lifted {
+		return echo.NewHTTPError(http.StatusNotFound, "No active lockout found")
+	}
+	slog.Info("Invite code lockout lifted", "lockout_id", id)
+
+	return c.JSON(http.StatusOK, models.BaseResponse{
+		Status:  "success",
+		Message: "Lockout lifted successfully",
+	})
+}
+
+// ListInviteCodeAttempts lists the most recent failed attempts to claim
+// invite codes (admin only)
+func (h *V1) ListInviteCodeAttempts(c echo.Context) error {
+	attempts, err := db.DB.ListInviteCodeAttempts(c.Request().Context(), maxListedAttempts)
+	if err != nil {
+		slog.Error("Failed to list invite code attempts", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve attempts")
+	}
+
+	return c.JSON(http.StatusOK, ListInviteCodeAttemptsResponse{
+		BaseResponse: models.BaseResponse{
+			Status: "success",
+		},
+		Attempts: attempts,
+	})
+}
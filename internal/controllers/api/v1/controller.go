@@ -38,6 +38,24 @@ func (v *V1) GetRoutes(r *echo.Group) {
 		stripe.POST("/cancel-subscription", middleware.UserHandler(v.CancelUserSubscription))
 	}
 
+	accessRequests := r.Group("/access-requests")
+	{
+		accessRequests.POST("", middleware.UserHandler(v.CreateAccessRequest))
+		accessRequests.GET("/me", middleware.UserHandler(v.GetMyAccessRequest))
+		admin := accessRequests.Group("", adminMiddleware)
+		{
+			admin.GET("", v.ListAccessRequests)
+			admin.POST("/:id/approve", middleware.UserHandler(v.ApproveAccessRequest))
+			admin.POST("/:id/reject", middleware.UserHandler(v.RejectAccessRequest))
+		}
+	}
+
+	referrals := r.Group("/referrals")
+	{
+		referrals.GET("", middleware.UserHandler(v.GetReferrals))
+		referrals.GET("/join/:code", v.JoinReferral)
+	}
+
 	plex := r.Group("/plex")
 	{
 		admin := plex.Group("/users", adminMiddleware)
@@ -46,12 +64,28 @@ func (v *V1) GetRoutes(r *echo.Group) {
 			admin.GET("/:id", v.GetPlexUser)
 			admin.GET("/:id/invites", v.GetPlexUserInvites)
 			admin.GET("/:id/access", v.CheckServerAccess)
+			admin.POST("/:id/codes", v.CreatePlexUserInviteCode)
 			admin.POST("/import", v.ImportPlexUsers)
+			admin.POST("/managed", v.CreateManagedPlexUser)
 			admin.POST("/access", v.GrantPlexAccess)
+			admin.PUT("/:id/access", v.UpdatePlexAccess)
+			admin.PUT("/:id/exempt", v.SetUserExempt)
 			admin.POST("/notes", v.SetUserNotes) // New endpoint for setting user notes
 			admin.DELETE("/:id", middleware.UserHandler(v.DeletePlexUser))
 			admin.DELETE("/:id/access", v.RevokePlexAccess)
 		}
+		invites := plex.Group("/invites", adminMiddleware)
+		{
+			invites.GET("", v.GetPendingInvites)
+			invites.POST("/:id/resend", v.ResendInvite)
+			invites.POST("/:id/accept", v.AcceptPendingInvite)
+			invites.DELETE("/:id", v.CancelInvite)
+		}
+		plex.GET("/libraries", v.GetPlexLibraries, adminMiddleware)
+		plex.GET("/sessions", v.GetPlexSessions, adminMiddleware)
+		plex.GET("/sessions/history", v.GetPlexSessionHistory, adminMiddleware)
+		plex.GET("/streams/enforcements", v.GetStreamEnforcements, adminMiddleware)
+		plex.GET("/inactivity", v.GetInactivityReport, adminMiddleware)
 		plex.GET("/check-access", middleware.UserHandler(v.GetServerAccess))
 	}
 	// Add new routes for invite code management
@@ -60,8 +94,15 @@ func (v *V1) GetRoutes(r *echo.Group) {
 		admin := codes.Group("", adminMiddleware)
 		{
 			admin.POST("", v.CreateInviteCode)
+			admin.POST("/bulk", v.CreateInviteCodes)
 			admin.GET("", v.ListInviteCodes)
+			admin.GET("/lockouts", v.ListInviteCodeLockouts)
+			admin.DELETE("/lockouts/:id", v.LiftInviteCodeLockout)
+			admin.GET("/attempts", v.ListInviteCodeAttempts)
 			admin.GET("/:id", v.GetInviteCode)
+			admin.PATCH("/:id", v.UpdateInviteCode)
+			admin.POST("/:id/enable", v.EnableInviteCode)
+			admin.POST("/:id/disable", v.DisableInviteCode)
 			admin.DELETE("/:id", v.DeleteInviteCode)
 		}
 		codes.POST("/claim", middleware.UserHandler(v.ClaimInviteCode))
@@ -0,0 +1,101 @@
+package v1controller
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"plefi/internal/db"
+	"plefi/internal/jobs"
+	"plefi/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// minInactivityNotice is how long users keep their access after first being
+// shown an inactivity warning, when its revoke date is sooner
+const minInactivityNotice = 24 * time.Hour
+
+// GetInactivityReportResponse represents the response for the inactivity policy dry run
+type GetInactivityReportResponse struct {
+	models.BaseResponse
+	Report *models.InactivityReport `json:"report"`
+}
+
+// SetUserExemptRequest represents the request body for exempting a user from the inactivity policy
+type SetUserExemptRequest struct {
+	Exempt bool `json:"exempt"`
+}
+
+// GetInactivityReport reports which users the inactivity policy would warn or
+// revoke right now, without acting on it (admin only)
+func (h *V1) GetInactivityReport(c echo.Context) error {
+	report, err := jobs.InactivityReport(c.Request().Context(), h.services.Plex, h.services.Stripe, time.Now())
+	if err != nil {
+		slog.Error("Failed to evaluate inactivity policy", "error", err)
+		return plexHTTPError(err, "Failed to evaluate inactivity policy")
+	}
+
+	return c.JSON(http.StatusOK, GetInactivityReportResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Inactivity report generated successfully",
+		},
+		Report: report,
+	})
+}
+
+// showInactivityWarning returns the user's inactivity warning, or nil when
+// they have none, and records that it was shown to them. The first time, the
+// revoke date is pushed back to give them at least minInactivityNotice.
+func showInactivityWarning(ctx context.Context, userID int, now time.Time) *models.InactivityWarning {
+	user, err := db.DB.GetPlexUser(ctx, userID)
+	if err != nil {
+		slog.Error("Failed to get user", "error", err, "user_id", userID)
+		return nil
+	}
+	if user == nil || user.InactivityWarnedAt == nil {
+		return nil
+	}
+
+	warning := &models.InactivityWarning{WarnedAt: *user.InactivityWarnedAt, RevokeAt: user.InactivityRevokeAt}
+	if user.InactivityWarningSeenAt != nil {
+		return warning
+	}
+	if warning.RevokeAt != nil && warning.RevokeAt.Before(now.Add(minInactivityNotice)) {
+		revokeAt := now.Add(minInactivityNotice)
+		warning.RevokeAt = &revokeAt
+	}
+	// Until it is recorded as seen, the user isn't revoked
+	if err := db.DB.SetInactivityWarningSeen(ctx, userID, now, warning.RevokeAt); err != nil {
+		slog.Error("Failed to record inactivity warning as seen", "error", err, "user_id", userID)
+	}
+	return warning
+}
+
+// SetUserExempt exempts a user from the inactivity policy, or removes the exemption (admin only)
+func (h *V1) SetUserExempt(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	var req SetUserExemptRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	user, err := db.DB.GetPlexUser(c.Request().Context(), id)
+	if err != nil || user == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+	if err := db.DB.SetUserExempt(c.Request().Context(), id, req.Exempt); err != nil {
+		slog.Error("Failed to update user exemption", "error", err, "user_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update user exemption")
+	}
+
+	return c.JSON(http.StatusOK, models.BaseResponse{
+		Status:  "success",
+		Message: "User exemption updated successfully",
+	})
+}
@@ -0,0 +1,195 @@
+package v1controller
+
+import (
+	"log/slog"
+	"net/http"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services/plex"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetPendingInvitesResponse represents the response for listing pending Plex invites
+type GetPendingInvitesResponse struct {
+	models.BaseResponse
+	Invites []models.PlexInvite `json:"invites"`
+}
+
+// ResendInviteRequest represents the request body for resending a Plex invite
+type ResendInviteRequest struct {
+	SharingSettings *models.SharingSettings `json:"sharing_settings"`
+}
+
+// GetPendingInvites returns all Plex invites that haven't been accepted yet (admin only)
+func (h *V1) GetPendingInvites(c echo.Context) error {
+	invites, err := db.DB.GetPendingPlexInvites(c.Request().Context())
+	if err != nil {
+		slog.Error("Failed to get pending Plex invites", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch pending invites")
+	}
+	for i := range invites {
+		if server, ok := config.C.Plex.Server(invites[i].MachineIdentifier); ok {
+			invites[i].Server = server.Name
+		}
+	}
+
+	return c.JSON(http.StatusOK, GetPendingInvitesResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Pending invites retrieved successfully",
+		},
+		Invites: invites,
+	})
+}
+
+// ResendInvite shares the server again with the libraries, settings and
+// sharing profile of a pending invite, so plex.tv sends the user a new invite
+// email, and then cancels the original invite (admin only). Invites recorded
+// without their libraries and settings are resent with the user's plan.
+func (h *V1) ResendInvite(c echo.Context) error {
+	var req ResendInviteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.SharingSettings != nil {
+		if err := req.SharingSettings.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	share, server, err := pendingInvite(c)
+	if err != nil {
+		return err
+	}
+	user, err := db.DB.GetPlexUser(c.Request().Context(), share.UserID)
+	if err != nil || user == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+	if user.Email == "" && !user.IsManaged {
+		return echo.NewHTTPError(http.StatusBadRequest, "User has no email address")
+	}
+
+	libraries, settings := share.Libraries, share.SharingSettings
+	if settings == nil {
+		plan, ok := config.C.PlanForUser(user.EntitlementName)
+		if !ok {
+			slog.Error("User has an unknown plan", "user_id", user.ID, "entitlement", user.EntitlementName)
+			return echo.NewHTTPError(http.StatusInternalServerError, "User's plan is not configured")
+		}
+		resolved, err := sharingSettings(plan, nil, share.SharingProfile)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		libraries, settings = plan.Libraries, &resolved
+	}
+	if req.SharingSettings != nil {
+		resolved, err := sharingSettings(config.PlanConfig{}, req.SharingSettings, share.SharingProfile)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		settings = &resolved
+	}
+
+	invite, err := h.shareServer(c.Request().Context(), server, user, libraries, *settings, share.SharingProfile)
+	if err != nil {
+		slog.Error("Failed to resend Plex invite", "error", err, "user_id", share.UserID, "server", server.Name)
+		return plexHTTPError(err, "Failed to resend Plex invite, the original invite is still pending")
+	}
+
+	// The original invite is only cancelled once the new one is sent, so a
+	// failed resend leaves the user with it. The new invite replaced its record.
+	if strconv.Itoa(invite.ID) != share.SharedServerID {
+		if err := h.services.Plex.CancelShare(c.Request().Context(), server.MachineIdentifier, share.SharedServerID); err != nil {
+			slog.Error("Failed to cancel resent Plex invite", "error", err, "user_id", share.UserID, "invite_id", share.SharedServerID)
+			return c.JSON(http.StatusOK, models.BaseResponse{
+				Status:  "success",
+				Message: "invite resent, but the original invite couldn't be cancelled",
+			})
+		}
+	}
+
+	return c.JSON(http.StatusOK, models.BaseResponse{
+		Status:  "success",
+		Message: "invite resent successfully",
+	})
+}
+
+// AcceptPendingInvite accepts a pending invite on the user's behalf with their
+// stored Plex token (admin only)
+func (h *V1) AcceptPendingInvite(c echo.Context) error {
+	share, _, err := pendingInvite(c)
+	if err != nil {
+		return err
+	}
+	token, err := db.DB.GetPlexToken(c.Request().Context(), share.UserID)
+	if err != nil || token.Status() != models.TokenStatusValid {
+		return echo.NewHTTPError(http.StatusConflict, "No valid Plex token stored for user, they need to log in again")
+	}
+	inviteID, err := strconv.Atoi(share.SharedServerID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid invite ID")
+	}
+
+	if err := h.services.Plex.AcceptInvite(c.Request().Context(), token.AccessToken, inviteID); err != nil {
+		if plex.IsUnauthorized(err) {
+			invalidateToken(c.Request().Context(), share.UserID)
+			return echo.NewHTTPError(http.StatusConflict, "Stored Plex token was rejected, the user needs to log in again")
+		}
+		slog.Error("Failed to accept Plex invite", "error", err, "user_id", share.UserID, "invite_id", inviteID)
+		return plexHTTPError(err, "Failed to accept Plex invite")
+	}
+	share.Pending = false
+	if err := db.DB.SavePlexShare(c.Request().Context(), *share); err != nil {
+		slog.Error("Failed to record Plex share", "error", err, "user_id", share.UserID, "invite_id", inviteID)
+	}
+
+	return c.JSON(http.StatusOK, models.BaseResponse{
+		Status:  "success",
+		Message: "invite accepted successfully",
+	})
+}
+
+// CancelInvite cancels a pending invite (admin only)
+func (h *V1) CancelInvite(c echo.Context) error {
+	share, server, err := pendingInvite(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.services.Plex.CancelShare(c.Request().Context(), server.MachineIdentifier, share.SharedServerID); err != nil {
+		slog.Error("Failed to cancel Plex invite", "error", err, "user_id", share.UserID, "invite_id", share.SharedServerID)
+		return plexHTTPError(err, "Failed to cancel Plex invite")
+	}
+	if err := db.DB.DeletePlexShare(c.Request().Context(), share.UserID, server.MachineIdentifier); err != nil {
+		slog.Error("Failed to delete Plex share", "error", err, "user_id", share.UserID, "server", server.Name)
+	}
+
+	return c.JSON(http.StatusOK, models.BaseResponse{
+		Status:  "success",
+		Message: "invite cancelled successfully",
+	})
+}
+
+// pendingInvite looks up the pending share given by the id path parameter,
+// which is the Plex shared server ID of the invite
+func pendingInvite(c echo.Context) (*models.PlexShare, config.PlexServerConfig, error) {
+	share, err := db.DB.GetPlexShareBySharedServerID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		slog.Error("Failed to get Plex share", "error", err, "invite_id", c.Param("id"))
+		return nil, config.PlexServerConfig{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch invite")
+	}
+	if share == nil {
+		return nil, config.PlexServerConfig{}, echo.NewHTTPError(http.StatusNotFound, "Invite not found")
+	}
+	if !share.Pending {
+		return nil, config.PlexServerConfig{}, echo.NewHTTPError(http.StatusConflict, "Invite has already been accepted")
+	}
+	server, ok := config.C.Plex.Server(share.MachineIdentifier)
+	if !ok {
+		return nil, config.PlexServerConfig{}, echo.NewHTTPError(http.StatusNotFound, "Invite is for an unknown server")
+	}
+	return share, server, nil
+}
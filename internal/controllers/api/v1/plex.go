@@ -2,6 +2,7 @@ package v1controller
 
 import (
 	"database/sql"
+	"errors"
 	"log/slog"
 	"net/http"
 	"plefi/internal/config"
@@ -9,15 +10,29 @@ import (
 	"plefi/internal/models"
 	"plefi/internal/services/plex"
 	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-// CheckServerAccess checks if the authenticated user has access to the Plex server
+// plexHTTPError maps an error returned by the Plex service to an HTTP error,
+// reporting Plex outages and rate limiting as 503 rather than a generic 500.
+func plexHTTPError(err error, message string) *echo.HTTPError {
+	switch {
+	case errors.Is(err, plex.ErrCircuitOpen):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Plex is currently unavailable, try again later")
+	case plex.IsRateLimited(err):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Plex rate limit reached, try again later")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, message)
+	}
+}
+
+// GetServerAccess checks if the authenticated user has access to the Plex server
 func (h *V1) GetServerAccess(c echo.Context, user *models.UserInfo) error {
-	// Check if the user has access to the server
-	hasAccess, err := h.services.Plex.UserHasServerAccess(c.Request().Context(), user.ID)
+	// Check which servers the user has access to
+	access, err := serverAccess(c.Request().Context(), user.ID)
 	if err != nil {
 		slog.Error("Failed to check server access",
 			"error", err,
@@ -29,7 +44,8 @@ func (h *V1) GetServerAccess(c echo.Context, user *models.UserInfo) error {
 		BaseResponse: models.BaseResponse{
 			Status: "success",
 		},
-		HasAccess: hasAccess || user.ID == config.C.Plex.AdminUserID,
+		HasAccess: anyServerAccess(access),
+		Servers:   access,
 	})
 	return nil
 }
@@ -44,8 +60,8 @@ func (h *V1) CheckServerAccess(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid user ID")
 	}
-	// Check if the user has access to the server
-	hasAccess, err := h.services.Plex.UserHasServerAccess(c.Request().Context(), id)
+	// Check which servers the user has access to
+	access, err := serverAccess(c.Request().Context(), id)
 	if err != nil {
 		slog.Error("Failed to check server access",
 			"error", err,
@@ -57,7 +73,8 @@ func (h *V1) CheckServerAccess(c echo.Context) error {
 		BaseResponse: models.BaseResponse{
 			Status: "success",
 		},
-		HasAccess: hasAccess || id == config.C.Plex.AdminUserID,
+		HasAccess: anyServerAccess(access),
+		Servers:   access,
 	})
 	return nil
 }
@@ -71,7 +88,8 @@ type GetPlexUsersResponse struct {
 // GetPlexUserResponse represents the response for getting a single Plex user
 type GetPlexUserResponse struct {
 	models.BaseResponse
-	User models.PlexUser `json:"user"`
+	User        models.PlexUser `json:"user"`
+	TokenStatus string          `json:"token_status"` // Status of the user's stored Plex token
 }
 
 // GetPlexUserInvitesResponse represents the response for getting a user's invites
@@ -92,7 +110,41 @@ type GrantAccessResponse struct {
 
 // GrantPlexAccessRequest represents the request body for granting Plex access
 type GrantPlexAccessRequest struct {
-	UserID string `json:"user_id"`
+	UserID          string                  `json:"user_id"`
+	SharingSettings *models.SharingSettings `json:"sharing_settings"`
+	// SharingProfile is the name of a sharing profile restricting the content shared
+	SharingProfile string `json:"sharing_profile"`
+	// Servers are the names of the servers to share, all servers of the default plan when empty
+	Servers []string `json:"servers"`
+}
+
+// UpdatePlexAccessRequest represents the request body for updating a user's existing shares
+type UpdatePlexAccessRequest struct {
+	// Servers are the names of the servers to update, all shared servers when empty
+	Servers []string `json:"servers"`
+	// Libraries are the library names to share, the server's configured libraries when empty
+	Libraries       []string                `json:"libraries"`
+	SharingSettings *models.SharingSettings `json:"sharing_settings"`
+	// SharingProfile is the name of a sharing profile restricting the content shared
+	SharingProfile string `json:"sharing_profile"`
+}
+
+// CreateManagedUserRequest represents the request body for creating a managed Plex Home user
+type CreateManagedUserRequest struct {
+	Name string `json:"name"`
+	// RestrictionProfile is the Plex Home restriction profile, unrestricted when empty
+	RestrictionProfile string                  `json:"restriction_profile"`
+	SharingSettings    *models.SharingSettings `json:"sharing_settings"`
+	// SharingProfile is the name of a sharing profile restricting the content shared
+	SharingProfile string `json:"sharing_profile"`
+	// Servers are the names of the servers to share, all servers of the default plan when empty
+	Servers []string `json:"servers"`
+}
+
+// CreateManagedUserResponse represents the response for creating a managed Plex Home user
+type CreateManagedUserResponse struct {
+	models.BaseResponse
+	User models.PlexUser `json:"user"`
 }
 
 // ImportPlexUsersRequest represents the request body for importing Plex users
@@ -109,22 +161,34 @@ func (h *V1) GetPlexUsers(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch users")
 	}
 
-	plexUsers, err := h.services.Plex.GetUsers(c.Request().Context())
+	shares, err := db.DB.GetAllPlexShares(c.Request().Context())
 	if err != nil {
-		slog.Error("Failed to get Plex users from API", "error", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch users from Plex API")
+		slog.Error("Failed to get Plex shares", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user access")
 	}
-	//Create map for fast lookup
-	plexUserMap := make(map[int]plex.PlexUser)
-	for _, plexUser := range plexUsers {
-		plexUserMap[plexUser.ID] = plexUser
+	// Group shares by user for fast lookup
+	userShares := make(map[int][]models.PlexShare)
+	for _, share := range shares {
+		userShares[share.UserID] = append(userShares[share.UserID], share)
+	}
+	tokens, err := db.DB.GetAllPlexTokens(c.Request().Context())
+	if err != nil {
+		slog.Error("Failed to get Plex tokens", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user tokens")
+	}
+	userTokens := make(map[int]*models.PlexToken, len(tokens))
+	for i := range tokens {
+		userTokens[tokens[i].UserID] = &tokens[i]
 	}
 
 	plexUsersWithAccess := make([]models.PlexUserWithAccess, len(users))
 	for i, user := range users {
+		access := serverAccessFromShares(user.ID, userShares[user.ID])
 		plexUsersWithAccess[i] = models.PlexUserWithAccess{
-			PlexUser:  user,
-			HasAccess: h.services.Plex.CheckUserHasAccess(plexUserMap, user.ID),
+			PlexUser:    user,
+			HasAccess:   anyServerAccess(access),
+			Servers:     access,
+			TokenStatus: userTokens[user.ID].Status(),
 		}
 	}
 
@@ -159,13 +223,19 @@ func (h *V1) GetPlexUser(c echo.Context) error {
 	if user == nil {
 		return echo.NewHTTPError(http.StatusNotFound, "User not found")
 	}
+	token, err := db.DB.GetPlexToken(c.Request().Context(), id)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Failed to get Plex token", "error", err, "user_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user token")
+	}
 
 	return c.JSON(http.StatusOK, GetPlexUserResponse{
 		BaseResponse: models.BaseResponse{
 			Status:  "success",
 			Message: "User retrieved successfully",
 		},
-		User: *user,
+		User:        *user,
+		TokenStatus: token.Status(),
 	})
 }
 
@@ -200,7 +270,8 @@ func (h *V1) GetPlexUserInvites(c echo.Context) error {
 	})
 }
 
-// RevokePlexAccess revokes a user's access to the Plex server (admin only)
+// RevokePlexAccess revokes a user's access to the Plex servers given by the
+// server query parameter, or to all servers when omitted (admin only)
 func (h *V1) RevokePlexAccess(c echo.Context) error {
 	// Get user ID from path parameter
 	idStr := c.Param("id")
@@ -220,10 +291,15 @@ func (h *V1) RevokePlexAccess(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "Cannot revoke access for admin users")
 	}
 
+	servers, err := serversByName(c.QueryParams()["server"], config.C.Plex.Servers)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
 	// Revoke access in Plex
-	if err := h.services.Plex.UnshareLibrary(c.Request().Context(), id); err != nil {
+	if err := h.unshareServers(c.Request().Context(), servers, id); err != nil {
 		slog.Error("Failed to revoke Plex access", "error", err, "user_id", id)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke Plex access")
+		return plexHTTPError(err, "Failed to revoke Plex access")
 	}
 
 	return c.JSON(http.StatusOK, RevokeAccessResponse{
@@ -246,6 +322,11 @@ func (h *V1) GrantPlexAccess(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
+	if req.SharingSettings != nil {
+		if err := req.SharingSettings.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
 
 	// Check if user exists
 	user, err := db.DB.GetPlexUser(c.Request().Context(), id)
@@ -253,46 +334,215 @@ func (h *V1) GrantPlexAccess(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, "User not found")
 	}
 
-	// Check if user already has access
-	hasAccess, err := h.services.Plex.UserHasServerAccess(c.Request().Context(), id)
+	plan := planFor(config.C.Stripe.EntitlementName)
+	servers, err := serversByName(req.Servers, config.C.ServersForPlan(plan))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	settings, err := sharingSettings(plan, req.SharingSettings, req.SharingProfile)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Check which servers the user already has access to
+	access, err := serverAccess(c.Request().Context(), id)
 	if err != nil {
 		slog.Error("Failed to check server access", "error", err, "user_id", id)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check server access")
 	}
+	shared := sharedServers(access)
 
-	if hasAccess {
-		return echo.NewHTTPError(http.StatusBadRequest, "User already has access")
+	// User needs an email to grant access, unless they're a managed user
+	if user.Email == "" && !user.IsManaged {
+		return echo.NewHTTPError(http.StatusBadRequest, "User has no email address")
 	}
 
-	// User needs an email to grant access
-	if user.Email == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "User has no email address")
+	// Share each server the user doesn't have access to or an invite for yet
+	granted := 0
+	for _, server := range servers {
+		if shared[server.MachineIdentifier] {
+			continue
+		}
+		if _, err := h.shareServer(c.Request().Context(), server, user, plan.Libraries, settings, req.SharingProfile); err != nil {
+			slog.Error("Failed to share Plex library with user", "error", err, "user_id", id, "email", user.Email, "server", server.Name)
+			return plexHTTPError(err, "Failed to grant Plex access")
+		}
+		granted++
+	}
+
+	if granted == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "User already has access or a pending invite")
 	}
 
-	// Share Plex library with the user
-	invite, err := h.services.Plex.ShareLibrary(c.Request().Context(), user.Email)
+	return c.JSON(http.StatusOK, GrantAccessResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "access granted successfully",
+		},
+	})
+}
+
+// UpdatePlexAccess changes the libraries and sharing settings of a user's
+// existing shares without sending a new invite (admin only). Settings default
+// to the user's plan and each share keeps its sharing profile unless one is given.
+func (h *V1) UpdatePlexAccess(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		slog.Error("Failed to share Plex library with user", "error", err, "user_id", id, "email", user.Email)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to grant Plex access")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	// Try to auto-accept the invitation if we have the user's Plex token
-	token, tokenErr := db.DB.GetPlexToken(c.Request().Context(), id)
-	if tokenErr == nil && token != nil && token.AccessToken != "" {
-		if acceptErr := h.services.Plex.AcceptInvite(c.Request().Context(), token.AccessToken, invite.ID); acceptErr != nil {
-			slog.Error("Failed to auto-accept invite", "error", acceptErr, "invite_id", invite.ID)
-			// Continue despite error as the invite was sent successfully
-		} else {
-			slog.Info("Auto-accepted invite for user", "user_id", id, "invite_id", invite.ID)
+	var req UpdatePlexAccessRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.SharingSettings != nil {
+		if err := req.SharingSettings.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	user, err := db.DB.GetPlexUser(c.Request().Context(), id)
+	if err != nil || user == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+	if user.IsAdmin {
+		return echo.NewHTTPError(http.StatusForbidden, "Cannot update access for admin users")
+	}
+
+	servers, err := serversByName(req.Servers, config.C.Plex.Servers)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	plan, ok := config.C.PlanForUser(user.EntitlementName)
+	if !ok {
+		slog.Error("User has an unknown plan", "user_id", user.ID, "entitlement", user.EntitlementName)
+		return echo.NewHTTPError(http.StatusInternalServerError, "User's plan is not configured")
+	}
+	requested, err := sharingSettings(plan, req.SharingSettings, req.SharingProfile)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	shares, err := db.DB.GetPlexShares(c.Request().Context(), id)
+	if err != nil {
+		slog.Error("Failed to check server access", "error", err, "user_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check server access")
+	}
+	stored := make(map[string]models.PlexShare, len(shares))
+	for _, share := range shares {
+		stored[share.MachineIdentifier] = share
+	}
+	shared := sharedServers(serverAccessFromShares(id, shares))
+
+	updated := 0
+	for _, server := range servers {
+		if !shared[server.MachineIdentifier] {
+			if len(req.Servers) == 0 {
+				continue
+			}
+			return echo.NewHTTPError(http.StatusNotFound, "User has no access to server "+server.Name)
+		}
+
+		// Without a profile in the request, the share keeps the one it was made with
+		settings, profile := requested, req.SharingProfile
+		if profile == "" && stored[server.MachineIdentifier].SharingProfile != "" {
+			profile = stored[server.MachineIdentifier].SharingProfile
+			if settings, err = sharingSettings(plan, req.SharingSettings, profile); err != nil {
+				slog.Error("Share has an unknown sharing profile", "error", err, "user_id", id, "server", server.Name)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Sharing profile of the share on "+server.Name+" is not configured")
+			}
+		}
+
+		share, err := h.services.Plex.UpdateShare(c.Request().Context(), server.MachineIdentifier, id, req.Libraries, settings)
+		var unknownErr *plex.UnknownLibrariesError
+		switch {
+		case errors.As(err, &unknownErr):
+			return echo.NewHTTPError(http.StatusBadRequest, unknownErr.Error())
+		case errors.Is(err, plex.ErrNotShared):
+			return echo.NewHTTPError(http.StatusNotFound, "User has no access to server "+server.Name)
+		case err != nil:
+			slog.Error("Failed to update Plex share", "error", err, "user_id", id, "server", server.Name)
+			return plexHTTPError(err, "Failed to update Plex access")
 		}
+		// The update response doesn't always identify the invited user
+		share.InvitedID, share.MachineIdentifier = id, server.MachineIdentifier
+		recordShare(c.Request().Context(), share, !stored[server.MachineIdentifier].Pending, req.Libraries, settings, profile)
+		updated++
+		slog.Info("Updated Plex share", "user_id", id, "server", server.Name, "libraries", share.NumLibraries)
+	}
+
+	if updated == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "User has no access to update")
 	}
 
-	slog.Info("Plex library shared with user", "user_id", id, "email", user.Email, "invite_id", invite.ID)
 	return c.JSON(http.StatusOK, GrantAccessResponse{
 		BaseResponse: models.BaseResponse{
 			Status:  "success",
-			Message: "access granted successfully",
+			Message: "access updated successfully",
+		},
+	})
+}
+
+// CreateManagedPlexUser creates a managed user in the server owner's Plex Home
+// and shares the plan's servers with it (admin only)
+func (h *V1) CreateManagedPlexUser(c echo.Context) error {
+	var req CreateManagedUserRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+	if !models.ValidRestrictionProfile(req.RestrictionProfile) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid restriction profile")
+	}
+	if req.SharingSettings != nil {
+		if err := req.SharingSettings.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	plan := planFor(config.C.Stripe.EntitlementName)
+	servers, err := serversByName(req.Servers, config.C.ServersForPlan(plan))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	settings, err := sharingSettings(plan, req.SharingSettings, req.SharingProfile)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	homeUser, err := h.services.Plex.CreateManagedUser(c.Request().Context(), req.Name, req.RestrictionProfile)
+	if err != nil {
+		slog.Error("Failed to create managed Plex user", "error", err, "name", req.Name)
+		return plexHTTPError(err, "Failed to create managed user")
+	}
+
+	user := models.PlexUser{
+		ID:                 homeUser.ID,
+		UUID:               homeUser.UUID,
+		Username:           req.Name,
+		IsManaged:          true,
+		RestrictionProfile: req.RestrictionProfile,
+	}
+	if err := db.DB.SavePlexUser(c.Request().Context(), user); err != nil {
+		slog.Error("Failed to save managed Plex user", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save managed user")
+	}
+
+	for _, server := range servers {
+		if _, err := h.shareServer(c.Request().Context(), server, &user, plan.Libraries, settings, req.SharingProfile); err != nil {
+			slog.Error("Failed to share Plex library with managed user", "error", err, "user_id", user.ID, "server", server.Name)
+			return plexHTTPError(err, "Failed to share libraries with managed user")
+		}
+	}
+
+	return c.JSON(http.StatusOK, CreateManagedUserResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "managed user created successfully",
 		},
+		User: user,
 	})
 }
 
@@ -307,11 +557,11 @@ func (h *V1) DeletePlexUser(c echo.Context, user *models.UserInfo) error {
 		return echo.NewHTTPError(http.StatusForbidden, "cannot delete admin users")
 	}
 
-	if err := h.services.Plex.UnshareLibrary(c.Request().Context(), id); err != nil {
+	if err := h.unshareServers(c.Request().Context(), config.C.Plex.Servers, id); err != nil {
 		slog.Error("Failed to unshare Plex library with user",
 			"error", err,
 			"user_id", user.ID)
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unshare Plex library")
+		return plexHTTPError(err, "failed to unshare Plex library")
 	}
 
 	// Delete the user from the database
@@ -328,6 +578,16 @@ func (h *V1) DeletePlexUser(c echo.Context, user *models.UserInfo) error {
 	})
 }
 
+// hasAnyServer reports whether a Plex user has been shared any configured server
+func (h *V1) hasAnyServer(users map[int]plex.PlexUser, userID int) bool {
+	for _, server := range config.C.Plex.Servers {
+		if h.services.Plex.CheckUserHasAccess(users, server.MachineIdentifier, userID) {
+			return true
+		}
+	}
+	return false
+}
+
 // ImportPlexUsers imports Plex users into the database (admin only)
 func (h *V1) ImportPlexUsers(c echo.Context) error {
 	var req ImportPlexUsersRequest
@@ -339,7 +599,7 @@ func (h *V1) ImportPlexUsers(c echo.Context) error {
 	plexUsers, err := h.services.Plex.GetUsers(c.Request().Context())
 	if err != nil {
 		slog.Error("Failed to fetch Plex users from API", "error", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch users from Plex API")
+		return plexHTTPError(err, "Failed to fetch users from Plex API")
 	}
 	userMap := make(map[int]plex.PlexUser)
 	for _, plexUser := range plexUsers {
@@ -348,12 +608,18 @@ func (h *V1) ImportPlexUsers(c echo.Context) error {
 
 	// Iterate over Plex users and insert them into the database
 	for _, plexUser := range plexUsers {
-		if !req.ImportAll && !h.services.Plex.CheckUserHasAccess(userMap, plexUser.ID) {
+		if !req.ImportAll && !h.hasAnyServer(userMap, plexUser.ID) {
 			continue // Skip users without library access if ImportAll is false
 		}
 
-		// Check if user already exists in the database
-		existingUser, err := db.DB.GetPlexUserByEmail(c.Request().Context(), plexUser.Email)
+		// Check if user already exists in the database, managed users have no email
+		managed := plexUser.Home == 1 && plexUser.Email == ""
+		var existingUser *models.PlexUser
+		if managed {
+			existingUser, err = db.DB.GetPlexUser(c.Request().Context(), plexUser.ID)
+		} else {
+			existingUser, err = db.DB.GetPlexUserByEmail(c.Request().Context(), plexUser.Email)
+		}
 		if err != nil && err != sql.ErrNoRows {
 			slog.Error("Failed to check existing user", "error", err, "email", plexUser.Email)
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check existing user")
@@ -362,11 +628,12 @@ func (h *V1) ImportPlexUsers(c echo.Context) error {
 		// If user does not exist, insert into the database
 		if existingUser == nil {
 			newUser := models.PlexUser{
-				ID:       plexUser.ID,
-				Email:    plexUser.Email,
-				Username: plexUser.Username,
-				IsAdmin:  plexUser.ID == config.C.Plex.AdminUserID,
-				UUID:     uuid.NewString(),
+				ID:        plexUser.ID,
+				Email:     plexUser.Email,
+				Username:  plexUser.Username,
+				IsAdmin:   plexUser.ID == config.C.Plex.AdminUserID,
+				IsManaged: managed,
+				UUID:      uuid.NewString(),
 			}
 			if err := db.DB.SavePlexUser(c.Request().Context(), newUser); err != nil {
 				slog.Error("Failed to insert Plex user", "error", err, "email", plexUser.Email)
@@ -380,3 +647,44 @@ func (h *V1) ImportPlexUsers(c echo.Context) error {
 		Message: "Plex users imported successfully",
 	})
 }
+
+// GetPlexLibrariesResponse represents the response for listing the server's libraries
+type GetPlexLibrariesResponse struct {
+	models.BaseResponse
+	Libraries []models.PlexLibrary `json:"libraries"`
+}
+
+// GetPlexLibraries returns all library sections on the managed Plex servers (admin only)
+func (h *V1) GetPlexLibraries(c echo.Context) error {
+	var libraries []models.PlexLibrary
+	for _, server := range config.C.Plex.Servers {
+		sections, err := h.services.Plex.GetLibrarySections(c.Request().Context(), server.MachineIdentifier)
+		if err != nil {
+			slog.Error("Failed to get Plex libraries", "error", err, "server", server.Name)
+			return plexHTTPError(err, "Failed to fetch libraries")
+		}
+
+		shared := make(map[string]bool, len(server.SharedLibraries))
+		for _, name := range server.SharedLibraries {
+			shared[strings.ToLower(name)] = true
+		}
+		for _, section := range sections {
+			libraries = append(libraries, models.PlexLibrary{
+				ID:     section.ID,
+				Key:    section.Key,
+				Title:  section.Title,
+				Type:   section.Type,
+				Shared: shared[strings.ToLower(section.Title)],
+				Server: server.Name,
+			})
+		}
+	}
+
+	return c.JSON(http.StatusOK, GetPlexLibrariesResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Libraries retrieved successfully",
+		},
+		Libraries: libraries,
+	})
+}
@@ -0,0 +1,159 @@
+package v1controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services"
+	"plefi/internal/utils"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// referralCodeLength is the length of generated referral codes
+const referralCodeLength = 8
+
+// GetReferralsResponse represents the response for the user's referrals
+type GetReferralsResponse struct {
+	models.BaseResponse
+	Referral models.ReferralSummary `json:"referral"`
+}
+
+// GetReferrals returns the user's referral code and link, how many users
+// signed up with it and the rewards they earned
+func (h *V1) GetReferrals(c echo.Context, user *models.UserInfo) error {
+	if !config.C.Referrals.Enabled() {
+		return echo.NewHTTPError(http.StatusNotFound, "Referrals are not enabled")
+	}
+
+	code, err := db.DB.GetReferralCode(c.Request().Context(), user.ID, func() (string, error) {
+		return generateCode("", defaultCodeAlphabet, referralCodeLength)
+	})
+	if err != nil {
+		slog.Error("Failed to get referral code", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get referral code")
+	}
+	signups, err := db.DB.CountReferrals(c.Request().Context(), user.ID)
+	if err != nil {
+		slog.Error("Failed to count referrals", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get referrals")
+	}
+	rewards, err := db.DB.GetReferralRewards(c.Request().Context(), user.ID)
+	if err != nil {
+		slog.Error("Failed to get referral rewards", "error", err, "user_id", user.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get referrals")
+	}
+
+	return c.JSON(http.StatusOK, GetReferralsResponse{
+		BaseResponse: models.BaseResponse{
+			Status: "success",
+		},
+		Referral: models.ReferralSummary{
+			Code:    code,
+			Link:    fmt.Sprintf("https://%s%s/v1/referrals/join/%s", config.C.Server.Hostname, h.basePath, code),
+			Signups: signups,
+			Rewards: rewards,
+		},
+	})
+}
+
+// JoinReferral remembers the referral code of a link in the session, so the
+// visitor is attributed to the referrer when they sign in for the first
+// time, and sends them to the app
+func (h *V1) JoinReferral(c echo.Context) error {
+	code := strings.ToUpper(c.Param("code"))
+	referrer, err := db.DB.GetPlexUserByReferralCode(c.Request().Context(), code)
+	if err != nil {
+		slog.Error("Failed to get referrer", "error", err, "code", code)
+	} else if referrer != nil {
+		if err := utils.SaveSessionData(c, utils.ReferralState, code); err != nil {
+			slog.Error("Failed to save referral code to session", "error", err, "code", code)
+		}
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// rewardReferrer gives the referrer of a paying user the configured reward,
+// once per referred user. A coupon reward waits for the next paid invoice
+// while the referrer has no subscription to apply it to.
+func (h *V1) rewardReferrer(ctx context.Context, referredID int, invoiceID string) error {
+	user, err := db.DB.GetPlexUser(ctx, referredID)
+	if err != nil {
+		return fmt.Errorf("failed to get user %d: %w", referredID, err)
+	}
+	if user == nil || user.ReferredBy == nil {
+		return nil
+	}
+	existing, err := db.DB.GetReferralReward(ctx, referredID)
+	if err != nil {
+		return fmt.Errorf("failed to get referral reward of user %d: %w", referredID, err)
+	}
+	if existing != nil {
+		return nil
+	}
+	referrer, err := db.DB.GetPlexUser(ctx, *user.ReferredBy)
+	if err != nil {
+		return fmt.Errorf("failed to get referrer %d: %w", *user.ReferredBy, err)
+	}
+	if referrer == nil {
+		return nil
+	}
+
+	referrerInfo := &models.UserInfo{
+		ID:       referrer.ID,
+		UUID:     referrer.UUID,
+		Username: referrer.Username,
+		Email:    referrer.Email,
+	}
+	reward := models.ReferralReward{
+		ReferrerID: referrer.ID,
+		ReferredID: &referredID,
+		InvoiceID:  invoiceID,
+		RewardType: config.C.Referrals.RewardType,
+	}
+	// The key makes Stripe apply the reward once when the webhook is retried
+	idempotencyKey := fmt.Sprintf("referral-reward-%d", referredID)
+
+	switch reward.RewardType {
+	case config.ReferralRewardCredit:
+		customer, err := h.services.Stripe.GetOrCreateCustomer(ctx, referrerInfo)
+		if err != nil {
+			return fmt.Errorf("failed to get Stripe customer of referrer %d: %w", referrer.ID, err)
+		}
+		reward.Amount, reward.Currency = config.C.Referrals.CreditAmount, config.C.Referrals.Currency
+		description := "Referral reward for inviting " + user.Username
+		if err := h.services.Stripe.CreditCustomer(ctx, customer.ID, reward.Amount, reward.Currency, description, idempotencyKey); err != nil {
+			return fmt.Errorf("failed to credit referrer %d: %w", referrer.ID, err)
+		}
+	case config.ReferralRewardCoupon:
+		reward.CouponID = config.C.Referrals.CouponID
+		err := h.services.Stripe.ApplySubscriptionCoupon(ctx, referrerInfo, reward.CouponID, idempotencyKey)
+		if errors.Is(err, services.ErrNoActiveSubscription) {
+			slog.Info("Referrer has no subscription for the coupon, waiting for the next invoice",
+				"referrer_id", referrer.ID,
+				"referred_id", referredID)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply coupon for referrer %d: %w", referrer.ID, err)
+		}
+	default:
+		return nil
+	}
+
+	if err := db.DB.SaveReferralReward(ctx, reward); err != nil {
+		return fmt.Errorf("failed to record referral reward of user %d: %w", referredID, err)
+	}
+	slog.Info("Referral rewarded",
+		"referrer_id", referrer.ID,
+		"referred_id", referredID,
+		"invoice_id", invoiceID,
+		"reward_type", reward.RewardType)
+	return nil
+}
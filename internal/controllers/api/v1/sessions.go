@@ -0,0 +1,140 @@
+package v1controller
+
+import (
+	"log/slog"
+	"net/http"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/jobs"
+	"plefi/internal/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSessionHistoryLimit = 100
+	maxSessionHistoryLimit     = 1000
+)
+
+// GetPlexSessionsResponse represents the response for listing active Plex sessions
+type GetPlexSessionsResponse struct {
+	models.BaseResponse
+	Sessions []models.PlexSession `json:"sessions"`
+}
+
+// GetPlexSessionHistoryResponse represents the response for listing recorded Plex sessions
+type GetPlexSessionHistoryResponse struct {
+	models.BaseResponse
+	Sessions []models.PlexSessionHistory `json:"sessions"`
+}
+
+// GetStreamEnforcementsResponse represents the response for listing terminated streams
+type GetStreamEnforcementsResponse struct {
+	models.BaseResponse
+	Enforcements []models.StreamEnforcement `json:"enforcements"`
+}
+
+// GetPlexSessions returns the active playback sessions on every server (admin only)
+func (h *V1) GetPlexSessions(c echo.Context) error {
+	users, err := db.DB.GetAllPlexUsers(c.Request().Context())
+	if err != nil {
+		slog.Error("Failed to get Plex users", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch users")
+	}
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+
+	sessions := []models.PlexSession{}
+	for _, server := range config.C.Plex.Servers {
+		serverSessions, err := h.services.Plex.GetSessions(c.Request().Context(), server.MachineIdentifier)
+		if err != nil {
+			slog.Error("Failed to get Plex sessions", "error", err, "server", server.Name)
+			return plexHTTPError(err, "Failed to fetch sessions")
+		}
+		for _, session := range jobs.SessionsFromPlex(server, serverSessions) {
+			// Prefer the username we know the user by
+			if username, ok := usernames[session.UserID]; ok {
+				session.Username = username
+			}
+			sessions = append(sessions, session)
+		}
+	}
+
+	return c.JSON(http.StatusOK, GetPlexSessionsResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Sessions retrieved successfully",
+		},
+		Sessions: sessions,
+	})
+}
+
+// GetPlexSessionHistory returns the most recent recorded sessions, optionally
+// for a single user given by the user_id query parameter (admin only)
+func (h *V1) GetPlexSessionHistory(c echo.Context) error {
+	userID := 0
+	if value := c.QueryParam("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+		}
+		userID = id
+	}
+	limit, err := historyLimit(c)
+	if err != nil {
+		return err
+	}
+
+	history, err := db.DB.GetPlexSessionHistory(c.Request().Context(), userID, limit)
+	if err != nil {
+		slog.Error("Failed to get Plex session history", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch session history")
+	}
+
+	return c.JSON(http.StatusOK, GetPlexSessionHistoryResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Session history retrieved successfully",
+		},
+		Sessions: history,
+	})
+}
+
+// GetStreamEnforcements returns the most recent streams terminated for
+// exceeding a plan's concurrent stream limit (admin only)
+func (h *V1) GetStreamEnforcements(c echo.Context) error {
+	limit, err := historyLimit(c)
+	if err != nil {
+		return err
+	}
+
+	enforcements, err := db.DB.GetStreamEnforcements(c.Request().Context(), limit)
+	if err != nil {
+		slog.Error("Failed to get stream enforcements", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch stream enforcements")
+	}
+
+	return c.JSON(http.StatusOK, GetStreamEnforcementsResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Stream enforcements retrieved successfully",
+		},
+		Enforcements: enforcements,
+	})
+}
+
+// historyLimit parses the limit query parameter of the history endpoints
+func historyLimit(c echo.Context) (int, error) {
+	value := c.QueryParam("limit")
+	if value == "" {
+		return defaultSessionHistoryLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 || limit > maxSessionHistoryLimit {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+	}
+	return limit, nil
+}
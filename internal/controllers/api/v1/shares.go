@@ -0,0 +1,237 @@
+package v1controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services/plex"
+	"strconv"
+	"time"
+)
+
+// serverAccess returns a user's access to each configured server, using the
+// persisted plex_shares table rather than calling plex.tv.
+func serverAccess(ctx context.Context, userID int) ([]models.ServerAccess, error) {
+	shares, err := db.DB.GetPlexShares(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return serverAccessFromShares(userID, shares), nil
+}
+
+// serverAccessFromShares builds a user's per-server access from their shares.
+// A pending invite isn't access, the server is only marked as pending.
+func serverAccessFromShares(userID int, shares []models.PlexShare) []models.ServerAccess {
+	access := make([]models.ServerAccess, len(config.C.Plex.Servers))
+	for i, server := range config.C.Plex.Servers {
+		access[i] = models.ServerAccess{
+			Server:            server.Name,
+			MachineIdentifier: server.MachineIdentifier,
+			HasAccess:         userID == config.C.Plex.AdminUserID,
+		}
+		for _, share := range shares {
+			if share.UserID == userID && share.MachineIdentifier == server.MachineIdentifier {
+				access[i].HasAccess = !share.Pending
+				access[i].Pending = share.Pending
+			}
+		}
+	}
+	return access
+}
+
+// hasServerAccess reports whether a user has been shared any of our servers
+func hasServerAccess(ctx context.Context, userID int) (bool, error) {
+	access, err := serverAccess(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return anyServerAccess(access), nil
+}
+
+// sharedServers returns the machine identifiers of the servers shared with a
+// user, whether the invite was accepted or is still pending, which mustn't be
+// shared again
+func sharedServers(access []models.ServerAccess) map[string]bool {
+	shared := make(map[string]bool, len(access))
+	for _, server := range access {
+		shared[server.MachineIdentifier] = server.HasAccess || server.Pending
+	}
+	return shared
+}
+
+// anyServerAccess reports whether any of the given servers is shared
+func anyServerAccess(access []models.ServerAccess) bool {
+	for _, server := range access {
+		if server.HasAccess {
+			return true
+		}
+	}
+	return false
+}
+
+// serversByName resolves server names from a request, defaulting to the given servers
+func serversByName(names []string, defaults []config.PlexServerConfig) ([]config.PlexServerConfig, error) {
+	if len(names) == 0 {
+		return defaults, nil
+	}
+	servers := make([]config.PlexServerConfig, 0, len(names))
+	for _, name := range names {
+		server, ok := config.C.Plex.ServerByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown server %q", name)
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// planFor returns the plan granted by an entitlement, or a default plan sharing
+// every server with the most restrictive settings.
+func planFor(entitlementName string) config.PlanConfig {
+	if plan, ok := config.C.PlanForEntitlement(entitlementName); ok {
+		return plan
+	}
+	return config.PlanConfig{EntitlementName: entitlementName}
+}
+
+// sharingSettings returns the settings to share a plan with: the plan's own
+// settings or the given override, restricted by the named sharing profile.
+// The plan's sharing profile applies when neither is given.
+func sharingSettings(plan config.PlanConfig, override *models.SharingSettings, profileName string) (models.SharingSettings, error) {
+	settings := plan.Sharing
+	if override != nil {
+		settings = *override
+	} else if profileName == "" {
+		profileName = plan.SharingProfile
+	}
+	if profileName == "" {
+		return settings, nil
+	}
+	profile, ok := config.C.SharingProfile(profileName)
+	if !ok {
+		return settings, fmt.Errorf("unknown sharing profile %q", profileName)
+	}
+	return profile.Apply(settings), nil
+}
+
+// assignPlan records the plan a user was given access through, so that its
+// limits apply to them
+func assignPlan(ctx context.Context, userID int, plan config.PlanConfig) {
+	if err := db.DB.SetUserEntitlement(ctx, userID, plan.EntitlementName); err != nil {
+		slog.Error("Failed to record user plan", "error", err, "user_id", userID, "plan", plan.Name)
+	}
+}
+
+// recordShare persists a share created through the Plex API so that access
+// checks reflect it before the next background sync. The libraries, settings
+// and sharing profile it was made with are kept to share the server again alike.
+func recordShare(
+	ctx context.Context,
+	invite *plex.PlexShareResponse,
+	accepted bool,
+	libraries []string,
+	settings models.SharingSettings,
+	profile string,
+) {
+	now := time.Now()
+	if err := db.DB.SavePlexShare(ctx, models.PlexShare{
+		UserID:            invite.InvitedID,
+		MachineIdentifier: invite.MachineIdentifier,
+		SharedServerID:    strconv.Itoa(invite.ID),
+		NumLibraries:      invite.NumLibraries,
+		AllLibraries:      invite.AllLibraries,
+		Pending:           !(accepted || invite.Accepted),
+		InviteToken:       invite.InviteToken,
+		InvitedAt:         &now,
+		SharingProfile:    profile,
+		Libraries:         libraries,
+		SharingSettings:   &settings,
+	}); err != nil {
+		slog.Error("Failed to record Plex share", "error", err, "user_id", invite.InvitedID, "invite_id", invite.ID)
+	}
+}
+
+// shareServer shares the named libraries of a server, or its configured
+// shared libraries when none are given, with a user with the settings
+// resolved from the named sharing profile, and accepts the invite on their
+// behalf when we hold their Plex token. Failing to accept leaves the invite
+// pending and is not an error. Managed users are shared by ID and need no
+// invite to be accepted.
+func (h *V1) shareServer(
+	ctx context.Context,
+	server config.PlexServerConfig,
+	user *models.PlexUser,
+	libraries []string,
+	settings models.SharingSettings,
+	profile string,
+) (*plex.PlexShareResponse, error) {
+	if user.IsManaged {
+		share, err := h.services.Plex.ShareLibraryWithUser(ctx, server.MachineIdentifier, user.ID, libraries, settings)
+		if err != nil {
+			return nil, err
+		}
+		recordShare(ctx, share, true, libraries, settings, profile)
+		slog.Info("Plex library shared with managed user", "user_id", user.ID, "server", server.Name)
+		return share, nil
+	}
+
+	invite, err := h.services.Plex.ShareLibrary(ctx, server.MachineIdentifier, user.Email, libraries, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	recordShare(ctx, invite, h.acceptInvite(ctx, user.ID, invite.ID), libraries, settings, profile)
+
+	slog.Info("Plex library shared with user",
+		"user_id", user.ID,
+		"email", user.Email,
+		"server", server.Name,
+		"invite_id", invite.ID)
+	return invite, nil
+}
+
+// acceptInvite accepts an invite on the user's behalf with their stored Plex
+// token and reports whether it was accepted. Without a valid token, or when
+// accepting fails, the invite is left pending for the user to accept. A token
+// Plex rejects is marked invalid.
+func (h *V1) acceptInvite(ctx context.Context, userID, inviteID int) bool {
+	token, err := db.DB.GetPlexToken(ctx, userID)
+	if err != nil || token.Status() != models.TokenStatusValid {
+		slog.Info("No valid Plex token for user, leaving invite pending", "user_id", userID, "invite_id", inviteID)
+		return false
+	}
+	if err := h.services.Plex.AcceptInvite(ctx, token.AccessToken, inviteID); err != nil {
+		if plex.IsUnauthorized(err) {
+			invalidateToken(ctx, userID)
+		}
+		slog.Error("Failed to auto-accept Plex invite, leaving it pending", "error", err, "user_id", userID, "invite_id", inviteID)
+		return false
+	}
+	slog.Info("Plex invite auto-accepted", "user_id", userID, "invite_id", inviteID)
+	return true
+}
+
+// invalidateToken marks a user's stored token as rejected by Plex
+func invalidateToken(ctx context.Context, userID int) {
+	slog.Warn("Stored Plex token was rejected, marking it invalid", "user_id", userID)
+	if err := db.DB.SetPlexTokenValid(ctx, userID, false); err != nil {
+		slog.Error("Failed to mark Plex token invalid", "error", err, "user_id", userID)
+	}
+}
+
+// unshareServers removes a user's access to the given servers and forgets the
+// persisted shares.
+func (h *V1) unshareServers(ctx context.Context, servers []config.PlexServerConfig, userID int) error {
+	for _, server := range servers {
+		if err := h.services.Plex.UnshareLibrary(ctx, server.MachineIdentifier, userID); err != nil {
+			return fmt.Errorf("server %s: %w", server.Name, err)
+		}
+		if err := db.DB.DeletePlexShare(ctx, userID, server.MachineIdentifier); err != nil {
+			slog.Error("Failed to delete Plex share", "error", err, "user_id", userID, "server", server.Name)
+		}
+	}
+	return nil
+}
@@ -8,7 +8,6 @@ import (
 	"log/slog"
 	"net/http"
 	"plefi/internal/config"
-	"plefi/internal/db"
 	"plefi/internal/models"
 	"strconv"
 
@@ -132,6 +131,10 @@ func (h *V1) CancelUserSubscription(c echo.Context, user *models.UserInfo) error
 
 // processWebhookEvent handles different types of Stripe webhook events
 func (s *V1) processWebhookEvent(ctx context.Context, event stripe.Event) error {
+	if event.Type == "invoice.paid" {
+		return s.handleInvoicePaid(ctx, event)
+	}
+
 	// Only process entitlements.active_entitlement_summary.updated events
 	if event.Type != "entitlements.active_entitlement_summary.updated" {
 		slog.Info("Ignoring non-entitlements webhook event", "type", event.Type)
@@ -170,6 +173,32 @@ func (s *V1) processWebhookEvent(ctx context.Context, event stripe.Event) error
 	return nil
 }
 
+// handleInvoicePaid rewards the referrer of the customer paying the invoice
+func (s *V1) handleInvoicePaid(ctx context.Context, event stripe.Event) error {
+	if !config.C.Referrals.Enabled() {
+		return nil
+	}
+
+	var invoice stripe.Invoice
+	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		return fmt.Errorf("failed to unmarshal invoice: %w", err)
+	}
+	if invoice.AmountPaid <= 0 || invoice.Customer == nil {
+		return nil
+	}
+
+	stripeCustomer, err := customer.Get(invoice.Customer.ID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve Stripe customer %s: %w", invoice.Customer.ID, err)
+	}
+	userID, err := strconv.Atoi(stripeCustomer.Metadata["plex_user_id"])
+	if err != nil {
+		// Customers of anonymous donations have no Plex user
+		return nil
+	}
+	return s.rewardReferrer(ctx, userID, invoice.ID)
+}
+
 // parseEntitlementEventData extracts the entitlement summary and previous attributes from an event
 func parseEntitlementEventData(event stripe.Event) (*stripe.EntitlementsActiveEntitlementSummary, *stripe.EntitlementsActiveEntitlementSummary, error) {
 	// Convert event.Data.Object to JSON and then to EntitlementsActiveEntitlementSummary
@@ -207,14 +236,14 @@ func (s *V1) handleEntitlementAddition(
 ) error {
 	// Iterate through entitlements and handle based on lookup key
 	for _, entitlement := range summary.Entitlements.Data {
-		switch entitlement.LookupKey {
-		case config.C.Stripe.EntitlementName:
-			return s.shareLibraryWithCustomer(c, stripeCustomer, entitlement)
-		default:
+		plan, ok := config.C.PlanForEntitlement(entitlement.LookupKey)
+		if !ok {
 			slog.Info("Ignoring entitlement with unsupported lookup key",
 				"lookup_key", entitlement.LookupKey,
 				"customer", stripeCustomer.ID)
+			continue
 		}
+		return s.shareLibraryWithCustomer(c, stripeCustomer, entitlement, plan)
 	}
 
 	// If we get here, no matching entitlements were found
@@ -227,6 +256,7 @@ func (s *V1) shareLibraryWithCustomer(
 	ctx context.Context,
 	stripeCustomer *stripe.Customer,
 	entitlement *stripe.EntitlementsActiveEntitlement,
+	plan config.PlanConfig,
 ) error {
 	// Get Plex user email from customer metadata
 	plexUserEmail, ok := stripeCustomer.Metadata["plex_email"]
@@ -239,25 +269,30 @@ func (s *V1) shareLibraryWithCustomer(
 		slog.Info("Using customer email instead of metadata", "email", plexUserEmail, "customer", stripeCustomer.ID)
 	}
 
-	// Share Plex library with the user
-	slog.Info("Sharing Plex library with user",
-		"customer", stripeCustomer.ID,
-		"plex_user", plexUserEmail,
-		"entitlement", entitlement.LookupKey)
-	invite, err := s.services.Plex.ShareLibrary(ctx, plexUserEmail)
+	settings, err := sharingSettings(plan, nil, "")
 	if err != nil {
-		return fmt.Errorf("failed to share Plex library with %s: %w", plexUserEmail, err)
+		return fmt.Errorf("plan %s: %w", plan.Name, err)
 	}
-	slog.Info("Plex library shared successfully, Accepting invite...",
-		"invite_id", invite.ID,
-		"plex_user", plexUserEmail,
-		"customer", stripeCustomer.ID)
-	token, err := db.DB.GetPlexToken(ctx, invite.InvitedID)
-	if err != nil {
-		return fmt.Errorf("failed to get Plex token for user %d: %w", invite.InvitedID, err)
-	}
-	if err := s.services.Plex.AcceptInvite(ctx, token.AccessToken, invite.ID); err != nil {
-		return fmt.Errorf("failed to accept Plex invite for user %d: %w", invite.InvitedID, err)
+
+	// Share each server of the plan with the user
+	for _, server := range config.C.ServersForPlan(plan) {
+		slog.Info("Sharing Plex library with user",
+			"customer", stripeCustomer.ID,
+			"plex_user", plexUserEmail,
+			"entitlement", entitlement.LookupKey,
+			"plan", plan.Name,
+			"server", server.Name)
+		invite, err := s.services.Plex.ShareLibrary(ctx, server.MachineIdentifier, plexUserEmail, plan.Libraries, settings)
+		if err != nil {
+			return fmt.Errorf("failed to share Plex server %s with %s: %w", server.Name, plexUserEmail, err)
+		}
+		slog.Info("Plex library shared successfully, Accepting invite...",
+			"invite_id", invite.ID,
+			"plex_user", plexUserEmail,
+			"customer", stripeCustomer.ID)
+		// An invite we can't accept stays pending for the user rather than failing the webhook
+		recordShare(ctx, invite, s.acceptInvite(ctx, invite.InvitedID, invite.ID), plan.Libraries, settings, "")
+		assignPlan(ctx, invite.InvitedID, plan)
 	}
 
 	slog.Info("Shared Plex library with user",
@@ -289,8 +324,8 @@ func (s *V1) handleEntitlementRemoval(
 			"plex_user_id", plexUserID)
 		return fmt.Errorf("invalid plex user ID %s for customer %s: %w", plexUserID, stripeCustomer.ID, err)
 	}
-	// Unshare library with the Plex user using ID
-	if err := s.services.Plex.UnshareLibrary(ctx, id); err != nil {
+	// Unshare every server with the Plex user using ID
+	if err := s.unshareServers(ctx, config.C.Plex.Servers, id); err != nil {
 		return fmt.Errorf("failed to unshare Plex library with user ID %s: %w", plexUserID, err)
 	}
 
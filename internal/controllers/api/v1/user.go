@@ -5,19 +5,26 @@ import (
 	"net/http"
 	"plefi/internal/db"
 	"plefi/internal/models"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
-// GetCurrentUser returns the currently authenticated user's information
+// GetCurrentUser returns the currently authenticated user's information,
+// along with their inactivity warning when they have one
 func (h *V1) GetCurrentUser(c echo.Context, user *models.UserInfo) error {
-	// Return user info
-	c.JSON(http.StatusOK, models.GetCurrentUserResponse{
+	response := models.GetCurrentUserResponse{
 		BaseResponse: models.BaseResponse{
 			Status: "success",
 		},
 		User: user,
-	})
+	}
+	if user != nil {
+		response.InactivityWarning = showInactivityWarning(c.Request().Context(), user.ID, time.Now())
+	}
+
+	// Return user info
+	c.JSON(http.StatusOK, response)
 	return nil
 }
 
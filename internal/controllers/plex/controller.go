@@ -1,6 +1,7 @@
 package plexcontroller
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -11,7 +12,9 @@ import (
 	"plefi/internal/db"
 	"plefi/internal/models"
 	"plefi/internal/services"
+	"plefi/internal/services/plex"
 	"plefi/internal/utils"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -37,6 +40,8 @@ func NewPlexController(basePath string, client *http.Client, services *services.
 func (c *PlexController) GetRoutes(r *echo.Group) {
 	r.GET("/auth", c.Authenticate)
 	r.GET("/callback", c.Callback)
+	r.POST("/pin", c.CreatePin)
+	r.GET("/pin/:id", c.PollPin)
 }
 
 type PlexAuthenticateRequest struct {
@@ -109,59 +114,206 @@ func (h *PlexController) Callback(c echo.Context) error {
 		return fmt.Errorf("PIN not claimed yet")
 	}
 
+	if _, err := h.completeLogin(c, pinStatus.AuthToken); err != nil {
+		return err
+	}
+
+	// Determine where to redirect after successful authentication
+	redirectURL := "/"
+	if req.Next != "" {
+		redirectURL = req.Next
+	}
+
+	// Redirect to the appropriate URL
+	c.Redirect(http.StatusFound, redirectURL)
+	return nil
+}
+
+// CreatePinResponse represents the response for starting a PIN login
+type CreatePinResponse struct {
+	models.BaseResponse
+	PinID   int    `json:"pin_id"`   // ID to poll the PIN with
+	Code    string `json:"code"`     // Code the user signs in with
+	AuthURL string `json:"auth_url"` // Plex sign in page for the code, to open in a popup
+}
+
+// PollPinResponse represents the response for polling a PIN login
+type PollPinResponse struct {
+	models.BaseResponse
+	Claimed bool             `json:"claimed"`        // Whether the user has signed in
+	User    *models.UserInfo `json:"user,omitempty"` // Signed in user, once claimed
+}
+
+// CreatePin creates a Plex PIN for a popup login and returns the page the
+// user signs in on. The login is completed by polling PollPin.
+func (h *PlexController) CreatePin(c echo.Context) error {
+	code, err := h.services.Plex.GeneratePin(c.Request().Context())
+	if err != nil {
+		slog.Error("Failed to generate Plex PIN", "error", err)
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to create Plex PIN")
+	}
+
+	if err := utils.SaveSessionData(c, utils.PlexSessionState, &models.PlexAuth{
+		State: generateRandomState(),
+		PinID: code.ID,
+	}); err != nil {
+		slog.Error("Failed to save Plex auth data to session", "error", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, CreatePinResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "PIN created successfully",
+		},
+		PinID:   code.ID,
+		Code:    code.Code,
+		AuthURL: buildPlexPinAuthURL(code.Code),
+	})
+}
+
+// PollPin checks whether the user has signed in with the PIN created by
+// CreatePin, and establishes their session once they have
+func (h *PlexController) PollPin(c echo.Context) error {
+	pinID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid PIN ID")
+	}
+	plexAuth, err := utils.GetSessionData(c, utils.PlexSessionState)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "No login in progress")
+	}
+	plexAuthData, ok := plexAuth.(*models.PlexAuth)
+	if !ok || plexAuthData.PinID != pinID {
+		return echo.NewHTTPError(http.StatusNotFound, "No login in progress for this PIN")
+	}
+
+	pinStatus, err := h.services.Plex.ClaimPin(c.Request().Context(), pinID)
+	if err != nil {
+		if plex.IsNotFound(err) {
+			return echo.NewHTTPError(http.StatusGone, "PIN has expired")
+		}
+		slog.Error("Failed to check PIN status", "error", err, "pin_id", pinID)
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to check PIN status")
+	}
+	if pinStatus.AuthToken == "" {
+		return c.JSON(http.StatusOK, PollPinResponse{
+			BaseResponse: models.BaseResponse{
+				Status:  "success",
+				Message: "Waiting for the user to sign in",
+			},
+		})
+	}
+
+	user, err := h.completeLogin(c, pinStatus.AuthToken)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, PollPinResponse{
+		BaseResponse: models.BaseResponse{
+			Status:  "success",
+			Message: "Signed in successfully",
+		},
+		Claimed: true,
+		User:    user,
+	})
+}
+
+// completeLogin establishes the session of the user a claimed PIN belongs
+// to, and stores them and their token
+func (h *PlexController) completeLogin(c echo.Context, authToken string) (*models.UserInfo, error) {
 	// Verify the token and get user info
-	userInfo, err := h.services.Plex.GetUserDetails(c.Request().Context(), pinStatus.AuthToken)
+	userInfo, err := h.services.Plex.GetUserDetails(c.Request().Context(), authToken)
 	if err != nil {
 		slog.Error("Failed to verify token", "error", err)
-		return err
+		return nil, err
 	}
-	if err := utils.SaveSessionData(c, utils.UserInfoState, &models.UserInfo{
+	user := &models.UserInfo{
 		ID:       userInfo.ID,
 		UUID:     userInfo.UUID,
 		Username: userInfo.Username,
 		Email:    userInfo.Email,
 		IsAdmin:  config.C.Plex.AdminUserID == userInfo.ID,
-	}); err != nil {
+	}
+	if err := utils.SaveSessionData(c, utils.UserInfoState, user); err != nil {
 		slog.Error("Failed to save user info to session", "error", err)
-		return err
+		return nil, err
 	}
 	if err := utils.SaveSessionData(c, utils.PlexSessionState, nil); err != nil {
 		slog.Error("Failed to clear plex auth from session", "error", err)
-		return err
+		return nil, err
+	}
+	existing, err := db.DB.GetPlexUser(c.Request().Context(), userInfo.ID)
+	if err != nil {
+		slog.Error("Failed to get Plex user from database", "error", err)
+		return nil, err
 	}
 	if err := db.DB.SavePlexUser(c.Request().Context(), models.PlexUser{
 		ID:       userInfo.ID,
 		UUID:     userInfo.UUID,
 		Username: userInfo.Username,
 		Email:    userInfo.Email,
-		IsAdmin:  config.C.Plex.AdminUserID == userInfo.ID,
+		IsAdmin:  user.IsAdmin,
 	}); err != nil {
 		slog.Error("Failed to save Plex user to database", "error", err)
-		return err
+		return nil, err
 	}
 
 	if err := db.DB.SavePlexToken(c.Request().Context(), models.PlexToken{
 		UserID:      userInfo.ID,
-		AccessToken: pinStatus.AuthToken,
+		AccessToken: authToken,
 	}); err != nil {
 		slog.Error("Failed to save Plex token to database", "error", err)
-		return err
+		return nil, err
 	}
+	h.acceptPendingInvites(c.Request().Context(), userInfo.ID, authToken)
+	if existing == nil {
+		recordReferral(c, userInfo.ID)
+	}
+	return user, nil
+}
 
-	// Determine where to redirect after successful authentication
-	redirectURL := "/"
-	if req.Next != "" {
-		redirectURL = req.Next
+// recordReferral attributes a user signing in for the first time to the
+// member whose referral link they followed. Failures are logged, as they
+// shouldn't prevent the login.
+func recordReferral(c echo.Context, userID int) {
+	data, err := utils.GetSessionData(c, utils.ReferralState)
+	code, ok := data.(string)
+	if err != nil || !ok || code == "" {
+		return
+	}
+	if err := utils.SaveSessionData(c, utils.ReferralState, nil); err != nil {
+		slog.Error("Failed to clear referral code from session", "error", err)
 	}
 
-	// Redirect to the appropriate URL
-	c.Redirect(http.StatusFound, redirectURL)
-	return nil
+	referrer, err := db.DB.GetPlexUserByReferralCode(c.Request().Context(), code)
+	if err != nil || referrer == nil {
+		slog.Error("Failed to get referrer", "error", err, "code", code, "user_id", userID)
+		return
+	}
+	recorded, err := db.DB.SetReferrer(c.Request().Context(), userID, referrer.ID)
+	if err != nil {
+		slog.Error("Failed to record referral", "error", err, "user_id", userID, "referrer_id", referrer.ID)
+		return
+	}
+	if recorded {
+		slog.Info("User signed up through a referral", "user_id", userID, "referrer_id", referrer.ID)
+	}
+}
+
+// buildPlexPinAuthURL constructs the Plex authentication URL for a popup
+// login, which doesn't forward anywhere once the user signs in
+func buildPlexPinAuthURL(code string) string {
+	params := url.Values{}
+	params.Add("clientID", config.C.Plex.ClientID)
+	params.Add("code", code)
+	params.Add("context[device][product]", config.C.Plex.ProductName)
+
+	return fmt.Sprintf("%s/auth#?%s", config.C.Plex.AppUrl, params.Encode())
 }
 
 // buildPlexAuthURL constructs the Plex authentication URL
 func buildPlexAuthURL(basePath, state, nextURL, code string) string {
-	baseURL := "https://app.plex.tv/auth#"
+	baseURL := config.C.Plex.AppUrl + "/auth#"
 	params := url.Values{}
 	params.Add("clientID", config.C.Plex.ClientID)
 	params.Add("forwardUrl", fmt.Sprintf("https://%s%s/callback?state=%s&next=%s",
@@ -181,3 +333,31 @@ func generateRandomState() string {
 	}
 	return hex.EncodeToString(bytes)
 }
+
+// acceptPendingInvites accepts any invites still pending for a user now that
+// we have a fresh token for them. Failures are logged and left pending.
+func (h *PlexController) acceptPendingInvites(ctx context.Context, userID int, token string) {
+	shares, err := db.DB.GetPlexShares(ctx, userID)
+	if err != nil {
+		slog.Error("Failed to get Plex shares", "error", err, "user_id", userID)
+		return
+	}
+	for _, share := range shares {
+		if !share.Pending {
+			continue
+		}
+		inviteID, err := strconv.Atoi(share.SharedServerID)
+		if err != nil {
+			continue
+		}
+		if err := h.services.Plex.AcceptInvite(ctx, token, inviteID); err != nil {
+			slog.Error("Failed to accept pending Plex invite", "error", err, "user_id", userID, "invite_id", inviteID)
+			continue
+		}
+		share.Pending = false
+		if err := db.DB.SavePlexShare(ctx, share); err != nil {
+			slog.Error("Failed to record Plex share", "error", err, "user_id", userID, "invite_id", inviteID)
+		}
+		slog.Info("Pending Plex invite accepted on login", "user_id", userID, "invite_id", inviteID)
+	}
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"plefi/internal/models"
+)
+
+// accessRequestColumns are the access_requests columns, joined with
+// plex_users as u, read by scanAccessRequest
+const accessRequestColumns = `r.id, r.user_id, u.username, COALESCE(u.email, ''), r.message, r.status,
+               COALESCE(r.review_note, ''), r.reviewed_by, r.reviewed_at, r.created_at, r.updated_at`
+
+// CreateAccessRequest adds a pending access request for a user. It returns
+// models.ErrAccessRequestPending when the user has one waiting for review.
+func (db *sqlDB) CreateAccessRequest(ctx context.Context, userID int, message string) (*models.AccessRequest, error) {
+	var id int
+	err := db.conn.QueryRowContext(ctx, `
+		INSERT INTO access_requests(user_id, message)
+		VALUES($1, $2)
+		ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING id`,
+		userID, message).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrAccessRequestPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.GetAccessRequest(ctx, id)
+}
+
+// GetAccessRequest retrieves an access request by its ID
+func (db *sqlDB) GetAccessRequest(ctx context.Context, id int) (*models.AccessRequest, error) {
+	request, err := scanAccessRequest(db.conn.QueryRowContext(ctx, `
+        SELECT `+accessRequestColumns+`
+        FROM access_requests r
+        JOIN plex_users u ON u.id = r.user_id
+        WHERE r.id = $1`,
+		id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return request, err
+}
+
+// GetLatestAccessRequest retrieves the most recent access request of a user
+func (db *sqlDB) GetLatestAccessRequest(ctx context.Context, userID int) (*models.AccessRequest, error) {
+	request, err := scanAccessRequest(db.conn.QueryRowContext(ctx, `
+        SELECT `+accessRequestColumns+`
+        FROM access_requests r
+        JOIN plex_users u ON u.id = r.user_id
+        WHERE r.user_id = $1
+        ORDER BY r.created_at DESC, r.id DESC
+        LIMIT 1`,
+		userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return request, err
+}
+
+// ListAccessRequests retrieves the access requests with the given status, or
+// all requests when status is empty, oldest first
+func (db *sqlDB) ListAccessRequests(ctx context.Context, status string) ([]models.AccessRequest, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+accessRequestColumns+`
+        FROM access_requests r
+        JOIN plex_users u ON u.id = r.user_id
+        WHERE $1 = '' OR r.status = $1
+        ORDER BY r.created_at ASC, r.id ASC`,
+		status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]models.AccessRequest, 0)
+	for rows.Next() {
+		request, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *request)
+	}
+	return requests, rows.Err()
+}
+
+// ReviewAccessRequest approves or rejects a pending access request. It
+// returns models.ErrAccessRequestReviewed when the request isn't pending.
+func (db *sqlDB) ReviewAccessRequest(ctx context.Context, id int, status string, reviewerID int, note string) error {
+	result, err := db.conn.ExecContext(ctx, `
+		UPDATE access_requests
+		SET status = $2, reviewed_by = $3, review_note = NULLIF($4, ''),
+		    reviewed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending'`,
+		id, status, reviewerID, note)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrAccessRequestReviewed
+	}
+	return nil
+}
+
+// scanAccessRequest reads a request selected with accessRequestColumns
+func scanAccessRequest(row rowScanner) (*models.AccessRequest, error) {
+	request := &models.AccessRequest{}
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+	if err := row.Scan(
+		&request.ID, &request.UserID, &request.Username, &request.Email, &request.Message, &request.Status,
+		&request.ReviewNote, &reviewedBy, &reviewedAt, &request.CreatedAt, &request.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if reviewedBy.Valid {
+		id := int(reviewedBy.Int64)
+		request.ReviewedBy = &id
+	}
+	request.ReviewedAt = nullTimePtr(reviewedAt)
+	return request, nil
+}
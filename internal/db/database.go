@@ -8,6 +8,8 @@ import (
 	"log/slog"
 	"plefi/internal/config"
 	"plefi/internal/models"
+	"plefi/internal/secrets"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -23,13 +25,27 @@ type Database interface {
 	Migrate(ctx context.Context) error
 	SavePlexToken(ctx context.Context, tok models.PlexToken) error
 	GetPlexToken(ctx context.Context, userID int) (*models.PlexToken, error)
+	GetAllPlexTokens(ctx context.Context) ([]models.PlexToken, error)
+	SetPlexTokenValid(ctx context.Context, userID int, valid bool) error
+	RotatePlexTokenKey(ctx context.Context) (int, error)
 
 	// Invite Code operations
 	SaveInviteCode(ctx context.Context, inviteCode models.InviteCode) (int, error)
+	SaveGeneratedInviteCodes(ctx context.Context, inviteCode models.InviteCode, count int, generate func() (string, error)) ([]models.InviteCode, error)
 	GetInviteCode(ctx context.Context, id int) (*models.InviteCode, error)
 	GetInviteCodeByCode(ctx context.Context, code string) (*models.InviteCode, error)
-	UpdateInviteCodeUsage(ctx context.Context, codeID int) error
-	ListActiveInviteCodes(ctx context.Context) ([]models.InviteCode, error)
+	RedeemInviteCode(ctx context.Context, codeID, userID int, now time.Time) (*models.InviteCode, error)
+	ListInviteCodes(ctx context.Context) ([]models.InviteCode, error)
+	UpdateInviteCode(ctx context.Context, inviteCode models.InviteCode) error
+	SetInviteCodeDisabled(ctx context.Context, codeID int, disabled bool) error
+	DeleteUnusedInviteCode(ctx context.Context, codeID int) (bool, error)
+
+	// Invite Code Attempt operations
+	ReserveInviteCodeClaim(ctx context.Context, attempt models.InviteCodeAttempt, limits []models.ClaimLimit, window, lockoutDuration time.Duration) (int, *models.InviteCodeLockout, error)
+	FinishInviteCodeClaim(ctx context.Context, attemptID int, reason string) error
+	ListInviteCodeAttempts(ctx context.Context, limit int) ([]models.InviteCodeAttempt, error)
+	ListActiveInviteCodeLockouts(ctx context.Context, now time.Time) ([]models.InviteCodeLockout, error)
+	LiftInviteCodeLockout(ctx context.Context, id int, now time.Time) (bool, error)
 
 	// Plex User operations
 	SavePlexUser(ctx context.Context, user models.PlexUser) error
@@ -38,25 +54,65 @@ type Database interface {
 	GetAllPlexUsers(ctx context.Context) ([]models.PlexUser, error)
 	DeletePlexUser(ctx context.Context, userID int) error
 	UpdateUserNotes(ctx context.Context, userID int, notes string) error
+	SetUserExempt(ctx context.Context, userID int, exempt bool) error
+	SetInactivityWarnedAt(ctx context.Context, userID int, warnedAt, revokeAt *time.Time) error
+	SetInactivityWarningSeen(ctx context.Context, userID int, seenAt time.Time, revokeAt *time.Time) error
+	SetUserEntitlement(ctx context.Context, userID int, entitlementName string) error
 
 	// Plex User Invite operations
-	AssociatePlexUserWithInviteCode(ctx context.Context, userID, inviteCodeID int) error
 	GetPlexUserInvites(ctx context.Context, userID int) ([]models.PlexUserInvite, error)
+	GetEndedInviteAccess(ctx context.Context, now time.Time) ([]models.PlexUserInvite, error)
+	SetInviteAccessRevoked(ctx context.Context, inviteID int) error
 	GetUsersWithActiveInviteCode(ctx context.Context, inviteCodeID int) ([]models.PlexUser, error)
-	DisableInviteCode(ctx context.Context, codeID int) error
+
+	// Plex Share operations
+	ReplacePlexShares(ctx context.Context, shares []models.PlexShare) error
+	SavePlexShare(ctx context.Context, share models.PlexShare) error
+	DeletePlexShares(ctx context.Context, userID int) error
+	DeletePlexShare(ctx context.Context, userID int, machineIdentifier string) error
+	GetPlexShares(ctx context.Context, userID int) ([]models.PlexShare, error)
+	GetAllPlexShares(ctx context.Context) ([]models.PlexShare, error)
+	GetPlexShareBySharedServerID(ctx context.Context, sharedServerID string) (*models.PlexShare, error)
+	GetPendingPlexInvites(ctx context.Context) ([]models.PlexInvite, error)
+
+	// Plex Session operations
+	SavePlexSessions(ctx context.Context, sessions []models.PlexSession) error
+	GetPlexSessionHistory(ctx context.Context, userID, limit int) ([]models.PlexSessionHistory, error)
+	GetLastPlexSessionTimes(ctx context.Context) (map[int]time.Time, error)
+
+	// Access Request operations
+	CreateAccessRequest(ctx context.Context, userID int, message string) (*models.AccessRequest, error)
+	GetAccessRequest(ctx context.Context, id int) (*models.AccessRequest, error)
+	GetLatestAccessRequest(ctx context.Context, userID int) (*models.AccessRequest, error)
+	ListAccessRequests(ctx context.Context, status string) ([]models.AccessRequest, error)
+	ReviewAccessRequest(ctx context.Context, id int, status string, reviewerID int, note string) error
+
+	// Referral operations
+	GetReferralCode(ctx context.Context, userID int, generate func() (string, error)) (string, error)
+	GetPlexUserByReferralCode(ctx context.Context, code string) (*models.PlexUser, error)
+	SetReferrer(ctx context.Context, userID, referrerID int) (bool, error)
+	CountReferrals(ctx context.Context, referrerID int) (int, error)
+	GetReferralReward(ctx context.Context, referredID int) (*models.ReferralReward, error)
+	SaveReferralReward(ctx context.Context, reward models.ReferralReward) error
+	GetReferralRewards(ctx context.Context, referrerID int) ([]models.ReferralReward, error)
+
+	// Stream Enforcement operations
+	SaveStreamEnforcement(ctx context.Context, enforcement models.StreamEnforcement) error
+	GetStreamEnforcements(ctx context.Context, limit int) ([]models.StreamEnforcement, error)
 }
 
 type sqlDB struct {
-	conn   *sql.DB
-	driver string
+	conn    *sql.DB
+	driver  string
+	keyring *secrets.Keyring // Encrypts stored Plex tokens
 }
 
-func Init(driver, dsn string) error {
+func Init(driver, dsn string, keyring *secrets.Keyring) error {
 	conn, err := sql.Open(driver, dsn)
 	if err != nil {
 		return err
 	}
-	DB = &sqlDB{conn: conn, driver: driver}
+	DB = &sqlDB{conn: conn, driver: driver, keyring: keyring}
 	return nil
 }
 
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"plefi/internal/models"
+	"strconv"
+	"time"
+)
+
+// ReserveInviteCodeClaim records a claim attempt as pending before the code
+// is looked up, unless one of the limits is reached. Each subject is locked
+// for the transaction, so parallel claims are counted one after the other and
+// can't all slip under the limit. It returns the ID of the attempt, or the
+// lockout blocking the claim, saving it when the limit was just reached.
+func (db *sqlDB) ReserveInviteCodeClaim(
+	ctx context.Context,
+	attempt models.InviteCodeAttempt,
+	limits []models.ClaimLimit,
+	window, lockoutDuration time.Duration,
+) (int, *models.InviteCodeLockout, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	now := attempt.CreatedAt
+	for _, limit := range limits {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`,
+			"invite_code_claims:"+limit.SubjectType+":"+limit.Subject); err != nil {
+			return 0, nil, err
+		}
+		previous, err := latestInviteCodeLockout(ctx, tx, limit.SubjectType, limit.Subject)
+		if err != nil {
+			return 0, nil, err
+		}
+		attempts, err := countInviteCodeAttempts(ctx, tx, limit.SubjectType, limit.Subject, limit.CountSince(previous, now, window))
+		if err != nil {
+			return 0, nil, err
+		}
+		lockout, created := limit.Check(previous, attempts, now, lockoutDuration)
+		if lockout == nil {
+			continue
+		}
+		if created {
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO invite_code_lockouts(subject_type, subject, user_id, failed_attempts, locked_until, created_at)
+				VALUES($1, $2, $3, $4, $5, $6)
+				RETURNING id`,
+				lockout.SubjectType, lockout.Subject, lockout.UserID, lockout.FailedAttempts, lockout.LockedUntil, lockout.CreatedAt,
+			).Scan(&lockout.ID); err != nil {
+				return 0, nil, err
+			}
+		}
+		return 0, lockout, tx.Commit()
+	}
+
+	var id int
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO invite_code_attempts(user_id, ip_address, code, reason, created_at)
+		VALUES($1, $2, $3, $4, $5)
+		RETURNING id`,
+		attempt.UserID, attempt.IPAddress, attempt.Code, models.InviteCodeAttemptPending, now,
+	).Scan(&id); err != nil {
+		return 0, nil, err
+	}
+	return id, nil, tx.Commit()
+}
+
+// FinishInviteCodeClaim records why a reserved claim attempt failed, or
+// forgets it when reason is empty because the claim doesn't count as failed
+func (db *sqlDB) FinishInviteCodeClaim(ctx context.Context, attemptID int, reason string) error {
+	if reason == "" {
+		_, err := db.conn.ExecContext(ctx, `DELETE FROM invite_code_attempts WHERE id = $1`, attemptID)
+		return err
+	}
+	_, err := db.conn.ExecContext(ctx, `UPDATE invite_code_attempts SET reason = $2 WHERE id = $1`, attemptID, reason)
+	return err
+}
+
+// countInviteCodeAttempts counts the failed and pending attempts of a user or
+// from an IP address since the given time
+func countInviteCodeAttempts(ctx context.Context, tx *sql.Tx, subjectType, subject string, since time.Time) (int, error) {
+	var query string
+	var arg any
+	switch subjectType {
+	case models.LockoutSubjectUser:
+		userID, err := strconv.Atoi(subject)
+		if err != nil {
+			return 0, fmt.Errorf("invalid user ID %q: %w", subject, err)
+		}
+		query, arg = `SELECT COUNT(*) FROM invite_code_attempts WHERE user_id = $1 AND created_at > $2`, userID
+	case models.LockoutSubjectIP:
+		query, arg = `SELECT COUNT(*) FROM invite_code_attempts WHERE ip_address = $1 AND created_at > $2`, subject
+	default:
+		return 0, fmt.Errorf("unknown lockout subject type %q", subjectType)
+	}
+
+	var count int
+	err := tx.QueryRowContext(ctx, query, arg, since).Scan(&count)
+	return count, err
+}
+
+// ListInviteCodeAttempts retrieves the most recent failed attempts, leaving
+// out claims in progress
+func (db *sqlDB) ListInviteCodeAttempts(ctx context.Context, limit int) ([]models.InviteCodeAttempt, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT a.id, a.user_id, u.username, a.ip_address, a.code, a.reason, a.created_at
+        FROM invite_code_attempts a
+        JOIN plex_users u ON u.id = a.user_id
+        WHERE a.reason <> 'pending'
+        ORDER BY a.created_at DESC
+        LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := make([]models.InviteCodeAttempt, 0)
+	for rows.Next() {
+		var a models.InviteCodeAttempt
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Username, &a.IPAddress, &a.Code, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// inviteCodeLockoutColumns are the invite_code_lockouts columns, joined with
+// plex_users as u, read by scanInviteCodeLockout
+const inviteCodeLockoutColumns = `l.id, l.subject_type, l.subject, l.user_id, COALESCE(u.username, ''),
+               l.failed_attempts, l.locked_until, l.lifted_at, l.created_at`
+
+// latestInviteCodeLockout retrieves the most recent lockout of a user or IP address
+func latestInviteCodeLockout(ctx context.Context, tx *sql.Tx, subjectType, subject string) (*models.InviteCodeLockout, error) {
+	lockout, err := scanInviteCodeLockout(tx.QueryRowContext(ctx, `
+        SELECT `+inviteCodeLockoutColumns+`
+        FROM invite_code_lockouts l
+        LEFT JOIN plex_users u ON u.id = l.user_id
+        WHERE l.subject_type = $1 AND l.subject = $2
+        ORDER BY l.created_at DESC, l.id DESC
+        LIMIT 1`,
+		subjectType, subject))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return lockout, err
+}
+
+// ListActiveInviteCodeLockouts retrieves the lockouts still in effect at the given time
+func (db *sqlDB) ListActiveInviteCodeLockouts(ctx context.Context, now time.Time) ([]models.InviteCodeLockout, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+inviteCodeLockoutColumns+`
+        FROM invite_code_lockouts l
+        LEFT JOIN plex_users u ON u.id = l.user_id
+        WHERE l.locked_until > $1 AND l.lifted_at IS NULL
+        ORDER BY l.locked_until DESC`,
+		now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := make([]models.InviteCodeLockout, 0)
+	for rows.Next() {
+		lockout, err := scanInviteCodeLockout(rows)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, *lockout)
+	}
+	return lockouts, rows.Err()
+}
+
+// LiftInviteCodeLockout ends a lockout early and reports whether it was still in effect
+func (db *sqlDB) LiftInviteCodeLockout(ctx context.Context, id int, now time.Time) (bool, error) {
+	result, err := db.conn.ExecContext(ctx, `
+		UPDATE invite_code_lockouts
+		SET lifted_at = $2
+		WHERE id = $1 AND locked_until > $2 AND lifted_at IS NULL`,
+		id, now)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// scanInviteCodeLockout reads a lockout selected with inviteCodeLockoutColumns
+func scanInviteCodeLockout(row rowScanner) (*models.InviteCodeLockout, error) {
+	lockout := &models.InviteCodeLockout{}
+	var userID sql.NullInt64
+	var liftedAt sql.NullTime
+	if err := row.Scan(
+		&lockout.ID, &lockout.SubjectType, &lockout.Subject, &userID, &lockout.Username,
+		&lockout.FailedAttempts, &lockout.LockedUntil, &liftedAt, &lockout.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		lockout.UserID = &id
+	}
+	lockout.LiftedAt = nullTimePtr(liftedAt)
+	return lockout, nil
+}
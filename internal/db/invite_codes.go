@@ -3,40 +3,108 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"plefi/internal/models"
+	"time"
 )
 
+// inviteCodeColumns are the invite_codes columns read by scanInviteCode
+const inviteCodeColumns = `id, code, created_at, updated_at,
+		       expires_at, max_uses, used_count, is_disabled,
+		       entitlement_name, duration_days, sharing_settings,
+		       COALESCE(sharing_profile, ''), allowed_users`
+
+// insertInviteCode inserts an invite code, the suffix completing the statement
+const insertInviteCode = `
+		INSERT INTO invite_codes 
+		(code, expires_at, max_uses, is_disabled, entitlement_name, duration_days, sharing_settings, sharing_profile, allowed_users)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+	`
+
+// maxCodeAttempts is how many codes are drawn for each generated invite code
+// before giving up on finding one that isn't taken
+const maxCodeAttempts = 5
+
 // SaveInviteCode adds a new invite code to the database
 func (db *sqlDB) SaveInviteCode(ctx context.Context, inviteCode models.InviteCode) (int, error) {
+	args, err := inviteCodeArgs(inviteCode)
+	if err != nil {
+		return 0, err
+	}
+
 	var id int
-	err := db.conn.QueryRowContext(ctx, `
-		INSERT INTO invite_codes 
-		(code, expires_at, max_uses, is_disabled, entitlement_name, duration)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id
-	`, inviteCode.Code, inviteCode.ExpiresAt, inviteCode.MaxUses, inviteCode.IsDisabled,
-		inviteCode.EntitlementName, inviteCode.Duration,
-	).Scan(&id)
+	err = db.conn.QueryRowContext(ctx, insertInviteCode+`RETURNING id`, args...).Scan(&id)
 
 	return id, err
 }
 
-// GetInviteCodeByCode retrieves an invite code by its code value
-func (db *sqlDB) GetInviteCode(ctx context.Context, id int) (*models.InviteCode, error) {
-	inviteCode := &models.InviteCode{}
+// SaveGeneratedInviteCodes adds count invite codes with the settings of the
+// given code in one transaction. Each code is drawn from generate, drawing
+// again when the code is already taken.
+func (db *sqlDB) SaveGeneratedInviteCodes(
+	ctx context.Context,
+	inviteCode models.InviteCode,
+	count int,
+	generate func() (string, error),
+) ([]models.InviteCode, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes := make([]models.InviteCode, 0, count)
+	for len(codes) < count {
+		code := inviteCode
+		for attempt := 0; ; attempt++ {
+			if attempt == maxCodeAttempts {
+				return nil, models.ErrInviteCodeTaken
+			}
+			if code.Code, err = generate(); err != nil {
+				return nil, err
+			}
+			args, err := inviteCodeArgs(code)
+			if err != nil {
+				return nil, err
+			}
+			err = tx.QueryRowContext(ctx, insertInviteCode+`
+		ON CONFLICT (code) DO NOTHING
+		RETURNING id, created_at, updated_at`, args...).Scan(&code.ID, &code.CreatedAt, &code.UpdatedAt)
+			if err == nil {
+				break
+			}
+			if err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, tx.Commit()
+}
 
-	err := db.conn.QueryRowContext(ctx, `
-		SELECT id, code, created_at, updated_at, 
-		       expires_at, max_uses, used_count, is_disabled, 
-		       entitlement_name, duration
+// inviteCodeArgs returns the arguments of insertInviteCode for an invite code
+func inviteCodeArgs(inviteCode models.InviteCode) ([]any, error) {
+	sharing, err := encodeSharingSettings(inviteCode.SharingSettings)
+	if err != nil {
+		return nil, err
+	}
+	allowedUsers, err := encodeAllowedUsers(inviteCode.AllowedUsers)
+	if err != nil {
+		return nil, err
+	}
+	return []any{inviteCode.Code, inviteCode.ExpiresAt, inviteCode.MaxUses, inviteCode.IsDisabled,
+		inviteCode.EntitlementName, inviteCode.DurationDays, sharing, inviteCode.SharingProfile, allowedUsers}, nil
+}
+
+// GetInviteCode retrieves an invite code by its ID
+func (db *sqlDB) GetInviteCode(ctx context.Context, id int) (*models.InviteCode, error) {
+	inviteCode, err := scanInviteCode(db.conn.QueryRowContext(ctx, `
+		SELECT `+inviteCodeColumns+`
 		FROM invite_codes
 		WHERE id = $1
-	`, id).Scan(
-		&inviteCode.ID, &inviteCode.Code,
-		&inviteCode.CreatedAt, &inviteCode.UpdatedAt, &inviteCode.ExpiresAt,
-		&inviteCode.MaxUses, &inviteCode.UsedCount, &inviteCode.IsDisabled,
-		&inviteCode.EntitlementName, &inviteCode.Duration,
-	)
+	`, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -47,20 +115,11 @@ func (db *sqlDB) GetInviteCode(ctx context.Context, id int) (*models.InviteCode,
 
 // GetInviteCodeByCode retrieves an invite code by its code value
 func (db *sqlDB) GetInviteCodeByCode(ctx context.Context, code string) (*models.InviteCode, error) {
-	inviteCode := &models.InviteCode{}
-
-	err := db.conn.QueryRowContext(ctx, `
-		SELECT id, code, created_at, updated_at, 
-		       expires_at, max_uses, used_count, is_disabled, 
-		       entitlement_name, duration
+	inviteCode, err := scanInviteCode(db.conn.QueryRowContext(ctx, `
+		SELECT `+inviteCodeColumns+`
 		FROM invite_codes
 		WHERE code = $1
-	`, code).Scan(
-		&inviteCode.ID, &inviteCode.Code,
-		&inviteCode.CreatedAt, &inviteCode.UpdatedAt, &inviteCode.ExpiresAt,
-		&inviteCode.MaxUses, &inviteCode.UsedCount, &inviteCode.IsDisabled,
-		&inviteCode.EntitlementName, &inviteCode.Duration,
-	)
+	`, code))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -69,25 +128,11 @@ func (db *sqlDB) GetInviteCodeByCode(ctx context.Context, code string) (*models.
 	return inviteCode, err
 }
 
-// UpdateInviteCodeUsage increments the usage count for an invite code
-func (db *sqlDB) UpdateInviteCodeUsage(ctx context.Context, codeID int) error {
-	_, err := db.conn.ExecContext(ctx, `
-		UPDATE invite_codes
-		SET used_count = used_count + 1, updated_at = NOW()
-		WHERE id = $1
-	`, codeID)
-
-	return err
-}
-
-// ListActiveInviteCodes retrieves all active invite codes
-func (db *sqlDB) ListActiveInviteCodes(ctx context.Context) ([]models.InviteCode, error) {
+// ListInviteCodes retrieves all invite codes, including disabled ones
+func (db *sqlDB) ListInviteCodes(ctx context.Context) ([]models.InviteCode, error) {
 	rows, err := db.conn.QueryContext(ctx, `
-		SELECT id, code, created_at, updated_at, 
-		       expires_at, max_uses, used_count, is_disabled, 
-		       entitlement_name, duration
+		SELECT `+inviteCodeColumns+`
 		FROM invite_codes
-		WHERE is_disabled = FALSE
 		ORDER BY created_at DESC
 	`)
 
@@ -98,16 +143,11 @@ func (db *sqlDB) ListActiveInviteCodes(ctx context.Context) ([]models.InviteCode
 
 	var inviteCodes []models.InviteCode
 	for rows.Next() {
-		var code models.InviteCode
-		if err := rows.Scan(
-			&code.ID, &code.Code,
-			&code.CreatedAt, &code.UpdatedAt, &code.ExpiresAt,
-			&code.MaxUses, &code.UsedCount, &code.IsDisabled,
-			&code.EntitlementName, &code.Duration,
-		); err != nil {
+		code, err := scanInviteCode(rows)
+		if err != nil {
 			return nil, err
 		}
-		inviteCodes = append(inviteCodes, code)
+		inviteCodes = append(inviteCodes, *code)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -117,20 +157,120 @@ func (db *sqlDB) ListActiveInviteCodes(ctx context.Context) ([]models.InviteCode
 	return inviteCodes, nil
 }
 
-func (db *sqlDB) AssociatePlexUserWithInviteCode(ctx context.Context, userID, inviteCodeID int) error {
-	_, err := db.conn.ExecContext(ctx, `
-    INSERT INTO plex_user_invites(user_id, invite_code_id)
-    VALUES($1, $2)
-    ON CONFLICT(user_id, invite_code_id) DO UPDATE SET 
-        used_at = CURRENT_TIMESTAMP;`,
-		userID, inviteCodeID,
-	)
-	return err
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanInviteCode reads an invite code selected with inviteCodeColumns
+func scanInviteCode(row rowScanner) (*models.InviteCode, error) {
+	code := &models.InviteCode{}
+	var sharing, allowedUsers sql.NullString
+	if err := row.Scan(
+		&code.ID, &code.Code,
+		&code.CreatedAt, &code.UpdatedAt, &code.ExpiresAt,
+		&code.MaxUses, &code.UsedCount, &code.IsDisabled,
+		&code.EntitlementName, &code.DurationDays, &sharing,
+		&code.SharingProfile, &allowedUsers,
+	); err != nil {
+		return nil, err
+	}
+	if sharing.Valid && sharing.String != "" {
+		code.SharingSettings = &models.SharingSettings{}
+		if err := json.Unmarshal([]byte(sharing.String), code.SharingSettings); err != nil {
+			return nil, fmt.Errorf("invalid sharing settings for invite code %d: %w", code.ID, err)
+		}
+	}
+	if allowedUsers.Valid && allowedUsers.String != "" {
+		if err := json.Unmarshal([]byte(allowedUsers.String), &code.AllowedUsers); err != nil {
+			return nil, fmt.Errorf("invalid allowed users for invite code %d: %w", code.ID, err)
+		}
+	}
+	return code, nil
+}
+
+// encodeAllowedUsers serializes an allowlist to a nullable JSON column, NULL when empty
+func encodeAllowedUsers(allowedUsers []string) (sql.NullString, error) {
+	if len(allowedUsers) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(allowedUsers)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode allowed users: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// encodeSharingSettings serializes optional sharing settings to a nullable JSON column
+func encodeSharingSettings(settings *models.SharingSettings) (sql.NullString, error) {
+	if settings == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode sharing settings: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// RedeemInviteCode records a user claiming an invite code and counts the use
+// in one transaction, returning the updated code. The use is only counted
+// while the code has uses left, so concurrent claims can't exceed max_uses.
+func (db *sqlDB) RedeemInviteCode(ctx context.Context, codeID, userID int, now time.Time) (*models.InviteCode, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	inviteCode, err := scanInviteCode(tx.QueryRowContext(ctx, `
+		SELECT `+inviteCodeColumns+`
+		FROM invite_codes
+		WHERE id = $1
+	`, codeID))
+	if err != nil {
+		return nil, err
+	}
+	if err := inviteCode.CheckRedeemable(now); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO plex_user_invites(user_id, invite_code_id, used_at, access_ends_at)
+		VALUES($1, $2, $3, $4)
+		ON CONFLICT(user_id, invite_code_id) DO NOTHING`,
+		userID, codeID, now, inviteCode.AccessEndsAt(now))
+	if err != nil {
+		return nil, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if inserted == 0 {
+		return nil, models.ErrInviteCodeAlreadyClaimed
+	}
+
+	result, err = tx.ExecContext(ctx, `
+		UPDATE invite_codes
+		SET used_count = used_count + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (max_uses IS NULL OR used_count < max_uses)
+	`, codeID)
+	if err != nil {
+		return nil, err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if updated == 0 {
+		// Another claim used the last use since the code was read
+		return nil, models.ErrInviteCodeExhausted
+	}
+
+	inviteCode.UsedCount++
+	return inviteCode, tx.Commit()
 }
 
 func (db *sqlDB) GetPlexUserInvites(ctx context.Context, userID int) ([]models.PlexUserInvite, error) {
 	rows, err := db.conn.QueryContext(ctx, `
-        SELECT pui.id, pui.user_id, pui.invite_code_id, pui.used_at, ic.code, ic.entitlement_name
+        SELECT `+plexUserInviteColumns+`
         FROM plex_user_invites pui
         JOIN invite_codes ic ON pui.invite_code_id = ic.id
         WHERE pui.user_id = $1
@@ -142,16 +282,67 @@ func (db *sqlDB) GetPlexUserInvites(ctx context.Context, userID int) ([]models.P
 	}
 	defer rows.Close()
 
+	return scanPlexUserInvites(rows)
+}
+
+// GetEndedInviteAccess retrieves the claimed invites whose access has ended
+// and hasn't been revoked yet. Invites of users that still have access through
+// another invite are left out.
+func (db *sqlDB) GetEndedInviteAccess(ctx context.Context, now time.Time) ([]models.PlexUserInvite, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+plexUserInviteColumns+`
+        FROM plex_user_invites pui
+        JOIN invite_codes ic ON pui.invite_code_id = ic.id
+        WHERE pui.access_ends_at <= $1
+          AND pui.revoked_at IS NULL
+          AND NOT EXISTS (
+              SELECT 1
+              FROM plex_user_invites other
+              WHERE other.user_id = pui.user_id
+                AND other.revoked_at IS NULL
+                AND (other.access_ends_at IS NULL OR other.access_ends_at > $1)
+          )
+        ORDER BY pui.access_ends_at ASC`,
+		now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPlexUserInvites(rows)
+}
+
+// SetInviteAccessRevoked records that the access granted by a claimed invite was revoked
+func (db *sqlDB) SetInviteAccessRevoked(ctx context.Context, inviteID int) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE plex_user_invites
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		inviteID)
+	return err
+}
+
+// plexUserInviteColumns are the columns of plex_user_invites pui joined with
+// invite_codes ic read by scanPlexUserInvites
+const plexUserInviteColumns = `pui.id, pui.user_id, pui.invite_code_id, pui.used_at,
+               ic.code, ic.entitlement_name, pui.access_ends_at, pui.revoked_at`
+
+// scanPlexUserInvites reads claimed invites selected with plexUserInviteColumns
+func scanPlexUserInvites(rows *sql.Rows) ([]models.PlexUserInvite, error) {
 	var invites []models.PlexUserInvite
 	for rows.Next() {
 		var invite models.PlexUserInvite
+		var accessEndsAt, revokedAt sql.NullTime
 		err := rows.Scan(
 			&invite.ID, &invite.UserID, &invite.InviteCodeID,
 			&invite.UsedAt, &invite.InviteCode, &invite.EntitlementName,
+			&accessEndsAt, &revokedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		invite.AccessEndsAt = nullTimePtr(accessEndsAt)
+		invite.RevokedAt = nullTimePtr(revokedAt)
 		invites = append(invites, invite)
 	}
 
@@ -160,7 +351,8 @@ func (db *sqlDB) GetPlexUserInvites(ctx context.Context, userID int) ([]models.P
 
 func (db *sqlDB) GetUsersWithActiveInviteCode(ctx context.Context, inviteCodeID int) ([]models.PlexUser, error) {
 	rows, err := db.conn.QueryContext(ctx, `
-        SELECT u.id, u.uuid, u.username, u.email, u.is_admin, u.created_at, u.updated_at
+        SELECT u.id, u.uuid, u.username, COALESCE(u.email, ''), u.is_admin, u.is_managed,
+               u.created_at, u.updated_at
         FROM plex_users u
         JOIN plex_user_invites pui ON u.id = pui.user_id
         WHERE pui.invite_code_id = $1
@@ -177,7 +369,7 @@ func (db *sqlDB) GetUsersWithActiveInviteCode(ctx context.Context, inviteCodeID
 		var user models.PlexUser
 		err := rows.Scan(
 			&user.ID, &user.UUID, &user.Username, &user.Email,
-			&user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
+			&user.IsAdmin, &user.IsManaged, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -188,13 +380,46 @@ func (db *sqlDB) GetUsersWithActiveInviteCode(ctx context.Context, inviteCodeID
 	return users, rows.Err()
 }
 
-// DisableInviteCode marks an invite code as disabled
-func (db *sqlDB) DisableInviteCode(ctx context.Context, codeID int) error {
+// UpdateInviteCode saves the limits, entitlement and allowlist of an existing invite code
+func (db *sqlDB) UpdateInviteCode(ctx context.Context, inviteCode models.InviteCode) error {
+	allowedUsers, err := encodeAllowedUsers(inviteCode.AllowedUsers)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.ExecContext(ctx, `
+		UPDATE invite_codes
+		SET max_uses = $2, expires_at = $3, duration_days = $4, entitlement_name = $5,
+		    allowed_users = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, inviteCode.ID, inviteCode.MaxUses, inviteCode.ExpiresAt, inviteCode.DurationDays, inviteCode.EntitlementName,
+		allowedUsers)
+
+	return err
+}
+
+// SetInviteCodeDisabled disables an invite code or enables it again
+func (db *sqlDB) SetInviteCodeDisabled(ctx context.Context, codeID int, disabled bool) error {
 	_, err := db.conn.ExecContext(ctx, `
 		UPDATE invite_codes
-		SET is_disabled = TRUE, updated_at = NOW()
+		SET is_disabled = $2, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
-	`, codeID)
+	`, codeID, disabled)
 
 	return err
 }
+
+// DeleteUnusedInviteCode permanently deletes an invite code nobody has
+// claimed, and reports whether it was deleted
+func (db *sqlDB) DeleteUnusedInviteCode(ctx context.Context, codeID int) (bool, error) {
+	result, err := db.conn.ExecContext(ctx, `
+		DELETE FROM invite_codes
+		WHERE id = $1
+		  AND used_count = 0
+		  AND NOT EXISTS (SELECT 1 FROM plex_user_invites WHERE invite_code_id = $1)
+	`, codeID)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"plefi/internal/models"
+	"time"
+)
+
+// SavePlexSessions records the given active sessions in the session history,
+// extending the last seen time of sessions already recorded
+func (db *sqlDB) SavePlexSessions(ctx context.Context, sessions []models.PlexSession) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, session := range sessions {
+		if _, err := tx.ExecContext(ctx, `
+    INSERT INTO plex_session_history(session_id, machine_identifier, user_id, username, title, media_type,
+                                     player, platform, state, decision, bandwidth, local)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+    ON CONFLICT(machine_identifier, session_id) DO UPDATE SET
+        state = EXCLUDED.state,
+        decision = EXCLUDED.decision,
+        bandwidth = EXCLUDED.bandwidth,
+        last_seen_at = CURRENT_TIMESTAMP;`,
+			session.SessionID, session.MachineIdentifier, session.UserID, session.Username, session.Title, session.Type,
+			session.Player, session.Platform, session.State, session.Decision, session.Bandwidth, session.Local,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetPlexSessionHistory retrieves the most recent sessions, for a single user
+// when userID is non-zero
+func (db *sqlDB) GetPlexSessionHistory(ctx context.Context, userID, limit int) ([]models.PlexSessionHistory, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT id, session_id, machine_identifier, user_id, username, title, media_type,
+               player, platform, state, decision, bandwidth, local, started_at, last_seen_at
+        FROM plex_session_history
+        WHERE $1 = 0 OR user_id = $1
+        ORDER BY last_seen_at DESC
+        LIMIT $2`,
+		userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.PlexSessionHistory
+	for rows.Next() {
+		var h models.PlexSessionHistory
+		if err := rows.Scan(
+			&h.ID, &h.SessionID, &h.MachineIdentifier, &h.UserID, &h.Username, &h.Title, &h.Type,
+			&h.Player, &h.Platform, &h.State, &h.Decision, &h.Bandwidth, &h.Local, &h.StartedAt, &h.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+// GetLastPlexSessionTimes returns when each user was last seen playing something
+func (db *sqlDB) GetLastPlexSessionTimes(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT user_id, MAX(last_seen_at)
+        FROM plex_session_history
+        GROUP BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastSeen := make(map[int]time.Time)
+	for rows.Next() {
+		var userID int
+		var seenAt time.Time
+		if err := rows.Scan(&userID, &seenAt); err != nil {
+			return nil, err
+		}
+		lastSeen[userID] = seenAt
+	}
+	return lastSeen, rows.Err()
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"plefi/internal/models"
+	"time"
+)
+
+// plexShareColumns are the plex_shares columns read by scanPlexShare
+const plexShareColumns = `s.user_id, s.machine_identifier, s.shared_server_id, s.num_libraries,
+               s.all_libraries, s.pending, COALESCE(s.invite_token, ''), s.invited_at,
+               s.last_seen_at, s.synced_at, COALESCE(s.sharing_profile, ''), s.libraries, s.sharing_settings`
+
+// ReplacePlexShares updates stored shares with the given snapshot from plex.tv.
+// Accepted shares missing from the snapshot are removed; pending invites are
+// kept, since plex.tv only lists users once they have accepted. Pending
+// invites are only removed when they are cancelled, resent or revoked here.
+func (db *sqlDB) ReplacePlexShares(ctx context.Context, shares []models.PlexShare) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, share := range shares {
+		if _, err := tx.ExecContext(ctx, `
+    INSERT INTO plex_shares(user_id, machine_identifier, shared_server_id, num_libraries,
+                            all_libraries, pending, last_seen_at)
+    VALUES($1, $2, $3, $4, $5, $6, $7)
+    ON CONFLICT(user_id, machine_identifier) DO UPDATE SET
+        shared_server_id = EXCLUDED.shared_server_id,
+        num_libraries = EXCLUDED.num_libraries,
+        all_libraries = EXCLUDED.all_libraries,
+        pending = EXCLUDED.pending,
+        last_seen_at = EXCLUDED.last_seen_at,
+        synced_at = CURRENT_TIMESTAMP;`,
+			share.UserID, share.MachineIdentifier, share.SharedServerID, share.NumLibraries,
+			share.AllLibraries, share.Pending, share.LastSeenAt,
+		); err != nil {
+			return err
+		}
+	}
+	// CURRENT_TIMESTAMP is fixed for the transaction, so every row touched above is kept
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM plex_shares WHERE synced_at < CURRENT_TIMESTAMP AND pending = FALSE;`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SavePlexShare inserts or updates a single share, along with the libraries
+// and settings it was made with
+func (db *sqlDB) SavePlexShare(ctx context.Context, share models.PlexShare) error {
+	libraries, err := encodeLibraries(share.Libraries)
+	if err != nil {
+		return err
+	}
+	sharing, err := encodeSharingSettings(share.SharingSettings)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.ExecContext(ctx, `
+    INSERT INTO plex_shares(user_id, machine_identifier, shared_server_id, num_libraries,
+                            all_libraries, pending, invite_token, invited_at, last_seen_at, sharing_profile,
+                            libraries, sharing_settings)
+    VALUES($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, NULLIF($10, ''), $11, $12)
+    ON CONFLICT(user_id, machine_identifier) DO UPDATE SET
+        shared_server_id = EXCLUDED.shared_server_id,
+        num_libraries = EXCLUDED.num_libraries,
+        all_libraries = EXCLUDED.all_libraries,
+        pending = EXCLUDED.pending,
+        invite_token = COALESCE(EXCLUDED.invite_token, plex_shares.invite_token),
+        invited_at = COALESCE(plex_shares.invited_at, EXCLUDED.invited_at),
+        last_seen_at = COALESCE(EXCLUDED.last_seen_at, plex_shares.last_seen_at),
+        sharing_profile = EXCLUDED.sharing_profile,
+        libraries = EXCLUDED.libraries,
+        sharing_settings = EXCLUDED.sharing_settings,
+        synced_at = CURRENT_TIMESTAMP;`,
+		share.UserID, share.MachineIdentifier, share.SharedServerID, share.NumLibraries,
+		share.AllLibraries, share.Pending, share.InviteToken, share.InvitedAt, share.LastSeenAt,
+		share.SharingProfile, libraries, sharing,
+	)
+	return err
+}
+
+// encodeLibraries serializes library names to a nullable JSON column, NULL when empty
+func encodeLibraries(libraries []string) (sql.NullString, error) {
+	if len(libraries) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(libraries)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode libraries: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// DeletePlexShares removes all shares for a user
+func (db *sqlDB) DeletePlexShares(ctx context.Context, userID int) error {
+	_, err := db.conn.ExecContext(ctx, `
+		DELETE FROM plex_shares WHERE user_id = $1;`, userID)
+	return err
+}
+
+// DeletePlexShare removes a user's share of a single server
+func (db *sqlDB) DeletePlexShare(ctx context.Context, userID int, machineIdentifier string) error {
+	_, err := db.conn.ExecContext(ctx, `
+		DELETE FROM plex_shares WHERE user_id = $1 AND machine_identifier = $2;`, userID, machineIdentifier)
+	return err
+}
+
+// GetPlexShares retrieves all shares for a user
+func (db *sqlDB) GetPlexShares(ctx context.Context, userID int) ([]models.PlexShare, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+plexShareColumns+`
+        FROM plex_shares s
+        WHERE s.user_id = $1`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPlexShares(rows)
+}
+
+// GetAllPlexShares retrieves all stored shares
+func (db *sqlDB) GetAllPlexShares(ctx context.Context) ([]models.PlexShare, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+plexShareColumns+`
+        FROM plex_shares s
+        ORDER BY s.user_id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanPlexShares(rows)
+}
+
+// GetPlexShareBySharedServerID retrieves a share by its Plex shared server record ID
+func (db *sqlDB) GetPlexShareBySharedServerID(ctx context.Context, sharedServerID string) (*models.PlexShare, error) {
+	share, err := scanPlexShare(db.conn.QueryRowContext(ctx, `
+        SELECT `+plexShareColumns+`
+        FROM plex_shares s
+        WHERE s.shared_server_id = $1`,
+		sharedServerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return share, err
+}
+
+// GetPendingPlexInvites retrieves all shares whose invite hasn't been accepted yet
+func (db *sqlDB) GetPendingPlexInvites(ctx context.Context) ([]models.PlexInvite, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+plexShareColumns+`, COALESCE(u.username, ''), COALESCE(u.email, '')
+        FROM plex_shares s
+        LEFT JOIN plex_users u ON u.id = s.user_id
+        WHERE s.pending = TRUE
+        ORDER BY s.invited_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []models.PlexInvite
+	for rows.Next() {
+		var invite models.PlexInvite
+		share, err := scanPlexShare(rows, &invite.Username, &invite.Email)
+		if err != nil {
+			return nil, err
+		}
+		invite.PlexShare = *share
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+func scanPlexShares(rows *sql.Rows) ([]models.PlexShare, error) {
+	defer rows.Close()
+
+	var shares []models.PlexShare
+	for rows.Next() {
+		share, err := scanPlexShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *share)
+	}
+	return shares, rows.Err()
+}
+
+// scanPlexShare reads a share selected with plexShareColumns, followed by
+// any extra columns scanned into extra
+func scanPlexShare(row rowScanner, extra ...any) (*models.PlexShare, error) {
+	var share models.PlexShare
+	var invitedAt, lastSeenAt sql.NullTime
+	var libraries, sharing sql.NullString
+	dest := []any{
+		&share.UserID, &share.MachineIdentifier, &share.SharedServerID, &share.NumLibraries,
+		&share.AllLibraries, &share.Pending, &share.InviteToken, &invitedAt,
+		&lastSeenAt, &share.SyncedAt, &share.SharingProfile, &libraries, &sharing,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	share.InvitedAt = nullTimePtr(invitedAt)
+	share.LastSeenAt = nullTimePtr(lastSeenAt)
+	if libraries.Valid && libraries.String != "" {
+		if err := json.Unmarshal([]byte(libraries.String), &share.Libraries); err != nil {
+			return nil, fmt.Errorf("invalid libraries for share of user %d: %w", share.UserID, err)
+		}
+	}
+	if sharing.Valid && sharing.String != "" {
+		share.SharingSettings = &models.SharingSettings{}
+		if err := json.Unmarshal([]byte(sharing.String), share.SharingSettings); err != nil {
+			return nil, fmt.Errorf("invalid sharing settings for share of user %d: %w", share.UserID, err)
+		}
+	}
+	return &share, nil
+}
+
+// nullTimePtr converts a nullable timestamp to a pointer
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
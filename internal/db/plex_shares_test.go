@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"plefi/internal/models"
+)
+
+// plexSharesSchema creates the plex_shares table and the plex_users columns it is joined with
+const plexSharesSchema = `
+    CREATE TABLE plex_users (
+        id       INTEGER PRIMARY KEY,
+        username TEXT NOT NULL,
+        email    TEXT NULL
+    );
+    CREATE TABLE plex_shares (
+        user_id            INT NOT NULL,
+        machine_identifier TEXT NOT NULL,
+        shared_server_id   TEXT NOT NULL,
+        num_libraries      INT NOT NULL DEFAULT 0,
+        all_libraries      BOOLEAN NOT NULL DEFAULT FALSE,
+        pending            BOOLEAN NOT NULL DEFAULT FALSE,
+        last_seen_at       TIMESTAMP NULL,
+        synced_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        invite_token       TEXT NULL,
+        invited_at         TIMESTAMP NULL,
+        sharing_profile    TEXT NULL,
+        libraries          TEXT NULL,
+        sharing_settings   TEXT NULL,
+        PRIMARY KEY (user_id, machine_identifier)
+    );`
+
+func TestSavePlexShareKeepsTerms(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, nil, plexSharesSchema)
+	if _, err := db.conn.Exec(`INSERT INTO plex_users(id, username, email) VALUES(2, 'alice', 'alice@example.com')`); err != nil {
+		t.Fatal(err)
+	}
+
+	invitedAt := time.Now()
+	if err := db.SavePlexShare(ctx, models.PlexShare{
+		UserID:            2,
+		MachineIdentifier: "main",
+		SharedServerID:    "10",
+		Pending:           true,
+		InviteToken:       "token",
+		InvitedAt:         &invitedAt,
+		SharingProfile:    "kids",
+		Libraries:         []string{"Music"},
+		SharingSettings:   &models.SharingSettings{AllowSync: true, AllowTuners: 1},
+	}); err != nil {
+		t.Fatalf("SavePlexShare() error = %v", err)
+	}
+
+	share, err := db.GetPlexShareBySharedServerID(ctx, "10")
+	if err != nil {
+		t.Fatalf("GetPlexShareBySharedServerID() error = %v", err)
+	}
+	if share == nil || share.SharingProfile != "kids" || len(share.Libraries) != 1 || share.Libraries[0] != "Music" ||
+		share.SharingSettings == nil || !share.SharingSettings.AllowSync || share.SharingSettings.AllowTuners != 1 {
+		t.Fatalf("GetPlexShareBySharedServerID() = %+v, want the profile, libraries and settings it was saved with", share)
+	}
+
+	invites, err := db.GetPendingPlexInvites(ctx)
+	if err != nil {
+		t.Fatalf("GetPendingPlexInvites() error = %v", err)
+	}
+	if len(invites) != 1 || invites[0].Username != "alice" || invites[0].SharedServerID != "10" || invites[0].SharingSettings == nil {
+		t.Errorf("GetPendingPlexInvites() = %+v, want alice's invite with its settings", invites)
+	}
+
+	// The sync doesn't know the terms a share was made with and keeps them
+	if err := db.ReplacePlexShares(ctx, []models.PlexShare{{UserID: 2, MachineIdentifier: "main", SharedServerID: "10"}}); err != nil {
+		t.Fatalf("ReplacePlexShares() error = %v", err)
+	}
+	if share, err := db.GetPlexShareBySharedServerID(ctx, "10"); err != nil || share.SharingSettings == nil || len(share.Libraries) != 1 {
+		t.Errorf("GetPlexShareBySharedServerID() after sync = %+v, %v, want the saved libraries and settings", share, err)
+	}
+}
@@ -2,27 +2,160 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
 	"plefi/internal/models"
+	"plefi/internal/secrets"
 )
 
+// plexTokenColumns are the plex_tokens columns read by scanPlexToken
+const plexTokenColumns = `user_id, access_token, key_id, data_key, is_valid, validated_at, invalidated_at, created_at, updated_at`
+
+// errDecryptToken is returned by scanPlexToken when a stored token can't be
+// decrypted, such as when the key that sealed it was removed from the keyring
+var errDecryptToken = errors.New("failed to decrypt token")
+
+// SavePlexToken stores a token from a fresh login, which is valid until Plex
+// rejects it. The token is encrypted with the current key when one is configured.
 func (db *sqlDB) SavePlexToken(ctx context.Context, tok models.PlexToken) error {
-	_, err := db.conn.ExecContext(ctx, `
-    INSERT INTO plex_tokens(user_id, access_token)
-    VALUES($1,$2)
+	sealed, err := db.keyring.Seal(tok.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	_, err = db.conn.ExecContext(ctx, `
+    INSERT INTO plex_tokens(user_id, access_token, key_id, data_key, is_valid, validated_at)
+    VALUES($1, $2, NULLIF($3, ''), NULLIF($4, ''), TRUE, CURRENT_TIMESTAMP)
     ON CONFLICT(user_id) DO UPDATE SET
-        access_token  = EXCLUDED.access_token,
-        updated_at    = CURRENT_TIMESTAMP;`,
-		tok.UserID, tok.AccessToken,
+        access_token   = EXCLUDED.access_token,
+        key_id         = EXCLUDED.key_id,
+        data_key       = EXCLUDED.data_key,
+        is_valid       = TRUE,
+        validated_at   = CURRENT_TIMESTAMP,
+        invalidated_at = NULL,
+        updated_at     = CURRENT_TIMESTAMP;`,
+		tok.UserID, sealed.Ciphertext, sealed.KeyID, sealed.DataKey,
 	)
 	return err
 }
 
 func (db *sqlDB) GetPlexToken(ctx context.Context, userID int) (*models.PlexToken, error) {
-	var tok models.PlexToken
-	row := db.conn.QueryRowContext(ctx, `
-        SELECT user_id, access_token, created_at, updated_at
+	return db.scanPlexToken(db.conn.QueryRowContext(ctx, `
+        SELECT `+plexTokenColumns+`
+          FROM plex_tokens
+         WHERE user_id = $1`, userID))
+}
+
+// GetAllPlexTokens retrieves every stored token. Tokens that can't be
+// decrypted are logged and skipped so they don't hide the others.
+func (db *sqlDB) GetAllPlexTokens(ctx context.Context) ([]models.PlexToken, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+plexTokenColumns+`
+          FROM plex_tokens
+         ORDER BY user_id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.PlexToken
+	for rows.Next() {
+		tok, err := db.scanPlexToken(rows)
+		if errors.Is(err, errDecryptToken) {
+			slog.Warn("Skipping Plex token that can't be decrypted", "user_id", tok.UserID, "error", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *tok)
+	}
+	return tokens, rows.Err()
+}
+
+// SetPlexTokenValid records the outcome of using or validating a user's token
+func (db *sqlDB) SetPlexTokenValid(ctx context.Context, userID int, valid bool) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE plex_tokens
+		SET is_valid = $2,
+		    validated_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP ELSE validated_at END,
+		    invalidated_at = CASE WHEN $2 THEN NULL ELSE CURRENT_TIMESTAMP END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1`,
+		userID, valid)
+	return err
+}
+
+// RotatePlexTokenKey re-encrypts every token not encrypted with the current
+// key, including plaintext ones, and returns how many were rotated
+func (db *sqlDB) RotatePlexTokenKey(ctx context.Context) (int, error) {
+	if !db.keyring.Enabled() {
+		return 0, fmt.Errorf("no token encryption key configured")
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT user_id, access_token, COALESCE(key_id, ''), COALESCE(data_key, '')
           FROM plex_tokens
-         WHERE user_id = $1`, userID)
-	err := row.Scan(&tok.UserID, &tok.AccessToken, &tok.CreatedAt, &tok.UpdatedAt)
-	return &tok, err
+         WHERE key_id IS NULL OR key_id <> $1`, db.keyring.CurrentKeyID())
+	if err != nil {
+		return 0, err
+	}
+	rotated := make(map[int]secrets.Sealed)
+	for rows.Next() {
+		var userID int
+		var sealed secrets.Sealed
+		if err := rows.Scan(&userID, &sealed.Ciphertext, &sealed.KeyID, &sealed.DataKey); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if sealed, err = db.keyring.Rotate(sealed); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to rotate token of user %d: %w", userID, err)
+		}
+		rotated[userID] = sealed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for userID, sealed := range rotated {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE plex_tokens
+			SET access_token = $2, key_id = $3, data_key = $4
+			WHERE user_id = $1`,
+			userID, sealed.Ciphertext, sealed.KeyID, sealed.DataKey); err != nil {
+			return 0, err
+		}
+	}
+	return len(rotated), tx.Commit()
+}
+
+// scanPlexToken reads and decrypts a token selected with plexTokenColumns
+func (db *sqlDB) scanPlexToken(row rowScanner) (*models.PlexToken, error) {
+	var tok models.PlexToken
+	var keyID, dataKey sql.NullString
+	var validatedAt, invalidatedAt sql.NullTime
+	err := row.Scan(&tok.UserID, &tok.AccessToken, &keyID, &dataKey, &tok.IsValid, &validatedAt, &invalidatedAt,
+		&tok.CreatedAt, &tok.UpdatedAt)
+	if err != nil {
+		return &tok, err
+	}
+	tok.ValidatedAt = nullTimePtr(validatedAt)
+	tok.InvalidatedAt = nullTimePtr(invalidatedAt)
+	tok.AccessToken, err = db.keyring.Open(secrets.Sealed{
+		KeyID:      keyID.String,
+		DataKey:    dataKey.String,
+		Ciphertext: tok.AccessToken,
+	})
+	if err != nil {
+		return &tok, fmt.Errorf("%w of user %d: %w", errDecryptToken, tok.UserID, err)
+	}
+	return &tok, nil
 }
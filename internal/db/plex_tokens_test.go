@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"testing"
+
+	"plefi/internal/secrets"
+)
+
+// newTestKeyring returns a keyring sealing with a new random key with the given ID
+func newTestKeyring(t *testing.T, id string) *secrets.Keyring {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := secrets.NewKeyring(id+":"+base64.StdEncoding.EncodeToString(key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+// newTestDB returns an in-memory database holding only the tables created by schema
+func newTestDB(t *testing.T, keyring *secrets.Keyring, schema string) *sqlDB {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetMaxOpenConns(1)
+	if _, err := conn.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return &sqlDB{conn: conn, driver: "sqlite3", keyring: keyring}
+}
+
+func TestGetAllPlexTokensSkipsUnknownKey(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, newTestKeyring(t, "current"), `
+        CREATE TABLE plex_tokens (
+            user_id        INTEGER PRIMARY KEY,
+            access_token   TEXT NOT NULL,
+            key_id         TEXT NULL,
+            data_key       TEXT NULL,
+            is_valid       BOOLEAN NOT NULL DEFAULT TRUE,
+            validated_at   TIMESTAMP NULL,
+            invalidated_at TIMESTAMP NULL,
+            created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            updated_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )`)
+
+	// A token sealed under a key that is no longer in the keyring
+	removed, err := newTestKeyring(t, "removed").Seal("lost-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.conn.Exec(`INSERT INTO plex_tokens(user_id, access_token, key_id, data_key) VALUES(1, ?, ?, ?)`,
+		removed.Ciphertext, removed.KeyID, removed.DataKey); err != nil {
+		t.Fatal(err)
+	}
+	current, err := db.keyring.Seal("good-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.conn.Exec(`INSERT INTO plex_tokens(user_id, access_token, key_id, data_key) VALUES(2, ?, ?, ?)`,
+		current.Ciphertext, current.KeyID, current.DataKey); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := db.GetAllPlexTokens(ctx)
+	if err != nil {
+		t.Fatalf("GetAllPlexTokens() error = %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].UserID != 2 || tokens[0].AccessToken != "good-token" {
+		t.Errorf("GetAllPlexTokens() = %+v, want only the token of user 2", tokens)
+	}
+
+	if _, err := db.GetPlexToken(ctx, 1); err == nil {
+		t.Error("GetPlexToken() of the unknown key succeeded, want an error")
+	}
+}
@@ -4,77 +4,61 @@ import (
 	"context"
 	"database/sql"
 	"plefi/internal/models"
+	"time"
 )
 
+// plexUserColumns are the plex_users columns read by scanPlexUser
+const plexUserColumns = `id, uuid, username, COALESCE(email, ''), is_admin, is_managed,
+               COALESCE(restriction_profile, ''), is_exempt, inactivity_warned_at,
+               inactivity_revoke_at, inactivity_warning_seen_at,
+               COALESCE(entitlement_name, ''), notes, referred_by, created_at, updated_at`
+
 func (db *sqlDB) SavePlexUser(ctx context.Context, user models.PlexUser) error {
 	_, err := db.conn.ExecContext(ctx, `
-    INSERT INTO plex_users(id, uuid, username, email, is_admin, notes)
-    VALUES($1, $2, $3, $4, $5, $6)
+    INSERT INTO plex_users(id, uuid, username, email, is_admin, notes, is_managed, restriction_profile)
+    VALUES($1, $2, $3, NULLIF($4, ''), $5, $6, $7, NULLIF($8, ''))
     ON CONFLICT(id) DO UPDATE SET
         uuid = $2,
         username = EXCLUDED.username,
         email = EXCLUDED.email,
         is_admin = EXCLUDED.is_admin,
         notes = EXCLUDED.notes,
+        is_managed = EXCLUDED.is_managed,
+        restriction_profile = EXCLUDED.restriction_profile,
         updated_at = CURRENT_TIMESTAMP;`,
 		user.ID, user.UUID, user.Username, user.Email, user.IsAdmin, user.Notes,
+		user.IsManaged, user.RestrictionProfile,
 	)
 	return err
 }
 
 func (db *sqlDB) GetPlexUser(ctx context.Context, userID int) (*models.PlexUser, error) {
-	user := &models.PlexUser{}
-	var notes sql.NullString
-	err := db.conn.QueryRowContext(ctx, `
-        SELECT id, uuid, username, email, is_admin, notes, created_at, updated_at
+	user, err := scanPlexUser(db.conn.QueryRowContext(ctx, `
+        SELECT `+plexUserColumns+`
         FROM plex_users
         WHERE id = $1`,
-		userID).Scan(
-		&user.ID, &user.UUID, &user.Username, &user.Email,
-		&user.IsAdmin, &notes, &user.CreatedAt, &user.UpdatedAt,
-	)
+		userID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert NullString to *string
-	if notes.Valid {
-		user.Notes = notes.String
-	}
-	return user, nil
+	return user, err
 }
 
 func (db *sqlDB) GetPlexUserByEmail(ctx context.Context, email string) (*models.PlexUser, error) {
-	user := &models.PlexUser{}
-	var notes sql.NullString
-	err := db.conn.QueryRowContext(ctx, `
-        SELECT id, uuid, username, email, is_admin, notes, created_at, updated_at
+	user, err := scanPlexUser(db.conn.QueryRowContext(ctx, `
+        SELECT `+plexUserColumns+`
         FROM plex_users
         WHERE email = $1`,
-		email).Scan(
-		&user.ID, &user.UUID, &user.Username, &user.Email,
-		&user.IsAdmin, &notes, &user.CreatedAt, &user.UpdatedAt,
-	)
+		email))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert NullString to *string
-	if notes.Valid {
-		user.Notes = notes.String
-	}
-	return user, nil
+	return user, err
 }
 
 func (db *sqlDB) GetAllPlexUsers(ctx context.Context) ([]models.PlexUser, error) {
 	rows, err := db.conn.QueryContext(ctx, `
-        SELECT id, uuid, username, email, is_admin, notes, created_at, updated_at
+        SELECT `+plexUserColumns+`
         FROM plex_users
         ORDER BY username ASC`)
 	if err != nil {
@@ -84,25 +68,42 @@ func (db *sqlDB) GetAllPlexUsers(ctx context.Context) ([]models.PlexUser, error)
 
 	var users []models.PlexUser
 	for rows.Next() {
-		var user models.PlexUser
-		var notes sql.NullString
-		err := rows.Scan(
-			&user.ID, &user.UUID, &user.Username, &user.Email,
-			&user.IsAdmin, &notes, &user.CreatedAt, &user.UpdatedAt,
-		)
+		user, err := scanPlexUser(rows)
 		if err != nil {
 			return nil, err
 		}
-		// Convert NullString to *string
-		if notes.Valid {
-			user.Notes = notes.String
-		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	return users, rows.Err()
 }
 
+// scanPlexUser reads a user selected with plexUserColumns
+func scanPlexUser(row rowScanner) (*models.PlexUser, error) {
+	user := &models.PlexUser{}
+	var notes sql.NullString
+	var warnedAt, revokeAt, seenAt sql.NullTime
+	var referredBy sql.NullInt64
+	if err := row.Scan(
+		&user.ID, &user.UUID, &user.Username, &user.Email, &user.IsAdmin, &user.IsManaged,
+		&user.RestrictionProfile, &user.IsExempt, &warnedAt, &revokeAt, &seenAt,
+		&user.EntitlementName, &notes, &referredBy, &user.CreatedAt, &user.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if notes.Valid {
+		user.Notes = notes.String
+	}
+	user.InactivityWarnedAt = nullTimePtr(warnedAt)
+	user.InactivityRevokeAt = nullTimePtr(revokeAt)
+	user.InactivityWarningSeenAt = nullTimePtr(seenAt)
+	if referredBy.Valid {
+		id := int(referredBy.Int64)
+		user.ReferredBy = &id
+	}
+	return user, nil
+}
+
 func (db *sqlDB) DeletePlexUser(ctx context.Context, userID int) error {
 	// First delete user-related records in dependent tables
 	_, err := db.conn.ExecContext(ctx, `
@@ -117,6 +118,12 @@ func (db *sqlDB) DeletePlexUser(ctx context.Context, userID int) error {
 		return err
 	}
 
+	_, err = db.conn.ExecContext(ctx, `
+		DELETE FROM plex_shares WHERE user_id = $1;`, userID)
+	if err != nil {
+		return err
+	}
+
 	// Finally delete the user record
 	_, err = db.conn.ExecContext(ctx, `
 		DELETE FROM plex_users WHERE id = $1;`, userID)
@@ -132,3 +139,52 @@ func (db *sqlDB) UpdateUserNotes(ctx context.Context, userID int, notes string)
 		userID, notes)
 	return err
 }
+
+// SetUserExempt sets whether a user is exempt from the inactivity policy
+func (db *sqlDB) SetUserExempt(ctx context.Context, userID int, exempt bool) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE plex_users
+		SET is_exempt = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		userID, exempt)
+	return err
+}
+
+// SetInactivityWarnedAt records when a user was warned about inactivity and
+// when they are revoked, or clears the warning when warnedAt is nil. The new
+// warning is yet to be shown to the user.
+func (db *sqlDB) SetInactivityWarnedAt(ctx context.Context, userID int, warnedAt, revokeAt *time.Time) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE plex_users
+		SET inactivity_warned_at = $2,
+		    inactivity_revoke_at = $3,
+		    inactivity_warning_seen_at = NULL,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		userID, warnedAt, revokeAt)
+	return err
+}
+
+// SetInactivityWarningSeen records when a user was shown their inactivity
+// warning, along with the revoke date shown to them. Warnings already seen
+// are left alone.
+func (db *sqlDB) SetInactivityWarningSeen(ctx context.Context, userID int, seenAt time.Time, revokeAt *time.Time) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE plex_users
+		SET inactivity_warning_seen_at = $2,
+		    inactivity_revoke_at = $3,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND inactivity_warned_at IS NOT NULL AND inactivity_warning_seen_at IS NULL`,
+		userID, seenAt, revokeAt)
+	return err
+}
+
+// SetUserEntitlement records the entitlement of the plan a user was given access through
+func (db *sqlDB) SetUserEntitlement(ctx context.Context, userID int, entitlementName string) error {
+	_, err := db.conn.ExecContext(ctx, `
+		UPDATE plex_users
+		SET entitlement_name = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		userID, entitlementName)
+	return err
+}
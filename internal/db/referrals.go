@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"plefi/internal/models"
+)
+
+// GetReferralCode returns the referral code of a user, assigning one drawn
+// from generate when they don't have one yet
+func (db *sqlDB) GetReferralCode(ctx context.Context, userID int, generate func() (string, error)) (string, error) {
+	var code sql.NullString
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT referral_code FROM plex_users WHERE id = $1`,
+		userID).Scan(&code)
+	if err != nil {
+		return "", err
+	}
+	if code.Valid {
+		return code.String, nil
+	}
+
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		candidate, err := generate()
+		if err != nil {
+			return "", err
+		}
+		// COALESCE keeps a code assigned by a concurrent request
+		var assigned string
+		err = db.conn.QueryRowContext(ctx, `
+			UPDATE plex_users
+			SET referral_code = COALESCE(referral_code, $2)
+			WHERE id = $1
+			  AND NOT EXISTS (SELECT 1 FROM plex_users WHERE referral_code = $2)
+			RETURNING referral_code`,
+			userID, candidate).Scan(&assigned)
+		if err == nil {
+			return assigned, nil
+		}
+		if err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+	return "", models.ErrReferralCodeTaken
+}
+
+// GetPlexUserByReferralCode retrieves the user a referral code belongs to
+func (db *sqlDB) GetPlexUserByReferralCode(ctx context.Context, code string) (*models.PlexUser, error) {
+	user, err := scanPlexUser(db.conn.QueryRowContext(ctx, `
+        SELECT `+plexUserColumns+`
+        FROM plex_users
+        WHERE referral_code = $1`,
+		code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+// SetReferrer records who referred a user and reports whether it was
+// recorded. A user is only ever referred once, and never by themselves.
+func (db *sqlDB) SetReferrer(ctx context.Context, userID, referrerID int) (bool, error) {
+	result, err := db.conn.ExecContext(ctx, `
+		UPDATE plex_users
+		SET referred_by = $2, referred_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND id <> $2 AND referred_by IS NULL`,
+		userID, referrerID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CountReferrals returns how many users a user has referred
+func (db *sqlDB) CountReferrals(ctx context.Context, referrerID int) (int, error) {
+	var count int
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM plex_users WHERE referred_by = $1`,
+		referrerID).Scan(&count)
+	return count, err
+}
+
+// referralRewardColumns are the referral_rewards columns read by scanReferralReward
+const referralRewardColumns = `id, referrer_id, referred_id, invoice_id, reward_type, amount,
+               COALESCE(currency, ''), COALESCE(coupon_id, ''), created_at`
+
+// GetReferralReward retrieves the reward earned by a referred user paying, if any
+func (db *sqlDB) GetReferralReward(ctx context.Context, referredID int) (*models.ReferralReward, error) {
+	reward, err := scanReferralReward(db.conn.QueryRowContext(ctx, `
+        SELECT `+referralRewardColumns+`
+        FROM referral_rewards
+        WHERE referred_id = $1`,
+		referredID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return reward, err
+}
+
+// SaveReferralReward records a reward. A referred user earns a single reward,
+// so a reward recorded for them already is kept.
+func (db *sqlDB) SaveReferralReward(ctx context.Context, reward models.ReferralReward) error {
+	_, err := db.conn.ExecContext(ctx, `
+		INSERT INTO referral_rewards(referrer_id, referred_id, invoice_id, reward_type, amount, currency, coupon_id)
+		VALUES($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''))
+		ON CONFLICT (referred_id) DO NOTHING`,
+		reward.ReferrerID, reward.ReferredID, reward.InvoiceID, reward.RewardType,
+		reward.Amount, reward.Currency, reward.CouponID)
+	return err
+}
+
+// GetReferralRewards retrieves the rewards a user has earned, newest first
+func (db *sqlDB) GetReferralRewards(ctx context.Context, referrerID int) ([]models.ReferralReward, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT `+referralRewardColumns+`
+        FROM referral_rewards
+        WHERE referrer_id = $1
+        ORDER BY created_at DESC`,
+		referrerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rewards := make([]models.ReferralReward, 0)
+	for rows.Next() {
+		reward, err := scanReferralReward(rows)
+		if err != nil {
+			return nil, err
+		}
+		rewards = append(rewards, *reward)
+	}
+	return rewards, rows.Err()
+}
+
+// scanReferralReward reads a reward selected with referralRewardColumns
+func scanReferralReward(row rowScanner) (*models.ReferralReward, error) {
+	reward := &models.ReferralReward{}
+	var referredID sql.NullInt64
+	if err := row.Scan(
+		&reward.ID, &reward.ReferrerID, &referredID, &reward.InvoiceID, &reward.RewardType,
+		&reward.Amount, &reward.Currency, &reward.CouponID, &reward.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if referredID.Valid {
+		id := int(referredID.Int64)
+		reward.ReferredID = &id
+	}
+	return reward, nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"plefi/internal/models"
+)
+
+// SaveStreamEnforcement records a terminated stream
+func (db *sqlDB) SaveStreamEnforcement(ctx context.Context, enforcement models.StreamEnforcement) error {
+	_, err := db.conn.ExecContext(ctx, `
+    INSERT INTO stream_enforcements(user_id, username, machine_identifier, session_id, title, player,
+                                    active_streams, max_streams, message)
+    VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9);`,
+		enforcement.UserID, enforcement.Username, enforcement.MachineIdentifier, enforcement.SessionID,
+		enforcement.Title, enforcement.Player, enforcement.ActiveStreams, enforcement.MaxStreams, enforcement.Message,
+	)
+	return err
+}
+
+// GetStreamEnforcements retrieves the most recent terminated streams
+func (db *sqlDB) GetStreamEnforcements(ctx context.Context, limit int) ([]models.StreamEnforcement, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+        SELECT id, user_id, username, machine_identifier, session_id, title, player,
+               active_streams, max_streams, message, created_at
+        FROM stream_enforcements
+        ORDER BY created_at DESC
+        LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var enforcements []models.StreamEnforcement
+	for rows.Next() {
+		var e models.StreamEnforcement
+		if err := rows.Scan(
+			&e.ID, &e.UserID, &e.Username, &e.MachineIdentifier, &e.SessionID, &e.Title, &e.Player,
+			&e.ActiveStreams, &e.MaxStreams, &e.Message, &e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		enforcements = append(enforcements, e)
+	}
+	return enforcements, rows.Err()
+}
@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services"
+	"plefi/internal/services/plex"
+	"time"
+)
+
+// InactivityJob is the name of the job that enforces the inactivity policy
+const InactivityJob = "inactivity"
+
+// EnforceInactivity returns a job that warns inactive users and revokes the
+// access of users that stayed inactive after seeing the warning, according to
+// config.C.Inactivity. Warnings are shown to users when they next visit.
+func EnforceInactivity(plexService plex.PlexServicer, stripeService services.StripeServicer) JobFunc {
+	return func(ctx context.Context) error {
+		report, err := InactivityReport(ctx, plexService, stripeService, time.Now())
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		now := time.Now()
+		for _, user := range report.Users {
+			switch user.Action {
+			case models.InactivityActionWarn:
+				if err := db.DB.SetInactivityWarnedAt(ctx, user.UserID, &now, user.RevokeAt); err != nil {
+					errs = append(errs, fmt.Errorf("failed to warn user %d: %w", user.UserID, err))
+					continue
+				}
+				slog.Info("Warned inactive Plex user", "user_id", user.UserID, "username", user.Username, "inactive_days", user.InactiveDays)
+			case models.InactivityActionRevoke:
+				if err := revokeAllServers(ctx, plexService, user.UserID); err != nil {
+					errs = append(errs, fmt.Errorf("failed to revoke user %d: %w", user.UserID, err))
+					continue
+				}
+				if err := db.DB.SetInactivityWarnedAt(ctx, user.UserID, nil, nil); err != nil {
+					errs = append(errs, fmt.Errorf("failed to clear warning of user %d: %w", user.UserID, err))
+				}
+				slog.Info("Revoked inactive Plex user", "user_id", user.UserID, "username", user.Username, "inactive_days", user.InactiveDays)
+			case models.InactivityActionClear:
+				if err := db.DB.SetInactivityWarnedAt(ctx, user.UserID, nil, nil); err != nil {
+					errs = append(errs, fmt.Errorf("failed to clear warning of user %d: %w", user.UserID, err))
+					continue
+				}
+				slog.Info("Cleared inactivity warning of active Plex user", "user_id", user.UserID, "username", user.Username)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// InactivityReport evaluates the inactivity policy at the given time without
+// acting on it. Admins, exempt users, subscribers and users without a share
+// are never included. Warned users are only revoked once they have been shown
+// the warning and its revoke date has passed.
+func InactivityReport(
+	ctx context.Context,
+	plexService plex.PlexServicer,
+	stripeService services.StripeServicer,
+	now time.Time,
+) (*models.InactivityReport, error) {
+	policy := config.C.Inactivity
+	report := &models.InactivityReport{
+		WarnDays:   policy.WarnDays,
+		RevokeDays: policy.RevokeDays,
+		Users:      []models.InactiveUser{},
+	}
+	if !policy.Enabled() {
+		return report, nil
+	}
+
+	users, err := db.DB.GetAllPlexUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Plex users: %w", err)
+	}
+	plexUsers, err := plexService.GetUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Plex users: %w", err)
+	}
+	sessionTimes, err := db.DB.GetLastPlexSessionTimes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session history: %w", err)
+	}
+	// Never revoke subscribers because Stripe couldn't be reached
+	subscribers := map[int]bool{}
+	if config.C.Stripe.SecretKey != "" {
+		if subscribers, err = stripeService.GetSubscriberIDs(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get subscribers: %w", err)
+		}
+	}
+
+	lastSeen := make(map[int]time.Time)
+	shared := make(map[int]bool)
+	for _, plexUser := range plexUsers {
+		for _, server := range plexUser.Servers {
+			if _, ok := config.C.Plex.Server(server.MachineIdentifier); !ok {
+				continue
+			}
+			shared[plexUser.ID] = true
+			if seen := server.LastSeen(); seen != nil && seen.After(lastSeen[plexUser.ID]) {
+				lastSeen[plexUser.ID] = *seen
+			}
+		}
+	}
+
+	for _, user := range users {
+		if !shared[user.ID] || user.IsAdmin || user.ID == config.C.Plex.AdminUserID ||
+			user.IsExempt || subscribers[user.ID] {
+			continue
+		}
+
+		lastActive := user.CreatedAt
+		if seen := lastSeen[user.ID]; seen.After(lastActive) {
+			lastActive = seen
+		}
+		if seen := sessionTimes[user.ID]; seen.After(lastActive) {
+			lastActive = seen
+		}
+		inactiveDays := int(now.Sub(lastActive).Hours() / 24)
+
+		// A warning is void once the user has been active again
+		warnedAt, seenAt, revokeAt := user.InactivityWarnedAt, user.InactivityWarningSeenAt, user.InactivityRevokeAt
+		if warnedAt != nil && lastActive.After(*warnedAt) {
+			warnedAt, seenAt, revokeAt = nil, nil, nil
+		}
+
+		action := ""
+		switch {
+		case policy.RevokeDays > 0 && inactiveDays >= policy.RevokeDays && policy.WarnDays == 0:
+			action = models.InactivityActionRevoke
+		case policy.RevokeDays > 0 && inactiveDays >= policy.RevokeDays && seenAt != nil &&
+			(revokeAt == nil || !now.Before(*revokeAt)):
+			action = models.InactivityActionRevoke
+		case policy.WarnDays > 0 && inactiveDays >= policy.WarnDays && warnedAt == nil:
+			action = models.InactivityActionWarn
+			if policy.RevokeDays > 0 {
+				at := lastActive.AddDate(0, 0, policy.RevokeDays)
+				revokeAt = &at
+			}
+		case user.InactivityWarnedAt != nil && warnedAt == nil:
+			action = models.InactivityActionClear
+		}
+		if action == "" {
+			continue
+		}
+		report.Users = append(report.Users, models.InactiveUser{
+			UserID:       user.ID,
+			Username:     user.Username,
+			Email:        user.Email,
+			LastActiveAt: lastActive,
+			InactiveDays: inactiveDays,
+			WarnedAt:     warnedAt,
+			SeenAt:       seenAt,
+			RevokeAt:     revokeAt,
+			Action:       action,
+		})
+	}
+	return report, nil
+}
+
+// revokeAllServers removes a user's access to every configured server
+func revokeAllServers(ctx context.Context, plexService plex.PlexServicer, userID int) error {
+	for _, server := range config.C.Plex.Servers {
+		if err := plexService.UnshareLibrary(ctx, server.MachineIdentifier, userID); err != nil {
+			return fmt.Errorf("server %s: %w", server.Name, err)
+		}
+		if err := db.DB.DeletePlexShare(ctx, userID, server.MachineIdentifier); err != nil {
+			slog.Error("Failed to delete Plex share", "error", err, "user_id", userID, "server", server.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services"
+	"plefi/internal/services/plex"
+)
+
+// fakeDB serves the users and session history read by InactivityReport. Any
+// other method panics.
+type fakeDB struct {
+	db.Database
+	users        []models.PlexUser
+	sessionTimes map[int]time.Time
+}
+
+func (f *fakeDB) GetAllPlexUsers(ctx context.Context) ([]models.PlexUser, error) {
+	return f.users, nil
+}
+
+func (f *fakeDB) GetLastPlexSessionTimes(ctx context.Context) (map[int]time.Time, error) {
+	return f.sessionTimes, nil
+}
+
+// fakePlex serves the users shared with Plex servers. Any other method panics.
+type fakePlex struct {
+	plex.PlexServicer
+	users []plex.PlexUser
+}
+
+func (f *fakePlex) GetUsers(ctx context.Context) ([]plex.PlexUser, error) {
+	return f.users, nil
+}
+
+// fakeStripe serves the IDs of subscribed users. Any other method panics.
+type fakeStripe struct {
+	services.StripeServicer
+	subscribers map[int]bool
+	err         error
+}
+
+func (f *fakeStripe) GetSubscriberIDs(ctx context.Context) (map[int]bool, error) {
+	return f.subscribers, f.err
+}
+
+const (
+	testServerID  = "main-server"
+	testUserID    = 10
+	testAdminID   = 1
+	testCreatedAt = 365 // Days before now the user was created
+)
+
+func TestInactivityReport(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	timeAgo := func(days int) *time.Time {
+		at := daysAgo(days)
+		return &at
+	}
+
+	warnAndRevoke := config.InactivityConfig{WarnDays: 30, RevokeDays: 60}
+	tests := []struct {
+		name       string
+		policy     config.InactivityConfig
+		user       models.PlexUser
+		server     string     // Server the user is shared with, none when empty
+		lastSeen   *time.Time // Last seen on the server
+		session    *time.Time // Last session in the history
+		subscriber bool
+		stripe     bool // Whether Stripe is configured
+		wantAction string
+		wantDays   int
+		wantRevoke *time.Time // Revoke date of a new warning
+	}{
+		{
+			name:   "policy disabled",
+			policy: config.InactivityConfig{},
+			user:   models.PlexUser{ID: testUserID},
+			server: testServerID,
+		},
+		{
+			name:       "inactive user is warned",
+			policy:     warnAndRevoke,
+			user:       models.PlexUser{ID: testUserID},
+			server:     testServerID,
+			lastSeen:   timeAgo(40),
+			wantAction: models.InactivityActionWarn,
+			wantDays:   40,
+			wantRevoke: timeAgo(-20),
+		},
+		{
+			name:     "active user",
+			policy:   warnAndRevoke,
+			user:     models.PlexUser{ID: testUserID},
+			server:   testServerID,
+			lastSeen: timeAgo(5),
+		},
+		{
+			name:     "recent session counts as activity",
+			policy:   warnAndRevoke,
+			user:     models.PlexUser{ID: testUserID},
+			server:   testServerID,
+			lastSeen: timeAgo(90),
+			session:  timeAgo(3),
+		},
+		{
+			name:       "never seen user counts from creation",
+			policy:     warnAndRevoke,
+			user:       models.PlexUser{ID: testUserID, CreatedAt: daysAgo(35)},
+			server:     testServerID,
+			wantAction: models.InactivityActionWarn,
+			wantDays:   35,
+		},
+		{
+			name:       "unwarned user is warned before being revoked",
+			policy:     warnAndRevoke,
+			user:       models.PlexUser{ID: testUserID},
+			server:     testServerID,
+			lastSeen:   timeAgo(90),
+			wantAction: models.InactivityActionWarn,
+			wantDays:   90,
+		},
+		{
+			name:   "warned user is revoked after seeing the warning",
+			policy: warnAndRevoke,
+			user: models.PlexUser{ID: testUserID, InactivityWarnedAt: timeAgo(30),
+				InactivityWarningSeenAt: timeAgo(29), InactivityRevokeAt: timeAgo(1)},
+			server:     testServerID,
+			lastSeen:   timeAgo(90),
+			wantAction: models.InactivityActionRevoke,
+			wantDays:   90,
+		},
+		{
+			name:     "warned user who hasn't seen the warning isn't revoked",
+			policy:   warnAndRevoke,
+			user:     models.PlexUser{ID: testUserID, InactivityWarnedAt: timeAgo(30), InactivityRevokeAt: timeAgo(1)},
+			server:   testServerID,
+			lastSeen: timeAgo(90),
+		},
+		{
+			name:   "warned user isn't revoked before the revoke date",
+			policy: warnAndRevoke,
+			user: models.PlexUser{ID: testUserID, InactivityWarnedAt: timeAgo(30),
+				InactivityWarningSeenAt: timeAgo(1), InactivityRevokeAt: timeAgo(-1)},
+			server:   testServerID,
+			lastSeen: timeAgo(90),
+		},
+		{
+			name:       "warning is cleared after activity",
+			policy:     warnAndRevoke,
+			user:       models.PlexUser{ID: testUserID, InactivityWarnedAt: timeAgo(20), InactivityWarningSeenAt: timeAgo(19)},
+			server:     testServerID,
+			lastSeen:   timeAgo(5),
+			wantAction: models.InactivityActionClear,
+			wantDays:   5,
+		},
+		{
+			name:     "warned user isn't warned again",
+			policy:   warnAndRevoke,
+			user:     models.PlexUser{ID: testUserID, InactivityWarnedAt: timeAgo(5)},
+			server:   testServerID,
+			lastSeen: timeAgo(45),
+		},
+		{
+			name:       "warning is void after activity",
+			policy:     warnAndRevoke,
+			user:       models.PlexUser{ID: testUserID, InactivityWarnedAt: timeAgo(70)},
+			server:     testServerID,
+			session:    timeAgo(65),
+			wantAction: models.InactivityActionWarn,
+			wantDays:   65,
+		},
+		{
+			name:       "revoked without warning when warnings are off",
+			policy:     config.InactivityConfig{RevokeDays: 60},
+			user:       models.PlexUser{ID: testUserID},
+			server:     testServerID,
+			lastSeen:   timeAgo(61),
+			wantAction: models.InactivityActionRevoke,
+			wantDays:   61,
+		},
+		{
+			name:     "only warned when revoking is off",
+			policy:   config.InactivityConfig{WarnDays: 30},
+			user:     models.PlexUser{ID: testUserID, InactivityWarnedAt: timeAgo(30), InactivityWarningSeenAt: timeAgo(30)},
+			server:   testServerID,
+			lastSeen: timeAgo(200),
+		},
+		{
+			name:   "user without a share",
+			policy: warnAndRevoke,
+			user:   models.PlexUser{ID: testUserID},
+		},
+		{
+			name:   "user shared with another server",
+			policy: warnAndRevoke,
+			user:   models.PlexUser{ID: testUserID},
+			server: "other-server",
+		},
+		{
+			name:   "admin",
+			policy: warnAndRevoke,
+			user:   models.PlexUser{ID: testUserID, IsAdmin: true},
+			server: testServerID,
+		},
+		{
+			name:   "configured admin",
+			policy: warnAndRevoke,
+			user:   models.PlexUser{ID: testAdminID},
+			server: testServerID,
+		},
+		{
+			name:   "exempt user",
+			policy: warnAndRevoke,
+			user:   models.PlexUser{ID: testUserID, IsExempt: true},
+			server: testServerID,
+		},
+		{
+			name:       "subscriber",
+			policy:     warnAndRevoke,
+			user:       models.PlexUser{ID: testUserID},
+			server:     testServerID,
+			subscriber: true,
+			stripe:     true,
+		},
+		{
+			name:       "subscribers ignored without Stripe",
+			policy:     warnAndRevoke,
+			user:       models.PlexUser{ID: testUserID},
+			server:     testServerID,
+			subscriber: true,
+			wantAction: models.InactivityActionWarn,
+			wantDays:   testCreatedAt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupInactivity(t, tt.policy, tt.stripe)
+			if tt.user.CreatedAt.IsZero() {
+				tt.user.CreatedAt = daysAgo(testCreatedAt)
+			}
+			db.DB = &fakeDB{users: []models.PlexUser{tt.user}, sessionTimes: map[int]time.Time{}}
+			if tt.session != nil {
+				db.DB.(*fakeDB).sessionTimes[tt.user.ID] = *tt.session
+			}
+			plexUser := plex.PlexUser{ID: tt.user.ID}
+			if tt.server != "" {
+				server := plex.PlexServer{MachineIdentifier: tt.server}
+				if tt.lastSeen != nil {
+					server.LastSeenAt = strconv.FormatInt(tt.lastSeen.Unix(), 10)
+				}
+				plexUser.Servers = []plex.PlexServer{server}
+			}
+			stripe := &fakeStripe{subscribers: map[int]bool{}}
+			if !tt.stripe {
+				stripe.err = errors.New("Stripe isn't configured")
+			}
+			if tt.subscriber {
+				stripe.subscribers[tt.user.ID] = true
+			}
+
+			report, err := InactivityReport(context.Background(), &fakePlex{users: []plex.PlexUser{plexUser}}, stripe, now)
+			if err != nil {
+				t.Fatalf("InactivityReport() error = %v", err)
+			}
+			if tt.wantAction == "" {
+				if len(report.Users) != 0 {
+					t.Errorf("InactivityReport() users = %+v, want none", report.Users)
+				}
+				return
+			}
+			if len(report.Users) != 1 {
+				t.Fatalf("InactivityReport() users = %+v, want user %d", report.Users, tt.user.ID)
+			}
+			got := report.Users[0]
+			if got.UserID != tt.user.ID || got.Action != tt.wantAction || got.InactiveDays != tt.wantDays {
+				t.Errorf("InactivityReport() user = %+v, want action %q after %d days", got, tt.wantAction, tt.wantDays)
+			}
+			if tt.wantRevoke != nil && (got.RevokeAt == nil || !got.RevokeAt.Equal(*tt.wantRevoke)) {
+				t.Errorf("InactivityReport() revoke at = %v, want %v", got.RevokeAt, *tt.wantRevoke)
+			}
+		})
+	}
+}
+
+func TestInactivityReportStripeError(t *testing.T) {
+	setupInactivity(t, config.InactivityConfig{WarnDays: 30}, true)
+	db.DB = &fakeDB{users: []models.PlexUser{{ID: testUserID}}}
+	plexService := &fakePlex{users: []plex.PlexUser{{ID: testUserID, Servers: []plex.PlexServer{{MachineIdentifier: testServerID}}}}}
+	stripe := &fakeStripe{err: errors.New("unreachable")}
+
+	// Users mustn't lose access because subscriptions couldn't be checked
+	if _, err := InactivityReport(context.Background(), plexService, stripe, time.Now()); err == nil {
+		t.Error("InactivityReport() succeeded without subscribers, want an error")
+	}
+}
+
+// setupInactivity configures the inactivity policy and a single Plex server
+// for a test, restoring the previous configuration and database afterwards
+func setupInactivity(t *testing.T, policy config.InactivityConfig, stripe bool) {
+	t.Helper()
+	previous, previousDB := config.C, db.DB
+	t.Cleanup(func() { config.C, db.DB = previous, previousDB })
+
+	config.C.Inactivity = policy
+	config.C.Plex.AdminUserID = testAdminID
+	config.C.Plex.Servers = []config.PlexServerConfig{{Name: "Main", MachineIdentifier: testServerID}}
+	config.C.Stripe.SecretKey = ""
+	if stripe {
+		config.C.Stripe.SecretKey = "sk_test"
+	}
+}
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/services"
+	"plefi/internal/services/plex"
+	"time"
+)
+
+// InviteAccessExpiryJob is the name of the job that revokes access granted by invite codes once it ends
+const InviteAccessExpiryJob = "invite-access-expiry"
+
+// ExpireInviteAccess returns a job that unshares every server from users whose
+// access granted by invite codes has ended. Admins and users with an active
+// subscription keep their access.
+func ExpireInviteAccess(plexService plex.PlexServicer, stripeService services.StripeServicer) JobFunc {
+	return func(ctx context.Context) error {
+		invites, err := db.DB.GetEndedInviteAccess(ctx, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to get ended invite access: %w", err)
+		}
+		if len(invites) == 0 {
+			return nil
+		}
+
+		// Never revoke subscribers because Stripe couldn't be reached
+		subscribers := map[int]bool{}
+		if config.C.Stripe.SecretKey != "" {
+			if subscribers, err = stripeService.GetSubscriberIDs(ctx); err != nil {
+				return fmt.Errorf("failed to get subscribers: %w", err)
+			}
+		}
+
+		var errs []error
+		revoked := make(map[int]bool)
+		for _, invite := range invites {
+			if invite.UserID == config.C.Plex.AdminUserID || subscribers[invite.UserID] {
+				slog.Debug("Invite access ended but user keeps access", "user_id", invite.UserID, "invite_code", invite.InviteCode)
+				continue
+			}
+			if !revoked[invite.UserID] {
+				if err := revokeAllServers(ctx, plexService, invite.UserID); err != nil {
+					errs = append(errs, fmt.Errorf("failed to revoke user %d: %w", invite.UserID, err))
+					continue
+				}
+				revoked[invite.UserID] = true
+				slog.Info("Revoked Plex access granted by invite code",
+					"user_id", invite.UserID,
+					"invite_code", invite.InviteCode,
+					"access_ended_at", invite.AccessEndsAt)
+			}
+			if err := db.DB.SetInviteAccessRevoked(ctx, invite.ID); err != nil {
+				errs = append(errs, fmt.Errorf("failed to record revoked invite %d: %w", invite.ID, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
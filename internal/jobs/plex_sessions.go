@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services/plex"
+)
+
+// PlexSessionPollJob is the name of the job that records active Plex sessions
+const PlexSessionPollJob = "plex-session-poll"
+
+// PollPlexSessions returns a job that reads the active sessions of every
+// configured server and records them in the session history. A server that
+// can't be reached doesn't stop the others from being recorded.
+func PollPlexSessions(plexService plex.PlexServicer) JobFunc {
+	return func(ctx context.Context) error {
+		var errs []error
+		var sessions []models.PlexSession
+		for _, server := range config.C.Plex.Servers {
+			serverSessions, err := plexService.GetSessions(ctx, server.MachineIdentifier)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to fetch sessions of %s: %w", server.Name, err))
+				continue
+			}
+			sessions = append(sessions, SessionsFromPlex(server, serverSessions)...)
+		}
+
+		if err := db.DB.SavePlexSessions(ctx, sessions); err != nil {
+			return fmt.Errorf("failed to save Plex sessions: %w", err)
+		}
+		slog.Debug("Polled Plex sessions", "sessions", len(sessions))
+		return errors.Join(errs...)
+	}
+}
+
+// SessionsFromPlex converts the sessions reported by a server into session records
+func SessionsFromPlex(server config.PlexServerConfig, sessions []plex.PlexSession) []models.PlexSession {
+	result := make([]models.PlexSession, len(sessions))
+	for i, session := range sessions {
+		result[i] = models.PlexSession{
+			SessionID:         session.Session.ID,
+			Server:            server.Name,
+			MachineIdentifier: server.MachineIdentifier,
+			UserID:            session.UserID(),
+			Username:          session.User.Title,
+			Title:             session.DisplayTitle(),
+			Type:              session.Type,
+			Player:            session.Player.Title,
+			Platform:          session.Player.Platform,
+			State:             session.Player.State,
+			Decision:          session.Decision(),
+			Bandwidth:         session.Session.Bandwidth,
+			Local:             session.Player.Local,
+		}
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services/plex"
+)
+
+// PlexShareSyncJob is the name of the job that persists Plex shares
+const PlexShareSyncJob = "plex-share-sync"
+
+// SyncPlexShares returns a job that refreshes the Plex users list and stores
+// every user's shared servers in the plex_shares table.
+func SyncPlexShares(plexService plex.PlexServicer) JobFunc {
+	return func(ctx context.Context) error {
+		users, err := plexService.RefreshUsers(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch Plex users: %w", err)
+		}
+
+		shares := SharesFromUsers(users)
+		if err := db.DB.ReplacePlexShares(ctx, shares); err != nil {
+			return fmt.Errorf("failed to save Plex shares: %w", err)
+		}
+		slog.Info("Synced Plex shares", "users", len(users), "shares", len(shares))
+		return nil
+	}
+}
+
+// SharesFromUsers flattens the servers of each Plex user into share records
+func SharesFromUsers(users []plex.PlexUser) []models.PlexShare {
+	var shares []models.PlexShare
+	for _, user := range users {
+		for _, server := range user.Servers {
+			shares = append(shares, models.PlexShare{
+				UserID:            user.ID,
+				MachineIdentifier: server.MachineIdentifier,
+				SharedServerID:    server.ID,
+				NumLibraries:      server.NumLibraries,
+				AllLibraries:      server.AllLibraries == 1,
+				Pending:           server.Pending == 1,
+				LastSeenAt:        server.LastSeen(),
+			})
+		}
+	}
+	return shares
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"plefi/internal/db"
+	"plefi/internal/services/plex"
+)
+
+// PlexTokenValidationJob is the name of the job that validates stored Plex tokens
+const PlexTokenValidationJob = "plex-token-validation"
+
+// ValidatePlexTokens returns a job that checks every valid stored token against
+// plex.tv and marks the tokens Plex rejects as invalid. Invalid tokens stay
+// invalid until the user logs in again.
+func ValidatePlexTokens(plexService plex.PlexServicer) JobFunc {
+	return func(ctx context.Context) error {
+		tokens, err := db.DB.GetAllPlexTokens(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Plex tokens: %w", err)
+		}
+
+		var errs []error
+		invalid := 0
+		for _, token := range tokens {
+			if !token.IsValid {
+				continue
+			}
+			_, err := plexService.GetUserDetails(ctx, token.AccessToken)
+			switch {
+			case plex.IsUnauthorized(err):
+				invalid++
+				slog.Warn("Stored Plex token was rejected, marking it invalid", "user_id", token.UserID)
+				if err := db.DB.SetPlexTokenValid(ctx, token.UserID, false); err != nil {
+					errs = append(errs, fmt.Errorf("failed to mark token of user %d invalid: %w", token.UserID, err))
+				}
+			case err != nil:
+				errs = append(errs, fmt.Errorf("failed to validate token of user %d: %w", token.UserID, err))
+			default:
+				if err := db.DB.SetPlexTokenValid(ctx, token.UserID, true); err != nil {
+					errs = append(errs, fmt.Errorf("failed to mark token of user %d valid: %w", token.UserID, err))
+				}
+			}
+		}
+		slog.Info("Validated Plex tokens", "tokens", len(tokens), "invalid", invalid)
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// JobFunc is a unit of background work run by the Scheduler
+type JobFunc func(ctx context.Context) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      JobFunc
+	trigger  chan struct{}
+}
+
+// Scheduler runs registered jobs periodically in the background
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+// NewScheduler creates a new Scheduler instance
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		jobs: make(map[string]*job),
+	}
+}
+
+// Register adds a job that runs on start and then every interval. Jobs with a
+// non-positive interval are disabled.
+func (s *Scheduler) Register(name string, interval time.Duration, run JobFunc) {
+	if interval <= 0 {
+		slog.Info("Background job disabled", "job", name)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = &job{
+		name:     name,
+		interval: interval,
+		run:      run,
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Start launches all registered jobs
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.started = true
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+}
+
+// Trigger asks a job to run as soon as possible, outside its regular schedule
+func (s *Scheduler) Trigger(name string) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+		// A run is already pending
+	}
+}
+
+// Stop cancels all running jobs and waits for them to exit
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+	slog.Info("Background job started", "job", j.name, "interval", j.interval)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	s.runOnce(ctx, j)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-j.trigger:
+		}
+		s.runOnce(ctx, j)
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, j *job) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Background job panicked", "job", j.name, "panic", r)
+		}
+	}()
+	if err := j.run(ctx); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("Background job failed", "job", j.name, "error", err, "duration", time.Since(start))
+		return
+	}
+	slog.Debug("Background job completed", "job", j.name, "duration", time.Since(start))
+}
@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"plefi/internal/config"
+	"plefi/internal/db"
+	"plefi/internal/models"
+	"plefi/internal/services/plex"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// StreamLimitJob is the name of the job that enforces concurrent stream limits
+const StreamLimitJob = "stream-limits"
+
+// activeStream is a session along with when the enforcer first saw it
+type activeStream struct {
+	models.PlexSession
+	sessionKey int
+	firstSeen  time.Time
+}
+
+// EnforceStreamLimits returns a job that counts each user's sessions across
+// all servers and terminates their newest streams while they exceed the
+// max_streams of their plan. Admins and users without a limit are ignored.
+func EnforceStreamLimits(plexService plex.PlexServicer) JobFunc {
+	// Plex doesn't report when a session started, so remember when each was first seen
+	firstSeen := make(map[string]time.Time)
+
+	return func(ctx context.Context) error {
+		now := time.Now()
+		var errs []error
+		streams := make(map[int][]activeStream)
+		seen := make(map[string]time.Time)
+		for _, server := range config.C.Plex.Servers {
+			sessions, err := plexService.GetSessions(ctx, server.MachineIdentifier)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to fetch sessions of %s: %w", server.Name, err))
+				continue
+			}
+			for i, session := range SessionsFromPlex(server, sessions) {
+				key := server.MachineIdentifier + "/" + session.SessionID
+				if _, ok := firstSeen[key]; !ok {
+					firstSeen[key] = now
+				}
+				seen[key] = firstSeen[key]
+				sessionKey, _ := strconv.Atoi(sessions[i].SessionKey)
+				streams[session.UserID] = append(streams[session.UserID], activeStream{
+					PlexSession: session,
+					sessionKey:  sessionKey,
+					firstSeen:   firstSeen[key],
+				})
+			}
+		}
+		// Forget sessions that have ended, unless their server couldn't be reached
+		if len(errs) == 0 {
+			for key := range firstSeen {
+				if _, ok := seen[key]; !ok {
+					delete(firstSeen, key)
+				}
+			}
+		}
+
+		users, err := db.DB.GetAllPlexUsers(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get Plex users: %w", err)
+		}
+		for _, user := range users {
+			if user.IsAdmin || user.ID == config.C.Plex.AdminUserID {
+				continue
+			}
+			userStreams := streams[user.ID]
+			plan, ok := config.C.PlanForUser(user.EntitlementName)
+			if !ok || plan.MaxStreams <= 0 || len(userStreams) <= plan.MaxStreams {
+				continue
+			}
+
+			for _, stream := range newestStreams(userStreams, len(userStreams)-plan.MaxStreams) {
+				if err := terminateStream(ctx, plexService, user, stream, len(userStreams), plan.MaxStreams); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// newestStreams returns the n most recently started streams
+func newestStreams(streams []activeStream, n int) []activeStream {
+	sorted := append([]activeStream{}, streams...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].firstSeen.Equal(sorted[j].firstSeen) {
+			return sorted[i].firstSeen.After(sorted[j].firstSeen)
+		}
+		// Session keys increase on each server, so they break ties within a poll
+		return sorted[i].sessionKey > sorted[j].sessionKey
+	})
+	return sorted[:n]
+}
+
+// terminateStream stops a stream exceeding a user's limit and records the enforcement
+func terminateStream(
+	ctx context.Context,
+	plexService plex.PlexServicer,
+	user models.PlexUser,
+	stream activeStream,
+	activeStreams, maxStreams int,
+) error {
+	message := config.C.Plex.StreamLimitMessage
+	if err := plexService.TerminateSession(ctx, stream.MachineIdentifier, stream.SessionID, message); err != nil {
+		return fmt.Errorf("failed to terminate session %s of user %d: %w", stream.SessionID, user.ID, err)
+	}
+	slog.Info("Terminated stream exceeding plan limit",
+		"user_id", user.ID,
+		"username", user.Username,
+		"server", stream.Server,
+		"session_id", stream.SessionID,
+		"active_streams", activeStreams,
+		"max_streams", maxStreams)
+
+	if err := db.DB.SaveStreamEnforcement(ctx, models.StreamEnforcement{
+		UserID:            user.ID,
+		Username:          user.Username,
+		MachineIdentifier: stream.MachineIdentifier,
+		SessionID:         stream.SessionID,
+		Title:             stream.Title,
+		Player:            stream.Player,
+		ActiveStreams:     activeStreams,
+		MaxStreams:        maxStreams,
+		Message:           message,
+	}); err != nil {
+		slog.Error("Failed to record stream enforcement", "error", err, "user_id", user.ID, "session_id", stream.SessionID)
+	}
+	return nil
+}
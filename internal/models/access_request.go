@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Statuses of an access request
+const (
+	AccessRequestPending  = "pending"  // Waiting for an admin to review it
+	AccessRequestApproved = "approved" // Access was granted
+	AccessRequestRejected = "rejected" // Access was refused
+)
+
+var (
+	// ErrAccessRequestPending is returned when a user already has a request waiting for review
+	ErrAccessRequestPending = errors.New("an access request is already waiting for review")
+	// ErrAccessRequestReviewed is returned when reviewing a request that was already reviewed
+	ErrAccessRequestReviewed = errors.New("access request has already been reviewed")
+)
+
+// AccessRequest is a user's request to be given access without an invite
+// code or subscription
+type AccessRequest struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Username   string     `json:"username"`              // Populated from plex_users
+	Email      string     `json:"email,omitempty"`       // Populated from plex_users
+	Message    string     `json:"message"`               // Why the user wants access
+	Status     string     `json:"status"`                // Pending, approved or rejected
+	ReviewNote string     `json:"review_note,omitempty"` // Note from the admin who reviewed the request
+	ReviewedBy *int       `json:"reviewed_by,omitempty"` // Admin who reviewed the request
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Actions taken by the inactivity policy
+const (
+	InactivityActionWarn   = "warn"
+	InactivityActionRevoke = "revoke"
+	InactivityActionClear  = "clear" // The user was active again after being warned
+)
+
+// InactiveUser is a user the inactivity policy acts on
+type InactiveUser struct {
+	UserID       int        `json:"user_id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	LastActiveAt time.Time  `json:"last_active_at"` // Latest activity, or when the user joined if never seen
+	InactiveDays int        `json:"inactive_days"`
+	WarnedAt     *time.Time `json:"warned_at,omitempty"`
+	SeenAt       *time.Time `json:"seen_at,omitempty"`   // When the user was shown the warning
+	RevokeAt     *time.Time `json:"revoke_at,omitempty"` // When the user is revoked if still inactive
+	Action       string     `json:"action"`              // warn, revoke or clear
+}
+
+// InactivityWarning is the inactivity warning shown to a user
+type InactivityWarning struct {
+	WarnedAt time.Time  `json:"warned_at"`
+	RevokeAt *time.Time `json:"revoke_at,omitempty"` // When access is revoked unless the user watches something
+}
+
+// InactivityReport lists the users the inactivity policy warns or revokes
+type InactivityReport struct {
+	WarnDays   int            `json:"warn_days"`
+	RevokeDays int            `json:"revoke_days"`
+	Users      []InactiveUser `json:"users"`
+}
@@ -1,9 +1,41 @@
 package models
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Reasons an invite code can't be redeemed
+var (
+	ErrInviteCodeDisabled       = errors.New("invite code is disabled")
+	ErrInviteCodeExpired        = errors.New("invite code has expired")
+	ErrInviteCodeExhausted      = errors.New("invite code has reached its maximum number of uses")
+	ErrInviteCodeAlreadyClaimed = errors.New("invite code has already been claimed by this user")
+	ErrInviteCodeNotAllowed     = errors.New("invite code is not valid for this account")
+)
+
+// Statuses of an invite code
+const (
+	InviteCodeStatusActive    = "active"    // The code can be claimed
+	InviteCodeStatusDisabled  = "disabled"  // The code was disabled by an admin
+	InviteCodeStatusExpired   = "expired"   // The code's expiry date has passed
+	InviteCodeStatusExhausted = "exhausted" // The code has been used its maximum number of times
+)
+
+// AllowedUserIDPrefix marks an allowlist entry as a Plex account ID, so IDs
+// never match a username made of digits
+const AllowedUserIDPrefix = "id:"
+
+// AllowedUserID returns the allowlist entry of a Plex account ID
+func AllowedUserID(id int) string {
+	return AllowedUserIDPrefix + strconv.Itoa(id)
+}
+
+// ErrInviteCodeTaken is returned when no unused code could be generated
+var ErrInviteCodeTaken = errors.New("could not generate an unused invite code")
+
 // InviteCode represents an invitation code that grants access to Plex services
 type InviteCode struct {
 	ID              int        `json:"id"`
@@ -15,25 +47,79 @@ type InviteCode struct {
 	UsedCount       int        `json:"used_count"`
 	IsDisabled      bool       `json:"is_disabled"`
 	EntitlementName string     `json:"entitlement_name"`
-	Duration        *time.Time `json:"duration,omitempty"`
+	// DurationDays is how many days of access each claim grants, unlimited when nil
+	DurationDays *int `json:"duration_days,omitempty"`
+	// SharingSettings overrides the sharing settings of the entitlement's plan
+	SharingSettings *SharingSettings `json:"sharing_settings,omitempty"`
+	// SharingProfile is the name of the sharing profile restricting the content shared
+	SharingProfile string `json:"sharing_profile,omitempty"`
+	// AllowedUsers are the Plex account IDs, prefixed with "id:", emails and
+	// usernames allowed to claim the code. Anyone can claim it when empty.
+	AllowedUsers []string `json:"allowed_users,omitempty"`
 }
 
-// IsValid checks if an invite code is still valid for use
-func (i *InviteCode) IsValid() bool {
-	// Code is disabled
-	if i.IsDisabled {
-		return false
+// AllowsUser reports whether the user's Plex account ID, email or username
+// is on the code's allowlist, or the code has none
+func (i *InviteCode) AllowsUser(user *UserInfo) bool {
+	if len(i.AllowedUsers) == 0 {
+		return true
 	}
+	for _, allowed := range i.AllowedUsers {
+		if allowed == "" {
+			continue
+		}
+		if id, ok := strings.CutPrefix(allowed, AllowedUserIDPrefix); ok {
+			if id == strconv.Itoa(user.ID) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(allowed, user.Email) || strings.EqualFold(allowed, user.Username) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Code has expired
-	if i.ExpiresAt != nil && time.Now().After(*i.ExpiresAt) {
-		return false
+// AccessEndsAt returns when access granted by claiming the code at the given
+// time ends, or nil when the code grants unlimited access
+func (i *InviteCode) AccessEndsAt(claimedAt time.Time) *time.Time {
+	if i.DurationDays == nil {
+		return nil
 	}
+	endsAt := claimedAt.AddDate(0, 0, *i.DurationDays)
+	return &endsAt
+}
 
-	// Max uses reached
-	if i.MaxUses != nil && i.UsedCount >= *i.MaxUses {
-		return false
+// IsValid checks if an invite code is still valid for use
+func (i *InviteCode) IsValid() bool {
+	return i.CheckRedeemable(time.Now()) == nil
+}
+
+// Status returns the status of the code at the given time
+func (i *InviteCode) Status(now time.Time) string {
+	switch i.CheckRedeemable(now) {
+	case ErrInviteCodeDisabled:
+		return InviteCodeStatusDisabled
+	case ErrInviteCodeExpired:
+		return InviteCodeStatusExpired
+	case ErrInviteCodeExhausted:
+		return InviteCodeStatusExhausted
+	default:
+		return InviteCodeStatusActive
 	}
+}
 
-	return true
+// CheckRedeemable returns why the code can't be redeemed at the given time,
+// or nil when it can. Codes without MaxUses can be used any number of times.
+func (i *InviteCode) CheckRedeemable(now time.Time) error {
+	switch {
+	case i.IsDisabled:
+		return ErrInviteCodeDisabled
+	case i.ExpiresAt != nil && now.After(*i.ExpiresAt):
+		return ErrInviteCodeExpired
+	case i.MaxUses != nil && i.UsedCount >= *i.MaxUses:
+		return ErrInviteCodeExhausted
+	}
+	return nil
 }
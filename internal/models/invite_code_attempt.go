@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// Subjects whose failed invite code attempts are limited
+const (
+	LockoutSubjectUser = "user" // Attempts of a user, identified by their Plex user ID
+	LockoutSubjectIP   = "ip"   // Attempts from an IP address
+)
+
+// Reasons an attempt to claim an invite code failed
+const (
+	InviteCodeAttemptPending    = "pending"     // The claim is in progress, counted as failed until it succeeds
+	InviteCodeAttemptNotFound   = "not_found"   // No code matched
+	InviteCodeAttemptNotAllowed = "not_allowed" // The code is restricted to other users
+)
+
+// InviteCodeAttempt records an attempt to claim an invite code that failed or
+// is still in progress
+type InviteCodeAttempt struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"` // Populated from plex_users
+	IPAddress string    `json:"ip_address"`
+	Code      string    `json:"code"`   // Code the user tried
+	Reason    string    `json:"reason"` // Why the attempt failed, such as not_found or expired
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InviteCodeLockout blocks a user or an IP address from claiming invite codes
+// after too many failed attempts
+type InviteCodeLockout struct {
+	ID             int        `json:"id"`
+	SubjectType    string     `json:"subject_type"`       // LockoutSubjectUser or LockoutSubjectIP
+	Subject        string     `json:"subject"`            // User ID or IP address
+	UserID         *int       `json:"user_id,omitempty"`  // Locked out user
+	Username       string     `json:"username,omitempty"` // Populated from plex_users
+	FailedAttempts int        `json:"failed_attempts"`    // Failed attempts that caused the lockout
+	LockedUntil    time.Time  `json:"locked_until"`
+	LiftedAt       *time.Time `json:"lifted_at,omitempty"` // When an admin lifted the lockout early
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// EndsAt returns when the lockout ends or was lifted
+func (l *InviteCodeLockout) EndsAt() time.Time {
+	if l.LiftedAt != nil && l.LiftedAt.Before(l.LockedUntil) {
+		return *l.LiftedAt
+	}
+	return l.LockedUntil
+}
+
+// Active reports whether the lockout blocks claims at the given time
+func (l *InviteCodeLockout) Active(now time.Time) bool {
+	return now.Before(l.EndsAt())
+}
+
+// ClaimLimit limits the failed invite code claims of a user or from an IP address
+type ClaimLimit struct {
+	SubjectType string
+	Subject     string
+	UserID      *int // Locked out user, nil for IP addresses
+	MaxFailed   int
+}
+
+// CountSince returns when the attempts counting toward the limit start: the
+// start of the attempt window, or the end of the previous lockout when later,
+// so attempts aren't counted again after a lockout
+func (l ClaimLimit) CountSince(previous *InviteCodeLockout, now time.Time, window time.Duration) time.Time {
+	since := now.Add(-window)
+	if previous != nil && previous.EndsAt().After(since) {
+		return previous.EndsAt()
+	}
+	return since
+}
+
+// Check returns the lockout blocking another claim at the given time, given
+// the latest lockout and the attempts counting toward the limit, and whether
+// the lockout is new. It returns nil when the claim may go ahead.
+func (l ClaimLimit) Check(previous *InviteCodeLockout, attempts int, now time.Time, lockoutDuration time.Duration) (*InviteCodeLockout, bool) {
+	if previous != nil && previous.Active(now) {
+		return previous, false
+	}
+	if attempts < l.MaxFailed {
+		return nil, false
+	}
+	return &InviteCodeLockout{
+		SubjectType:    l.SubjectType,
+		Subject:        l.Subject,
+		UserID:         l.UserID,
+		FailedAttempts: attempts,
+		LockedUntil:    now.Add(lockoutDuration),
+		CreatedAt:      now,
+	}, true
+}
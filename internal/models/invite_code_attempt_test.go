@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimLimitCountSince(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := ClaimLimit{SubjectType: LockoutSubjectIP, Subject: "203.0.113.1", MaxFailed: 3}
+	lifted := now.Add(-5 * time.Minute)
+
+	tests := []struct {
+		name     string
+		previous *InviteCodeLockout
+		want     time.Time
+	}{
+		{"no lockout", nil, now.Add(-15 * time.Minute)},
+		{"lockout ended before window", &InviteCodeLockout{LockedUntil: now.Add(-time.Hour)}, now.Add(-15 * time.Minute)},
+		{"lockout ended within window", &InviteCodeLockout{LockedUntil: now.Add(-10 * time.Minute)}, now.Add(-10 * time.Minute)},
+		{"lockout lifted early", &InviteCodeLockout{LockedUntil: now.Add(time.Hour), LiftedAt: &lifted}, lifted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limit.CountSince(tt.previous, now, 15*time.Minute); !got.Equal(tt.want) {
+				t.Errorf("CountSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimLimitCheck(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	userID := 42
+	limit := ClaimLimit{SubjectType: LockoutSubjectUser, Subject: "42", UserID: &userID, MaxFailed: 3}
+	active := &InviteCodeLockout{ID: 7, LockedUntil: now.Add(30 * time.Minute)}
+	lifted := now.Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		previous    *InviteCodeLockout
+		attempts    int
+		wantLockout bool
+		wantCreated bool
+	}{
+		{"under the limit", nil, 2, false, false},
+		{"reaching the limit", nil, 3, true, true},
+		{"over the limit", nil, 5, true, true},
+		{"active lockout", active, 0, true, false},
+		{"expired lockout", &InviteCodeLockout{LockedUntil: now.Add(-time.Minute)}, 1, false, false},
+		{"lifted lockout", &InviteCodeLockout{LockedUntil: now.Add(time.Hour), LiftedAt: &lifted}, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lockout, created := limit.Check(tt.previous, tt.attempts, now, time.Hour)
+			if (lockout != nil) != tt.wantLockout || created != tt.wantCreated {
+				t.Fatalf("Check() = %+v, %v, want lockout %v created %v", lockout, created, tt.wantLockout, tt.wantCreated)
+			}
+			if !created {
+				if tt.previous != nil && lockout != nil && lockout != tt.previous {
+					t.Errorf("Check() = %+v, want the active lockout", lockout)
+				}
+				return
+			}
+			if !lockout.LockedUntil.Equal(now.Add(time.Hour)) || lockout.FailedAttempts != tt.attempts ||
+				lockout.UserID == nil || *lockout.UserID != userID || lockout.Subject != "42" {
+				t.Errorf("Check() = %+v, want a lockout of user 42 for an hour after %d attempts", lockout, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInviteCodeAllowsUser(t *testing.T) {
+	user := &UserInfo{ID: 12345, Username: "MovieFan", Email: "fan@example.com"}
+	numeric := &UserInfo{ID: 99, Username: "12345", Email: "numbers@example.com"}
+
+	tests := []struct {
+		name         string
+		allowedUsers []string
+		user         *UserInfo
+		want         bool
+	}{
+		{"no allowlist", nil, user, true},
+		{"account ID", []string{"id:12345"}, user, true},
+		{"other account ID", []string{"id:54321"}, user, false},
+		{"email ignores case", []string{"FAN@example.com"}, user, true},
+		{"username ignores case", []string{"moviefan"}, user, true},
+		{"one of several entries", []string{"someone@example.com", "moviefan"}, user, true},
+		{"not on the allowlist", []string{"someone@example.com", "other"}, user, false},
+		{"empty entries match nobody", []string{""}, &UserInfo{ID: 1}, false},
+		{"bare number only matches a username", []string{"12345"}, user, false},
+		{"numeric username", []string{"12345"}, numeric, true},
+		{"account ID doesn't match a numeric username", []string{"id:12345"}, numeric, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := &InviteCode{AllowedUsers: tt.allowedUsers}
+			if got := code.AllowsUser(tt.user); got != tt.want {
+				t.Errorf("AllowsUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedUserID(t *testing.T) {
+	if got := AllowedUserID(12345); got != "id:12345" {
+		t.Errorf("AllowedUserID() = %q, want %q", got, "id:12345")
+	}
+}
+
+func TestInviteCodeCheckRedeemable(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	intPtr := func(n int) *int { return &n }
+
+	tests := []struct {
+		name       string
+		code       InviteCode
+		want       error
+		wantStatus string
+	}{
+		{"unlimited", InviteCode{UsedCount: 100}, nil, InviteCodeStatusActive},
+		{"uses left", InviteCode{MaxUses: intPtr(2), UsedCount: 1}, nil, InviteCodeStatusActive},
+		{"not yet expired", InviteCode{ExpiresAt: &future}, nil, InviteCodeStatusActive},
+		{"expiring now", InviteCode{ExpiresAt: &now}, nil, InviteCodeStatusActive},
+		{"disabled", InviteCode{IsDisabled: true}, ErrInviteCodeDisabled, InviteCodeStatusDisabled},
+		{"expired", InviteCode{ExpiresAt: &past}, ErrInviteCodeExpired, InviteCodeStatusExpired},
+		{"exhausted", InviteCode{MaxUses: intPtr(2), UsedCount: 2}, ErrInviteCodeExhausted, InviteCodeStatusExhausted},
+		{"disabled before expired", InviteCode{IsDisabled: true, ExpiresAt: &past}, ErrInviteCodeDisabled, InviteCodeStatusDisabled},
+		{"expired before exhausted", InviteCode{ExpiresAt: &past, MaxUses: intPtr(1), UsedCount: 1}, ErrInviteCodeExpired, InviteCodeStatusExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.code.CheckRedeemable(now); err != tt.want {
+				t.Errorf("CheckRedeemable() = %v, want %v", err, tt.want)
+			}
+			if status := tt.code.Status(now); status != tt.wantStatus {
+				t.Errorf("Status() = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "encoding/json"
+
+// Optional is a JSON field of a partial update, telling an omitted field
+// apart from one set to null
+type Optional[T any] struct {
+	Set   bool // Whether the field was present
+	Value *T   // The new value, nil when set to null
+}
+
+// UnmarshalJSON records that the field was present and decodes its value
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
@@ -0,0 +1,11 @@
+package models
+
+// PlexLibrary represents a library section on the Plex server
+type PlexLibrary struct {
+	ID     int    `json:"id"`
+	Key    int    `json:"key"`
+	Title  string `json:"title"`
+	Type   string `json:"type"`
+	Shared bool   `json:"shared"`
+	Server string `json:"server"`
+}
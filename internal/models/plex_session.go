@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// PlexSession is a playback session on one of the managed Plex servers
+type PlexSession struct {
+	SessionID         string `json:"session_id"`         // Plex session ID, unique per playback
+	Server            string `json:"server"`             // Name of the server
+	MachineIdentifier string `json:"machine_identifier"` // Server the session is on
+	UserID            int    `json:"user_id"`            // Plex user ID
+	Username          string `json:"username"`           // Plex username
+	Title             string `json:"title"`              // Title of the item being played
+	Type              string `json:"type"`               // Media type, e.g. movie, episode or track
+	Player            string `json:"player"`             // Name of the playing device
+	Platform          string `json:"platform"`           // Platform of the playing device
+	State             string `json:"state"`              // playing, paused or buffering
+	Decision          string `json:"decision"`           // directplay, copy or transcode
+	Bandwidth         int    `json:"bandwidth"`          // Bandwidth used in kbps
+	Local             bool   `json:"local"`              // Whether the player is on the server's network
+}
+
+// PlexSessionHistory is a session recorded by the session poller
+type PlexSessionHistory struct {
+	ID int `json:"id"`
+	PlexSession
+	StartedAt  time.Time `json:"started_at"`   // When the session was first seen
+	LastSeenAt time.Time `json:"last_seen_at"` // When the session was last seen
+}
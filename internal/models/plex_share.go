@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// PlexShare records that a Plex user has been shared a server, as last seen on plex.tv
+type PlexShare struct {
+	UserID            int              `json:"user_id"`                    // Plex user ID
+	MachineIdentifier string           `json:"machine_identifier"`         // Server the share belongs to
+	SharedServerID    string           `json:"shared_server_id"`           // Plex shared server record ID
+	NumLibraries      int              `json:"num_libraries"`              // Number of libraries shared
+	AllLibraries      bool             `json:"all_libraries"`              // Whether all libraries are shared
+	Pending           bool             `json:"pending"`                    // Whether the invite is yet to be accepted
+	InviteToken       string           `json:"invite_token,omitempty"`     // Token of the invite sent to the user
+	InvitedAt         *time.Time       `json:"invited_at,omitempty"`       // When we sent the invite
+	SharingProfile    string           `json:"sharing_profile,omitempty"`  // Sharing profile the server was shared with
+	Libraries         []string         `json:"libraries,omitempty"`        // Libraries the server was shared with, its shared_libraries when empty
+	SharingSettings   *SharingSettings `json:"sharing_settings,omitempty"` // Settings the server was shared with, nil when not recorded
+	LastSeenAt        *time.Time       `json:"last_seen_at"`               // When the user was last seen on the server
+	SyncedAt          time.Time        `json:"synced_at"`                  // When this record was last refreshed
+}
+
+// PlexInvite is a pending share along with the invited user, for the admin view
+type PlexInvite struct {
+	PlexShare
+	Server   string `json:"server"`   // Name of the shared server
+	Username string `json:"username"` // Invited user's username, if known
+	Email    string `json:"email"`    // Invited user's email, if known
+}
@@ -2,10 +2,32 @@ package models
 
 import "time"
 
+// Statuses of a user's stored Plex token
+const (
+	TokenStatusValid   = "valid"   // The token worked when last used or validated
+	TokenStatusInvalid = "invalid" // Plex rejected the token, the user needs to log in again
+	TokenStatusMissing = "missing" // The user never logged in
+)
+
 // PlexToken holds a user's Plex OAuth tokens.
 type PlexToken struct {
-	UserID      int       `db:"user_id"    json:"user_id"`
-	AccessToken string    `db:"access_token"  json:"access_token"`
-	CreatedAt   time.Time `db:"created_at"    json:"created_at"`
-	UpdatedAt   time.Time `db:"updated_at"    json:"updated_at"`
+	UserID        int        `db:"user_id"    json:"user_id"`
+	AccessToken   string     `db:"access_token"  json:"access_token"`
+	IsValid       bool       `db:"is_valid"      json:"is_valid"`
+	ValidatedAt   *time.Time `db:"validated_at"  json:"validated_at,omitempty"`
+	InvalidatedAt *time.Time `db:"invalidated_at" json:"invalidated_at,omitempty"`
+	CreatedAt     time.Time  `db:"created_at"    json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"    json:"updated_at"`
+}
+
+// Status returns the token's status, for a token that may not exist
+func (t *PlexToken) Status() string {
+	switch {
+	case t == nil || t.AccessToken == "":
+		return TokenStatusMissing
+	case t.IsValid:
+		return TokenStatusValid
+	default:
+		return TokenStatusInvalid
+	}
 }
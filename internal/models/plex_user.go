@@ -6,27 +6,66 @@ import (
 
 // PlexUser represents user information from Plex
 type PlexUser struct {
-	ID        int       `json:"id"`              // Plex user ID
-	UUID      string    `json:"uuid"`            // Plex user UUID
-	Username  string    `json:"username"`        // Plex username
-	Email     string    `json:"email"`           // Plex email
-	IsAdmin   bool      `json:"is_admin"`        // Is this user an admin
-	Notes     string    `json:"notes,omitempty"` // Admin notes about the user
-	CreatedAt time.Time `json:"created_at"`      // When the user was created in our system
-	UpdatedAt time.Time `json:"updated_at"`      // When the user was last updated in our system
+	ID                 int        `json:"id"`                             // Plex user ID
+	UUID               string     `json:"uuid"`                           // Plex user UUID
+	Username           string     `json:"username"`                       // Plex username
+	Email              string     `json:"email"`                          // Plex email, empty for managed users
+	IsAdmin            bool       `json:"is_admin"`                       // Is this user an admin
+	IsManaged          bool       `json:"is_managed"`                     // Is this a managed Plex Home user without their own account
+	RestrictionProfile string     `json:"restriction_profile,omitempty"`  // Plex Home restriction profile of a managed user
+	IsExempt           bool       `json:"is_exempt"`                      // Is this user exempt from the inactivity policy
+	InactivityWarnedAt *time.Time `json:"inactivity_warned_at,omitempty"` // When the user was warned about inactivity
+	InactivityRevokeAt *time.Time `json:"inactivity_revoke_at,omitempty"` // When a warned user is revoked if still inactive
+	// InactivityWarningSeenAt is when the warning was shown to the user, who
+	// is only revoked once they have seen it
+	InactivityWarningSeenAt *time.Time `json:"inactivity_warning_seen_at,omitempty"`
+	EntitlementName         string     `json:"entitlement_name,omitempty"` // Entitlement of the plan the user was given access through
+	Notes                   string     `json:"notes,omitempty"`            // Admin notes about the user
+	ReferredBy              *int       `json:"referred_by,omitempty"`      // User who referred this user
+	CreatedAt               time.Time  `json:"created_at"`                 // When the user was created in our system
+	UpdatedAt               time.Time  `json:"updated_at"`                 // When the user was last updated in our system
+}
+
+// Plex Home restriction profiles for managed users
+const (
+	RestrictionProfileLittleKid = "little_kid"
+	RestrictionProfileOlderKid  = "older_kid"
+	RestrictionProfileTeen      = "teen"
+)
+
+// ValidRestrictionProfile reports whether profile is a Plex Home restriction
+// profile. An empty profile means the managed user is unrestricted.
+func ValidRestrictionProfile(profile string) bool {
+	switch profile {
+	case "", RestrictionProfileLittleKid, RestrictionProfileOlderKid, RestrictionProfileTeen:
+		return true
+	}
+	return false
 }
 
 type PlexUserWithAccess struct {
 	PlexUser
-	HasAccess bool `json:"has_access"` // Does this user have access to the server
+	HasAccess   bool           `json:"has_access"`   // Does this user have access to any server
+	Servers     []ServerAccess `json:"servers"`      // Access to each managed server
+	TokenStatus string         `json:"token_status"` // Status of the user's stored Plex token
+}
+
+// ServerAccess describes a user's access to one of the managed Plex servers
+type ServerAccess struct {
+	Server            string `json:"server"`
+	MachineIdentifier string `json:"machine_identifier"`
+	HasAccess         bool   `json:"has_access"`
+	Pending           bool   `json:"pending"` // The invite hasn't been accepted yet
 }
 
 // PlexUserInvite associates a user with an invite code they've used
 type PlexUserInvite struct {
-	ID              int       `json:"id"`               // Primary key
-	UserID          int       `json:"user_id"`          // Plex user ID
-	InviteCodeID    int       `json:"invite_code_id"`   // Invite code ID they used
-	InviteCode      string    `json:"invite_code"`      // The actual code (populated from join)
-	EntitlementName string    `json:"entitlement_name"` // Entitlement from the invite code
-	UsedAt          time.Time `json:"used_at"`          // When the code was used
+	ID              int        `json:"id"`                       // Primary key
+	UserID          int        `json:"user_id"`                  // Plex user ID
+	InviteCodeID    int        `json:"invite_code_id"`           // Invite code ID they used
+	InviteCode      string     `json:"invite_code"`              // The actual code (populated from join)
+	EntitlementName string     `json:"entitlement_name"`         // Entitlement from the invite code
+	UsedAt          time.Time  `json:"used_at"`                  // When the code was used
+	AccessEndsAt    *time.Time `json:"access_ends_at,omitempty"` // When access granted by the code ends, unlimited when nil
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`     // When access was revoked because it ended
 }
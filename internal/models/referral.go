@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReferralCodeTaken is returned when no unused referral code could be generated
+var ErrReferralCodeTaken = errors.New("could not generate an unused referral code")
+
+// ReferralReward records the reward a user earned when someone they referred
+// paid their first invoice
+type ReferralReward struct {
+	ID         int       `json:"id"`
+	ReferrerID int       `json:"referrer_id"`           // User who referred and earned the reward
+	ReferredID *int      `json:"referred_id,omitempty"` // User who was referred, nil once deleted
+	InvoiceID  string    `json:"invoice_id"`            // Stripe invoice that earned the reward
+	RewardType string    `json:"reward_type"`           // "credit" or "coupon"
+	Amount     int64     `json:"amount,omitempty"`      // Credit in the smallest currency unit
+	Currency   string    `json:"currency,omitempty"`    // Currency of the credit
+	CouponID   string    `json:"coupon_id,omitempty"`   // Stripe coupon applied to the referrer's subscription
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReferralSummary is a user's referral code and what it has earned them
+type ReferralSummary struct {
+	Code    string           `json:"code"`
+	Link    string           `json:"link"`
+	Signups int              `json:"signups"` // Users who signed up with the code
+	Rewards []ReferralReward `json:"rewards"` // Rewards earned by referred users paying
+}
@@ -7,7 +7,8 @@ type BaseResponse struct {
 
 type CheckServerAccessResponse struct {
 	BaseResponse
-	HasAccess bool `json:"has_access"`
+	HasAccess bool           `json:"has_access"`
+	Servers   []ServerAccess `json:"servers,omitempty"`
 }
 
 type GetSubscriptionsResponse struct {
@@ -17,7 +18,8 @@ type GetSubscriptionsResponse struct {
 
 type GetCurrentUserResponse struct {
 	BaseResponse
-	User *UserInfo `json:"user"`
+	User              *UserInfo          `json:"user"`
+	InactivityWarning *InactivityWarning `json:"inactivity_warning,omitempty"` // Shown while the user is warned about inactivity
 }
 
 // SetUserNotesRequest represents the request to set notes for a user
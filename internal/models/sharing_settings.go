@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Values for SharingSettings.AllowTuners
+const (
+	TunersNone    = 0 // No Live TV access
+	TunersLiveTV  = 1 // Live TV only
+	TunersLiveDVR = 2 // Live TV and DVR recording
+)
+
+// SharingSettings are the restrictions applied to a user when a server is shared with them
+type SharingSettings struct {
+	AllowSync          bool          `json:"allow_sync" mapstructure:"allow_sync"`
+	AllowChannels      bool          `json:"allow_channels" mapstructure:"allow_channels"`
+	AllowSubtitleAdmin bool          `json:"allow_subtitle_admin" mapstructure:"allow_subtitle_admin"`
+	AllowTuners        int           `json:"allow_tuners" mapstructure:"allow_tuners"`
+	FilterMovies       LibraryFilter `json:"filter_movies" mapstructure:"filter_movies"`
+	FilterTelevision   LibraryFilter `json:"filter_television" mapstructure:"filter_television"`
+	FilterMusic        LibraryFilter `json:"filter_music" mapstructure:"filter_music"`
+}
+
+// Validate checks that the settings contain values Plex accepts
+func (s SharingSettings) Validate() error {
+	if s.AllowTuners < TunersNone || s.AllowTuners > TunersLiveDVR {
+		return fmt.Errorf("allow_tuners must be between %d and %d", TunersNone, TunersLiveDVR)
+	}
+	return nil
+}
+
+// LibraryFilter limits which items of a library type a shared user can see
+type LibraryFilter struct {
+	Labels                []string `json:"labels,omitempty" mapstructure:"labels"`
+	ExcludeLabels         []string `json:"exclude_labels,omitempty" mapstructure:"exclude_labels"`
+	ContentRatings        []string `json:"content_ratings,omitempty" mapstructure:"content_ratings"`
+	ExcludeContentRatings []string `json:"exclude_content_ratings,omitempty" mapstructure:"exclude_content_ratings"`
+}
+
+// String encodes the filter in the format Plex expects, e.g.
+// "label=kids|contentRating!=R%2CNC-17"
+func (f LibraryFilter) String() string {
+	var parts []string
+	add := func(key string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		escaped := make([]string, len(values))
+		for i, v := range values {
+			escaped[i] = url.QueryEscape(v)
+		}
+		parts = append(parts, key+strings.Join(escaped, "%2C"))
+	}
+	add("label=", f.Labels)
+	add("label!=", f.ExcludeLabels)
+	add("contentRating=", f.ContentRatings)
+	add("contentRating!=", f.ExcludeContentRatings)
+	return strings.Join(parts, "|")
+}
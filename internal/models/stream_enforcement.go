@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// StreamEnforcement records a stream terminated for exceeding a plan's concurrent stream limit
+type StreamEnforcement struct {
+	ID                int       `json:"id"`
+	UserID            int       `json:"user_id"`
+	Username          string    `json:"username"`
+	MachineIdentifier string    `json:"machine_identifier"`
+	SessionID         string    `json:"session_id"`     // Plex session ID of the terminated stream
+	Title             string    `json:"title"`          // Title that was playing
+	Player            string    `json:"player"`         // Device the stream was playing on
+	ActiveStreams     int       `json:"active_streams"` // Streams the user had when the limit was enforced
+	MaxStreams        int       `json:"max_streams"`    // Limit of the user's plan
+	Message           string    `json:"message"`        // Message shown to the user
+	CreatedAt         time.Time `json:"created_at"`
+}
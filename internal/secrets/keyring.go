@@ -0,0 +1,211 @@
+// Package secrets encrypts values stored at rest with envelope encryption.
+// Each value is sealed with its own random data key, and the data key is
+// sealed with a key encryption key from the configured keyring. Rotating the
+// key encryption key only re-seals the data keys.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keySize is the size of key encryption keys and data keys, for AES-256
+const keySize = 32
+
+// ErrUnknownKey is returned when a value was sealed with a key that isn't in the keyring
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Key is a key encryption key and the ID it is stored under
+type Key struct {
+	ID  string
+	key []byte
+}
+
+// ParseKey parses a key in the form "<id>:<base64 encoded 32 byte key>"
+func ParseKey(value string) (Key, error) {
+	id, encoded, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok || id == "" {
+		return Key{}, errors.New("key must be in the form <id>:<base64 key>")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q is not valid base64: %w", id, err)
+	}
+	if len(key) != keySize {
+		return Key{}, fmt.Errorf("key %q must be %d bytes, got %d", id, keySize, len(key))
+	}
+	return Key{ID: id, key: key}, nil
+}
+
+// Sealed is an encrypted value along with its sealed data key. A value with
+// no KeyID is stored in plaintext, from before encryption was enabled.
+type Sealed struct {
+	KeyID      string // ID of the key encryption key that sealed DataKey
+	DataKey    string // Base64 encoded data key, sealed with the key encryption key
+	Ciphertext string // Base64 encoded value, sealed with the data key
+}
+
+// Keyring holds the key new values are sealed with and every key that may
+// have sealed a stored value
+type Keyring struct {
+	current *Key
+	keys    map[string]Key
+}
+
+// NewKeyring builds a keyring sealing with the current key and opening values
+// sealed with it or any of the previous keys. Without a current key, values
+// are stored in plaintext.
+func NewKeyring(current string, previous []string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]Key)}
+	if current != "" {
+		key, err := ParseKey(current)
+		if err != nil {
+			return nil, err
+		}
+		k.current = &key
+		k.keys[key.ID] = key
+	}
+	for _, value := range previous {
+		key, err := ParseKey(value)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+	return k, nil
+}
+
+// Enabled reports whether new values are encrypted
+func (k *Keyring) Enabled() bool {
+	return k != nil && k.current != nil
+}
+
+// CurrentKeyID returns the ID of the key new values are sealed with, or an
+// empty string when encryption is disabled
+func (k *Keyring) CurrentKeyID() string {
+	if !k.Enabled() {
+		return ""
+	}
+	return k.current.ID
+}
+
+// Seal encrypts a value with a new data key sealed by the current key
+func (k *Keyring) Seal(plaintext string) (Sealed, error) {
+	if !k.Enabled() {
+		return Sealed{Ciphertext: plaintext}, nil
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return Sealed{}, err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return Sealed{}, err
+	}
+	sealedKey, err := seal(k.current.key, dataKey)
+	if err != nil {
+		return Sealed{}, err
+	}
+	return Sealed{KeyID: k.current.ID, DataKey: sealedKey, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts a sealed value
+func (k *Keyring) Open(sealed Sealed) (string, error) {
+	if sealed.KeyID == "" {
+		return sealed.Ciphertext, nil
+	}
+	dataKey, err := k.openDataKey(sealed)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, sealed.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Rotate re-seals a value's data key with the current key. Plaintext values
+// are encrypted. Values already sealed by the current key are returned as is.
+func (k *Keyring) Rotate(sealed Sealed) (Sealed, error) {
+	if !k.Enabled() {
+		return Sealed{}, errors.New("no current encryption key configured")
+	}
+	if sealed.KeyID == k.current.ID {
+		return sealed, nil
+	}
+	if sealed.KeyID == "" {
+		return k.Seal(sealed.Ciphertext)
+	}
+	dataKey, err := k.openDataKey(sealed)
+	if err != nil {
+		return Sealed{}, err
+	}
+	sealedKey, err := seal(k.current.key, dataKey)
+	if err != nil {
+		return Sealed{}, err
+	}
+	return Sealed{KeyID: k.current.ID, DataKey: sealedKey, Ciphertext: sealed.Ciphertext}, nil
+}
+
+// openDataKey decrypts a value's data key with the key that sealed it
+func (k *Keyring) openDataKey(sealed Sealed) ([]byte, error) {
+	if k == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, sealed.KeyID)
+	}
+	key, ok := k.keys[sealed.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, sealed.KeyID)
+	}
+	dataKey, err := open(key.key, sealed.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key with key %q: %w", sealed.KeyID, err)
+	}
+	return dataKey, nil
+}
+
+// seal encrypts plaintext with AES-GCM, returning the base64 encoded nonce and ciphertext
+func seal(key, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// open decrypts a value produced by seal
+func open(key []byte, encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
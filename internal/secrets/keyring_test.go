@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// mustGenerateKey returns a new random key with the given ID, formatted for ParseKey
+func mustGenerateKey(t *testing.T, id string) string {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key)
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"valid", mustGenerateKey(t, "k1"), false},
+		{"missing id", ":AAAA", true},
+		{"missing separator", "k1", true},
+		{"invalid base64", "k1:not base64!", true},
+		{"short key", "k1:AAAA", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKey(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseKey(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealAndOpen(t *testing.T) {
+	keyring, err := NewKeyring(mustGenerateKey(t, "k1"), nil)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	sealed, err := keyring.Seal("plex-token")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if sealed.KeyID != "k1" || sealed.DataKey == "" || sealed.Ciphertext == "plex-token" {
+		t.Fatalf("Seal() = %+v, want a value sealed with key k1", sealed)
+	}
+
+	plaintext, err := keyring.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if plaintext != "plex-token" {
+		t.Errorf("Open() = %q, want %q", plaintext, "plex-token")
+	}
+
+	tampered := sealed
+	tampered.Ciphertext = sealed.Ciphertext[:len(sealed.Ciphertext)-4] + "AAA="
+	if _, err := keyring.Open(tampered); err == nil {
+		t.Error("Open() of a tampered value succeeded")
+	}
+}
+
+func TestDisabledKeyring(t *testing.T) {
+	keyring, err := NewKeyring("", nil)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if keyring.Enabled() {
+		t.Error("Enabled() = true without a current key")
+	}
+	sealed, err := keyring.Seal("plex-token")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if sealed != (Sealed{Ciphertext: "plex-token"}) {
+		t.Errorf("Seal() = %+v, want the plaintext value", sealed)
+	}
+	if _, err := keyring.Rotate(sealed); err == nil {
+		t.Error("Rotate() without a current key succeeded")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	oldKey, newKey := mustGenerateKey(t, "old"), mustGenerateKey(t, "new")
+	oldKeyring, err := NewKeyring(oldKey, nil)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	sealed, err := oldKeyring.Seal("plex-token")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	newKeyring, err := NewKeyring(newKey, []string{oldKey})
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	rotated, err := newKeyring.Rotate(sealed)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if rotated.KeyID != "new" {
+		t.Errorf("Rotate() key ID = %q, want %q", rotated.KeyID, "new")
+	}
+
+	// Once rotated, the old key is no longer needed
+	onlyNew, err := NewKeyring(newKey, nil)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if plaintext, err := onlyNew.Open(rotated); err != nil || plaintext != "plex-token" {
+		t.Errorf("Open() = %q, %v, want %q", plaintext, err, "plex-token")
+	}
+	if _, err := onlyNew.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open() of a value sealed with a removed key error = %v, want ErrUnknownKey", err)
+	}
+
+	// Plaintext values from before encryption was enabled are encrypted
+	rotated, err = newKeyring.Rotate(Sealed{Ciphertext: "legacy-token"})
+	if err != nil {
+		t.Fatalf("Rotate() of a plaintext value error = %v", err)
+	}
+	if plaintext, err := newKeyring.Open(rotated); rotated.KeyID != "new" || err != nil || plaintext != "legacy-token" {
+		t.Errorf("Rotate() of a plaintext value = %+v (%q, %v), want it sealed with key new", rotated, plaintext, err)
+	}
+}
+
+func TestNewKeyringDuplicateID(t *testing.T) {
+	if _, err := NewKeyring(mustGenerateKey(t, "k1"), []string{mustGenerateKey(t, "k1")}); err == nil {
+		t.Error("NewKeyring() with duplicate key IDs succeeded")
+	}
+}
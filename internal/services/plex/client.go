@@ -0,0 +1,363 @@
+package plex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when recent Plex API calls have failed repeatedly
+// and requests are being rejected without contacting Plex.
+var ErrCircuitOpen = errors.New("plex API unavailable: circuit breaker open")
+
+// StatusError is returned when the Plex API responds with an unexpected status code
+type StatusError struct {
+	Op         string
+	StatusCode int
+	Status     string
+	Body       string
+	Errors     []PlexError
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("%s: API returned error status: %s: %s", e.Op, e.Status, e.Errors[0].Message)
+	}
+	return fmt.Sprintf("%s: API returned error status: %s", e.Op, e.Status)
+}
+
+// IsUnauthorized reports whether err is a Plex API 401 response
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsNotFound reports whether err is a Plex API 404 response
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited reports whether err is a Plex API 429 response
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+func hasStatus(err error, status int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == status
+}
+
+// newStatusError builds a StatusError from an API response, parsing the
+// structured Plex error body when present.
+func newStatusError(op string, resp *apiResponse) *StatusError {
+	statusErr := &StatusError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(resp.Body),
+	}
+	var plexErr PlexErrorResponse
+	if err := json.Unmarshal(resp.Body, &plexErr); err == nil {
+		statusErr.Errors = plexErr.Errors
+	}
+	return statusErr
+}
+
+// apiResponse holds a fully read Plex API response
+type apiResponse struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+// expectStatus returns a StatusError unless the response has one of the given status codes
+func (r *apiResponse) expectStatus(op string, codes ...int) error {
+	for _, code := range codes {
+		if r.StatusCode == code {
+			return nil
+		}
+	}
+	slog.Debug("Plex API request failed",
+		"op", op,
+		"status", r.Status,
+		"response", string(r.Body[:min(500, len(r.Body))]))
+	return newStatusError(op, r)
+}
+
+// RetryPolicy configures how the request executor retries failed requests
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the initial attempt
+	MaxRetries int
+	// BaseDelay is the initial backoff delay, doubled on each retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay and the honoured Retry-After value
+	MaxDelay time.Duration
+	// BreakerThreshold is the number of consecutive failures that opens the circuit
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit stays open before a trial request
+	BreakerCooldown time.Duration
+}
+
+// requestExecutor performs Plex API requests with retries, backoff and a circuit breaker
+type requestExecutor struct {
+	client  *http.Client
+	policy  RetryPolicy
+	breaker *circuitBreaker
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func newRequestExecutor(client *http.Client, policy RetryPolicy) *requestExecutor {
+	return &requestExecutor{
+		client:  client,
+		policy:  policy,
+		breaker: &circuitBreaker{threshold: policy.BreakerThreshold, cooldown: policy.BreakerCooldown},
+		sleep:   sleepContext,
+	}
+}
+
+// do executes the request, retrying idempotent requests on network errors and
+// retryable status codes. Requests rejected with 429 are retried regardless of
+// method since Plex did not process them. The response body is fully read.
+func (e *requestExecutor) do(req *http.Request) (*apiResponse, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		allowed, trial := e.breaker.allow()
+		if !allowed {
+			return nil, ErrCircuitOpen
+		}
+
+		attemptReq, err := cloneRequest(req)
+		if err != nil {
+			if trial {
+				e.breaker.release()
+			}
+			return nil, err
+		}
+
+		resp, err := e.roundTrip(attemptReq)
+		if err != nil {
+			if ctx.Err() != nil {
+				// A cancelled request says nothing about Plex, but the trial
+				// must be given back so another request can try
+				if trial {
+					e.breaker.release()
+				}
+				return nil, err
+			}
+			e.breaker.failure()
+			if !isIdempotent(req.Method) || attempt >= e.policy.MaxRetries {
+				return nil, err
+			}
+			delay := e.backoff(attempt)
+			slog.Debug("Retrying Plex API request after error",
+				"method", req.Method,
+				"url", req.URL.Redacted(),
+				"attempt", attempt+1,
+				"delay", delay,
+				"error", err)
+			if err := e.sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			e.breaker.failure()
+		} else {
+			e.breaker.success()
+		}
+
+		if !isRetryableStatus(resp.StatusCode) || attempt >= e.policy.MaxRetries ||
+			(resp.StatusCode != http.StatusTooManyRequests && !isIdempotent(req.Method)) {
+			return resp, nil
+		}
+
+		delay, ok := e.retryDelay(resp, attempt)
+		if !ok {
+			return resp, nil
+		}
+		slog.Debug("Retrying Plex API request",
+			"method", req.Method,
+			"url", req.URL.Redacted(),
+			"status", resp.Status,
+			"attempt", attempt+1,
+			"delay", delay)
+		if err := e.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (e *requestExecutor) roundTrip(req *http.Request) (*apiResponse, error) {
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return &apiResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}, nil
+}
+
+// retryDelay returns how long to wait before retrying a response. A Retry-After
+// header is honoured unless it exceeds the maximum delay, in which case the
+// request is not retried.
+func (e *requestExecutor) retryDelay(resp *apiResponse, attempt int) (time.Duration, bool) {
+	if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		if e.policy.MaxDelay > 0 && retryAfter > e.policy.MaxDelay {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+	return e.backoff(attempt), true
+}
+
+// backoff returns an exponential backoff delay with jitter in [d/2, d)
+func (e *requestExecutor) backoff(attempt int) time.Duration {
+	delay := e.policy.BaseDelay << attempt
+	if delay <= 0 || (e.policy.MaxDelay > 0 && delay > e.policy.MaxDelay) {
+		delay = e.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)))
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// cloneRequest copies a request so it can be sent again, rewinding its body
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("request body cannot be replayed")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// circuitBreaker fails fast once a number of consecutive requests have failed,
+// letting a single trial request through after the cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// allow reports whether a request may be sent, and whether it is the trial
+// request let through after the cooldown. A trial that ends without
+// success or failure must be given back with release.
+func (b *circuitBreaker) allow() (allowed, trial bool) {
+	if b.threshold <= 0 {
+		return true, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false, false
+	}
+	// Cooldown elapsed, allow one trial request through
+	b.trial = true
+	return true, true
+}
+
+// release gives back the trial request without closing or reopening the circuit
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold && b.threshold > 0 {
+		slog.Info("Plex API circuit breaker closed")
+	}
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		if b.failures == b.threshold {
+			slog.Warn("Plex API circuit breaker opened",
+				"failures", b.failures,
+				"cooldown", b.cooldown)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestExecutor returns an executor that records backoff delays instead of sleeping
+func newTestExecutor(policy RetryPolicy) (*requestExecutor, *[]time.Duration) {
+	exec := newRequestExecutor(&http.Client{}, policy)
+	var delays []time.Duration
+	exec.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return exec, &delays
+}
+
+// flakyServer responds with the given statuses in order, then 200
+func flakyServer(t *testing.T, headers http.Header, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &calls
+}
+
+func TestExecutorRetriesIdempotentRequests(t *testing.T) {
+	ts, calls := flakyServer(t, http.Header{"Retry-After": {"2"}},
+		http.StatusServiceUnavailable, http.StatusBadGateway)
+	exec, delays := newTestExecutor(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Minute})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := exec.do(req)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("do() status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := atomic.LoadInt32(calls); got != 3 {
+		t.Errorf("server calls = %d, want 3", got)
+	}
+	if len(*delays) != 2 || (*delays)[0] != 2*time.Second {
+		t.Errorf("delays = %v, want two delays of 2s from Retry-After", *delays)
+	}
+}
+
+func TestExecutorDoesNotRetryNonIdempotentServerErrors(t *testing.T) {
+	ts, calls := flakyServer(t, nil, http.StatusServiceUnavailable)
+	exec, _ := newTestExecutor(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond})
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader("{}"))
+	resp, err := exec.do(req)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("do() status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("server calls = %d, want 1", got)
+	}
+}
+
+func TestExecutorRetriesRateLimitedPost(t *testing.T) {
+	ts, calls := flakyServer(t, nil, http.StatusTooManyRequests)
+	exec, _ := newTestExecutor(RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond})
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader("{}"))
+	resp, err := exec.do(req)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(calls) != 2 {
+		t.Errorf("do() status = %d after %d calls, want 200 after 2", resp.StatusCode, atomic.LoadInt32(calls))
+	}
+}
+
+func TestExecutorRetryAfterBeyondMaxDelay(t *testing.T) {
+	ts, calls := flakyServer(t, http.Header{"Retry-After": {"3600"}}, http.StatusTooManyRequests)
+	exec, _ := newTestExecutor(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := exec.do(req)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	err = resp.expectStatus("test", http.StatusOK)
+	if !IsRateLimited(err) {
+		t.Errorf("expectStatus() error = %v, want rate limited StatusError", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("server calls = %d, want 1", got)
+	}
+}
+
+func TestExecutorCircuitBreaker(t *testing.T) {
+	ts, calls := flakyServer(t, nil, http.StatusInternalServerError, http.StatusInternalServerError)
+	exec, _ := newTestExecutor(RetryPolicy{BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		if _, err := exec.do(req); err != nil {
+			t.Fatalf("do() error = %v", err)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if _, err := exec.do(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("do() error = %v, want ErrCircuitOpen", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("server calls = %d, want 2", got)
+	}
+
+	// Once the cooldown has elapsed a trial request closes the circuit again
+	exec.breaker.openUntil = time.Now().Add(-time.Second)
+	req, _ = http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := exec.do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("do() after cooldown = %v, %v, want 200", resp, err)
+	}
+	if allowed, _ := exec.breaker.allow(); !allowed {
+		t.Errorf("breaker still open after successful trial request")
+	}
+}
+
+func TestExecutorCircuitBreakerCancelledTrial(t *testing.T) {
+	ts, calls := flakyServer(t, nil)
+	exec, _ := newTestExecutor(RetryPolicy{BreakerThreshold: 1, BreakerCooldown: time.Hour})
+	exec.breaker.failure()
+	exec.breaker.openUntil = time.Now().Add(-time.Second)
+
+	// The trial request is cancelled before Plex answers it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if _, err := exec.do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("do() error = %v, want context.Canceled", err)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := exec.do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("do() after cancelled trial = %v, %v, want 200", resp, err)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("server calls = %d, want 1", got)
+	}
+}
@@ -0,0 +1,739 @@
+// Package fake provides an in-memory stand-in for plex.tv and a Plex Media
+// Server, covering the endpoints used by PlexService. It is intended for
+// offline development and integration tests.
+package fake
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"plefi/internal/services/plex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMachineIdentifier is the machine identifier reported by the fake server.
+	DefaultMachineIdentifier = "fake-plex-machine-identifier"
+	// DefaultServerName is the friendly name reported by the fake server.
+	DefaultServerName = "Fake Plex"
+	// OwnerToken is the auth token of the seeded server owner account.
+	OwnerToken = "fake-owner-token"
+)
+
+// Account represents a plex.tv account known to the fake server
+type Account struct {
+	ID       int
+	UUID     string
+	Username string
+	Email    string
+	Token    string
+	// Managed accounts are Plex Home users without their own login
+	Managed            bool
+	RestrictionProfile string
+}
+
+// Library represents a library section on the fake server
+type Library struct {
+	ID    int
+	Title string
+	Type  string
+}
+
+// Share represents a shared server record created through the fake server
+type Share struct {
+	ID                int
+	InvitedID         int
+	InvitedEmail      string
+	MachineIdentifier string
+	LibraryIDs        []int
+	Settings          map[string]interface{}
+	InviteToken       string
+	Accepted          bool
+	CreatedAt         time.Time
+}
+
+// mediaServer is a Plex Media Server owned by the fake owner account
+type mediaServer struct {
+	machineIdentifier string
+	name              string
+	libraries         []Library
+}
+
+type pin struct {
+	ID        int
+	Code      string
+	ClientID  string
+	AuthToken string
+}
+
+// Server is a fake plex.tv API and Plex Media Server
+type Server struct {
+	mu       sync.Mutex
+	mux      *http.ServeMux
+	server   *http.Server
+	servers  []*mediaServer
+	owner    Account
+	accounts map[int]*Account
+	shares   map[int]*Share
+	pins     map[int]*pin
+	sessions []plex.PlexSession
+	// terminated maps the IDs of terminated sessions to the reason given
+	terminated map[string]string
+	nextID     int
+}
+
+// NewServer creates a fake server seeded with an owner account, two friend
+// accounts and a few libraries.
+func NewServer() *Server {
+	s := &Server{
+		mux:        http.NewServeMux(),
+		accounts:   make(map[int]*Account),
+		shares:     make(map[int]*Share),
+		pins:       make(map[int]*pin),
+		terminated: make(map[string]string),
+		nextID:     1000,
+	}
+	s.AddServer(DefaultMachineIdentifier, DefaultServerName, []Library{
+		{ID: 1, Title: "Movies", Type: "movie"},
+		{ID: 2, Title: "TV Shows", Type: "show"},
+		{ID: 3, Title: "Music", Type: "artist"},
+	})
+	s.owner = Account{ID: 1, UUID: "fake-owner-uuid", Username: "owner", Email: "owner@example.com", Token: OwnerToken}
+	s.AddAccount(s.owner)
+	s.AddAccount(Account{ID: 2, UUID: "fake-alice-uuid", Username: "alice", Email: "alice@example.com", Token: "fake-alice-token"})
+	s.AddAccount(Account{ID: 3, UUID: "fake-bob-uuid", Username: "bob", Email: "bob@example.com", Token: "fake-bob-token"})
+	s.routes()
+	return s
+}
+
+// MachineIdentifier returns the machine identifier of the primary media server
+func (s *Server) MachineIdentifier() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers[0].machineIdentifier
+}
+
+// AddServer registers an additional media server owned by the owner account
+func (s *Server) AddServer(machineIdentifier, name string, libraries []Library) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers = append(s.servers, &mediaServer{
+		machineIdentifier: machineIdentifier,
+		name:              name,
+		libraries:         libraries,
+	})
+}
+
+// mediaServer returns the media server with the given machine identifier
+func (s *Server) mediaServer(machineIdentifier string) *mediaServer {
+	for _, server := range s.servers {
+		if server.machineIdentifier == machineIdentifier {
+			return server
+		}
+	}
+	return nil
+}
+
+// Owner returns the seeded server owner account
+func (s *Server) Owner() Account {
+	return s.owner
+}
+
+// AddAccount registers a plex.tv account with the fake server
+func (s *Server) AddAccount(account Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := account
+	s.accounts[a.ID] = &a
+}
+
+// AddSession starts a playback session on the fake media server
+func (s *Server) AddSession(session plex.PlexSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = append(s.sessions, session)
+}
+
+// TerminationReason returns the reason a session was terminated with, if it was
+func (s *Server) TerminationReason(sessionID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reason, ok := s.terminated[sessionID]
+	return reason, ok
+}
+
+// Shares returns a snapshot of all shares created on the fake server
+func (s *Server) Shares() []Share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shares := make([]Share, 0, len(s.shares))
+	for _, share := range s.shares {
+		shares = append(shares, *share)
+	}
+	return shares
+}
+
+// ClaimPin links a PIN to an account, as if the user signed in on app.plex.tv
+func (s *Server) ClaimPin(code string, accountID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("account %d not found", accountID)
+	}
+	for _, p := range s.pins {
+		if p.Code == code {
+			p.AuthToken = account.Token
+			return nil
+		}
+	}
+	return fmt.Errorf("pin %s not found", code)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start listens on the given address and serves requests in the background.
+// It returns the base URL of the running server.
+func (s *Server) Start(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	s.server = &http.Server{Handler: s}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Fake Plex server error", "error", err)
+		}
+	}()
+	return fmt.Sprintf("http://%s", listener.Addr().String()), nil
+}
+
+// Close stops a server started with Start
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("POST /api/v2/pins", s.createPin)
+	s.mux.HandleFunc("GET /api/v2/pins/{id}", s.getPin)
+	s.mux.HandleFunc("GET /api/v2/user", s.getUser)
+	s.mux.HandleFunc("GET /api/users", s.getUsers)
+	s.mux.HandleFunc("GET /api/v2/servers/{machineID}", s.getServer)
+	s.mux.HandleFunc("POST /api/v2/home/users/restricted", s.createManagedUser)
+	s.mux.HandleFunc("POST /api/v2/shared_servers", s.createShare)
+	s.mux.HandleFunc("PUT /api/v2/shared_servers/{id}", s.updateShare)
+	s.mux.HandleFunc("POST /api/v2/shared_servers/{id}/accept", s.acceptShare)
+	s.mux.HandleFunc("DELETE /api/v2/sharings/{userID}", s.deleteSharing)
+	s.mux.HandleFunc("DELETE /api/servers/{machineID}/shared_servers/{id}", s.deleteSharedServer)
+	s.mux.HandleFunc("GET /identity", s.identity)
+	s.mux.HandleFunc("GET /status/sessions", s.getSessions)
+	s.mux.HandleFunc("GET /status/sessions/terminate", s.terminateSession)
+	s.mux.HandleFunc("GET /auth", s.authPage)
+	s.mux.HandleFunc("POST /auth/link", s.linkPin)
+}
+
+// authenticate resolves the account for the request's X-Plex-Token
+func (s *Server) authenticate(r *http.Request) *Account {
+	token := r.Header.Get("X-Plex-Token")
+	if token == "" {
+		token = r.URL.Query().Get("X-Plex-Token")
+	}
+	for _, account := range s.accounts {
+		if account.Token == token {
+			return account
+		}
+	}
+	return nil
+}
+
+func (s *Server) requireOwner(w http.ResponseWriter, r *http.Request) bool {
+	account := s.authenticate(r)
+	if account == nil || account.ID != s.owner.ID {
+		writeError(w, http.StatusUnauthorized, "Invalid token")
+		return false
+	}
+	return true
+}
+
+func (s *Server) createPin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = r.ParseForm()
+	s.nextID++
+	p := &pin{
+		ID:       s.nextID,
+		Code:     fmt.Sprintf("fake%d", s.nextID),
+		ClientID: r.Form.Get("X-Plex-Client-Identifier"),
+	}
+	s.pins[p.ID] = p
+	writeJSON(w, http.StatusCreated, plex.PlexPinResponse{ID: p.ID, Code: p.Code, ClientID: p.ClientID})
+}
+
+func (s *Server) getPin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid pin id")
+		return
+	}
+	p, ok := s.pins[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "pin not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, plex.PlexPinResponse{ID: p.ID, Code: p.Code, ClientID: p.ClientID, AuthToken: p.AuthToken})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := s.authenticate(r)
+	if account == nil {
+		writeError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	writeJSON(w, http.StatusOK, plex.PlexDetailedUserResponse{
+		ID:           account.ID,
+		UUID:         account.UUID,
+		Username:     account.Username,
+		Title:        account.Username,
+		Email:        account.Email,
+		FriendlyName: account.Username,
+		AuthToken:    account.Token,
+		Confirmed:    true,
+	})
+}
+
+func (s *Server) getUsers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+
+	servers := make(map[int][]plex.PlexServer)
+	for _, share := range s.shares {
+		servers[share.InvitedID] = append(servers[share.InvitedID], plex.PlexServer{
+			ID:                strconv.Itoa(share.ID),
+			ServerID:          strconv.Itoa(share.ID),
+			MachineIdentifier: share.MachineIdentifier,
+			Name:              s.mediaServer(share.MachineIdentifier).name,
+			LastSeenAt:        strconv.FormatInt(share.CreatedAt.Unix(), 10),
+			NumLibraries:      len(share.LibraryIDs),
+			Pending:           boolToInt(!share.Accepted),
+		})
+	}
+
+	response := plex.PlexUsersResponse{
+		FriendlyName:      "myPlex",
+		Identifier:        "com.plexapp.plugins.myplex",
+		MachineIdentifier: s.servers[0].machineIdentifier,
+	}
+	for id, userServers := range servers {
+		account, ok := s.accounts[id]
+		if !ok {
+			continue
+		}
+		response.Users = append(response.Users, plex.PlexUser{
+			ID:       account.ID,
+			Title:    account.Username,
+			Username: account.Username,
+			Email:    account.Email,
+			Home:     boolToInt(account.Managed),
+			Servers:  userServers,
+		})
+	}
+	response.Size = len(response.Users)
+	response.TotalSize = len(response.Users)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	if err := xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"MediaContainer"`
+		plex.PlexUsersResponse
+	}{PlexUsersResponse: response}); err != nil {
+		slog.Error("Failed to encode fake users response", "error", err)
+	}
+}
+
+func (s *Server) getServer(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+	server := s.mediaServer(r.PathValue("machineID"))
+	if server == nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	sections := make([]plex.PlexLibrarySection, 0, len(server.libraries))
+	for _, library := range server.libraries {
+		sections = append(sections, plex.PlexLibrarySection{
+			ID:    library.ID,
+			Key:   library.ID,
+			Title: library.Title,
+			Type:  library.Type,
+		})
+	}
+	writeJSON(w, http.StatusOK, plex.PlexServerResponse{
+		Name:            server.name,
+		MachineID:       server.machineIdentifier,
+		LibrarySections: sections,
+	})
+}
+
+func (s *Server) createManagedUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+
+	var req struct {
+		FriendlyName       string `json:"friendlyName"`
+		RestrictionProfile string `json:"restrictionProfile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.FriendlyName == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.nextID++
+	account := &Account{
+		ID:                 s.nextID,
+		UUID:               fmt.Sprintf("fake-managed-%d", s.nextID),
+		Username:           req.FriendlyName,
+		Managed:            true,
+		RestrictionProfile: req.RestrictionProfile,
+	}
+	s.accounts[account.ID] = account
+	writeJSON(w, http.StatusCreated, plex.PlexHomeUser{
+		ID:                 account.ID,
+		UUID:               account.UUID,
+		Title:              account.Username,
+		Username:           account.Username,
+		Home:               true,
+		Restricted:         account.RestrictionProfile != "",
+		RestrictionProfile: account.RestrictionProfile,
+	})
+}
+
+func (s *Server) createShare(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+
+	var req struct {
+		InvitedEmail      string                 `json:"invitedEmail"`
+		InvitedID         int                    `json:"invitedId"`
+		MachineIdentifier string                 `json:"machineIdentifier"`
+		LibrarySectionIDs []int                  `json:"librarySectionIds"`
+		Settings          map[string]interface{} `json:"settings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if s.mediaServer(req.MachineIdentifier) == nil {
+		writeError(w, http.StatusBadRequest, "unknown machineIdentifier")
+		return
+	}
+
+	var invited *Account
+	for _, account := range s.accounts {
+		if (req.InvitedID != 0 && account.ID == req.InvitedID) ||
+			(req.InvitedEmail != "" && strings.EqualFold(account.Email, req.InvitedEmail)) {
+			invited = account
+			break
+		}
+	}
+	if invited == nil {
+		writeError(w, http.StatusBadRequest, "User could not be found")
+		return
+	}
+
+	s.nextID++
+	share := &Share{
+		ID:                s.nextID,
+		InvitedID:         invited.ID,
+		InvitedEmail:      invited.Email,
+		MachineIdentifier: req.MachineIdentifier,
+		LibraryIDs:        req.LibrarySectionIDs,
+		Settings:          req.Settings,
+		InviteToken:       fmt.Sprintf("fake-invite-%d", s.nextID),
+		// Home users don't need to accept shares
+		Accepted:  invited.Managed,
+		CreatedAt: time.Now(),
+	}
+	s.shares[share.ID] = share
+	writeJSON(w, http.StatusCreated, s.shareResponse(share, invited))
+}
+
+func (s *Server) updateShare(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid share id")
+		return
+	}
+	share, ok := s.shares[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "shared server not found")
+		return
+	}
+
+	var req struct {
+		LibrarySectionIDs []int                  `json:"librarySectionIds"`
+		Settings          map[string]interface{} `json:"settings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	share.LibraryIDs = req.LibrarySectionIDs
+	share.Settings = req.Settings
+	writeJSON(w, http.StatusOK, s.shareResponse(share, s.accounts[share.InvitedID]))
+}
+
+func (s *Server) acceptShare(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := s.authenticate(r)
+	if account == nil {
+		writeError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid share id")
+		return
+	}
+	share, ok := s.shares[id]
+	if !ok || share.InvitedID != account.ID {
+		writeError(w, http.StatusNotFound, "invite not found")
+		return
+	}
+	share.Accepted = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteSharing(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	for id, share := range s.shares {
+		if share.InvitedID == userID {
+			delete(s.shares, id)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteSharedServer(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shared server id")
+		return
+	}
+	share, ok := s.shares[id]
+	if !ok || share.MachineIdentifier != r.PathValue("machineID") {
+		writeError(w, http.StatusNotFound, "shared server not found")
+		return
+	}
+	delete(s.shares, id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getSessions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+	var resp plex.PlexSessionsResponse
+	resp.MediaContainer.Size = len(s.sessions)
+	resp.MediaContainer.Metadata = append([]plex.PlexSession{}, s.sessions...)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) terminateSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireOwner(w, r) {
+		return
+	}
+	sessionID := r.URL.Query().Get("sessionId")
+	for i, session := range s.sessions {
+		if session.Session.ID == sessionID {
+			s.sessions = append(s.sessions[:i], s.sessions[i+1:]...)
+			s.terminated[sessionID] = r.URL.Query().Get("reason")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "session not found")
+}
+
+func (s *Server) identity(w http.ResponseWriter, r *http.Request) {
+	var resp struct {
+		MediaContainer struct {
+			Size              int    `json:"size"`
+			Claimed           bool   `json:"claimed"`
+			MachineIdentifier string `json:"machineIdentifier"`
+			Version           string `json:"version"`
+		} `json:"MediaContainer"`
+	}
+	resp.MediaContainer.Claimed = true
+	s.mu.Lock()
+	resp.MediaContainer.MachineIdentifier = s.servers[0].machineIdentifier
+	s.mu.Unlock()
+	resp.MediaContainer.Version = "1.0.0-fake"
+	writeJSON(w, http.StatusOK, resp)
+}
+
+var authPageTemplate = template.Must(template.New("auth").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Fake Plex Sign In</title></head>
+<body>
+<h1>Sign in to {{.Name}}</h1>
+{{range .Accounts}}<p><button onclick="signIn({{.ID}})">{{.Username}} ({{.Email}})</button></p>
+{{end}}
+<script>
+const params = new URLSearchParams(window.location.hash.replace(/^#\??/, ""));
+function signIn(accountID) {
+	const body = new URLSearchParams({code: params.get("code") || "", account: accountID});
+	fetch("/auth/link", {method: "POST", body: body}).then(function (resp) {
+		if (!resp.ok) { alert("Failed to link PIN"); return; }
+		const forwardUrl = params.get("forwardUrl");
+		if (forwardUrl) { window.location = forwardUrl; }
+	});
+}
+</script>
+</body>
+</html>
+`))
+
+// authPage renders a sign-in page mimicking app.plex.tv/auth, listing the
+// known accounts so a developer can pick who to log in as.
+func (s *Server) authPage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	accounts := make([]Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, *account)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := authPageTemplate.Execute(w, map[string]interface{}{
+		"Name":     DefaultServerName,
+		"Accounts": accounts,
+	}); err != nil {
+		slog.Error("Failed to render fake auth page", "error", err)
+	}
+}
+
+func (s *Server) linkPin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+	accountID, err := strconv.Atoi(r.Form.Get("account"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid account")
+		return
+	}
+	if err := s.ClaimPin(r.Form.Get("code"), accountID); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) shareResponse(share *Share, invited *Account) plex.PlexShareResponse {
+	var resp plex.PlexShareResponse
+	resp.ID = share.ID
+	resp.Accepted = share.Accepted
+	resp.InviteToken = share.InviteToken
+	resp.InvitedID = invited.ID
+	resp.InvitedEmail = &invited.Email
+	resp.Invited.ID = invited.ID
+	resp.Invited.Username = invited.Username
+	resp.Invited.Title = invited.Username
+	resp.Invited.UUID = invited.UUID
+	resp.Invited.Home = invited.Managed
+	resp.Invited.Restricted = invited.RestrictionProfile != ""
+	resp.Invited.Status = "pending"
+	server := s.mediaServer(share.MachineIdentifier)
+	resp.MachineIdentifier = share.MachineIdentifier
+	resp.Name = server.name
+	resp.NumLibraries = len(share.LibraryIDs)
+	resp.OwnerID = s.owner.ID
+	resp.LastSeenAt = share.CreatedAt
+	for _, libraryID := range share.LibraryIDs {
+		for _, library := range server.libraries {
+			if library.ID == libraryID {
+				resp.Libraries = append(resp.Libraries, struct {
+					ID    int    `json:"id"`
+					Key   int    `json:"key"`
+					Title string `json:"title"`
+					Type  string `json:"type"`
+				}{library.ID, library.ID, library.Title, library.Type})
+			}
+		}
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Failed to encode fake Plex response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, plex.PlexErrorResponse{
+		Errors: []plex.PlexError{{Code: status, Message: message, Status: status}},
+	})
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
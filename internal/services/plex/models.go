@@ -1,6 +1,10 @@
 package plex
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // PlexUser represents a user in the Plex system
 type PlexUser struct {
@@ -39,6 +43,17 @@ type PlexServer struct {
 	Pending           int    `json:"pending" xml:"pending,attr"`
 }
 
+// LastSeen parses LastSeenAt, which Plex reports as a Unix timestamp. It
+// returns nil when the user has never been seen on the server.
+func (s PlexServer) LastSeen() *time.Time {
+	seconds, err := strconv.ParseInt(s.LastSeenAt, 10, 64)
+	if err != nil || seconds <= 0 {
+		return nil
+	}
+	lastSeen := time.Unix(seconds, 0).UTC()
+	return &lastSeen
+}
+
 // PlexUsersResponse represents the XML response structure when fetching users list
 type PlexUsersResponse struct {
 	FriendlyName      string     `xml:"friendlyName,attr"`
@@ -137,6 +152,18 @@ type PlexUserResponse struct {
 	AuthToken string `json:"authToken"`
 }
 
+// PlexHomeUser represents a member of the server owner's Plex Home
+type PlexHomeUser struct {
+	ID                 int    `json:"id"`
+	UUID               string `json:"uuid"`
+	Title              string `json:"title"`
+	Username           string `json:"username"`
+	Email              string `json:"email"`
+	Home               bool   `json:"home"`
+	Restricted         bool   `json:"restricted"`
+	RestrictionProfile string `json:"restrictionProfile"`
+}
+
 // PlexShareResponse represents the JSON returned by the Plex share API
 type PlexShareResponse struct {
 	Accepted     bool       `json:"accepted"`
@@ -197,3 +224,75 @@ type PlexShareResponse struct {
 		FilterTelevision   string  `json:"filterTelevision"`
 	} `json:"sharingSettings"`
 }
+
+// PlexSessionsResponse represents the JSON returned by a server's /status/sessions endpoint
+type PlexSessionsResponse struct {
+	MediaContainer struct {
+		Size     int           `json:"size"`
+		Metadata []PlexSession `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+// PlexSession represents an active playback session on a Plex Media Server
+type PlexSession struct {
+	SessionKey       string `json:"sessionKey"`
+	RatingKey        string `json:"ratingKey"`
+	Type             string `json:"type"`
+	Title            string `json:"title"`
+	GrandparentTitle string `json:"grandparentTitle"`
+	ParentIndex      int    `json:"parentIndex"`
+	Index            int    `json:"index"`
+	Duration         int64  `json:"duration"`
+	ViewOffset       int64  `json:"viewOffset"`
+	User             struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"User"`
+	Player struct {
+		Title    string `json:"title"`
+		Product  string `json:"product"`
+		Platform string `json:"platform"`
+		State    string `json:"state"`
+		Address  string `json:"address"`
+		Local    bool   `json:"local"`
+	} `json:"Player"`
+	Session struct {
+		ID        string `json:"id"`
+		Bandwidth int    `json:"bandwidth"`
+		Location  string `json:"location"`
+	} `json:"Session"`
+	TranscodeSession *struct {
+		VideoDecision string `json:"videoDecision"`
+		AudioDecision string `json:"audioDecision"`
+		Throttled     bool   `json:"throttled"`
+	} `json:"TranscodeSession,omitempty"`
+}
+
+// UserID parses the ID of the user playing the session, which Plex reports as a string
+func (s PlexSession) UserID() int {
+	id, _ := strconv.Atoi(s.User.ID)
+	return id
+}
+
+// DisplayTitle returns the title including the show for episodes, e.g. "Show - S01E02 - Title"
+func (s PlexSession) DisplayTitle() string {
+	if s.Type == "episode" && s.GrandparentTitle != "" {
+		return fmt.Sprintf("%s - S%02dE%02d - %s", s.GrandparentTitle, s.ParentIndex, s.Index, s.Title)
+	}
+	if s.GrandparentTitle != "" {
+		return s.GrandparentTitle + " - " + s.Title
+	}
+	return s.Title
+}
+
+// Decision returns how the session is streamed: directplay, copy (direct
+// stream) or transcode
+func (s PlexSession) Decision() string {
+	if s.TranscodeSession == nil {
+		return "directplay"
+	}
+	if s.TranscodeSession.VideoDecision != "" {
+		return s.TranscodeSession.VideoDecision
+	}
+	return s.TranscodeSession.AudioDecision
+}
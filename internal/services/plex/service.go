@@ -5,31 +5,57 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"plefi/internal/config"
+	"plefi/internal/models"
 	"strings"
+	"sync"
+	"time"
 )
 
 // PlexServicer defines the interface for Plex Media Server API operations
 type PlexServicer interface {
-	// UnshareLibrary removes a user's access to the Plex server
-	UnshareLibrary(ctx context.Context, userID int) error
+	// UnshareLibrary removes a user's access to a Plex server
+	UnshareLibrary(ctx context.Context, machineIdentifier string, userID int) error
+	// CancelShare deletes a share or pending invite by its shared server ID
+	CancelShare(ctx context.Context, machineIdentifier, sharedServerID string) error
 
-	// ShareLibrary shares specific libraries with a Plex user
-	ShareLibrary(ctx context.Context, email string) (*PlexShareResponse, error)
+	// ShareLibrary shares the named libraries, or a server's configured libraries, with a Plex user
+	ShareLibrary(ctx context.Context, machineIdentifier, email string, libraries []string, settings models.SharingSettings) (*PlexShareResponse, error)
 
-	// GetSectionIDsByNames retrieves section IDs that match the provided section names
-	GetSectionIDsByNames(ctx context.Context, sectionNames []string) ([]int, error)
+	// ShareLibraryWithUser shares the named libraries, or a server's configured libraries, with a Plex user by ID
+	ShareLibraryWithUser(ctx context.Context, machineIdentifier string, userID int, libraries []string, settings models.SharingSettings) (*PlexShareResponse, error)
 
-	// GetUsers retrieves all users associated with the Plex server
+	// CreateManagedUser adds a managed user to the server owner's Plex Home
+	CreateManagedUser(ctx context.Context, name, restrictionProfile string) (*PlexHomeUser, error)
+
+	// UpdateShare changes the libraries and sharing settings of an existing share
+	UpdateShare(ctx context.Context, machineIdentifier string, userID int, libraries []string, settings models.SharingSettings) (*PlexShareResponse, error)
+
+	// GetSectionIDsByNames retrieves section IDs on a server that match the provided section names
+	GetSectionIDsByNames(ctx context.Context, machineIdentifier string, sectionNames []string) ([]int, error)
+
+	// GetLibrarySections retrieves all library sections on a Plex server
+	GetLibrarySections(ctx context.Context, machineIdentifier string) ([]PlexLibrarySection, error)
+
+	// ResolveSharedLibraries validates the shared libraries of every configured server and caches their section IDs
+	ResolveSharedLibraries(ctx context.Context) (map[string][]int, error)
+
+	// GetUsers retrieves all users associated with the Plex server, served from cache when fresh
 	GetUsers(ctx context.Context) ([]PlexUser, error)
 
-	// UserHasServerAccess checks if a user is in the users list and has access to the server
-	UserHasServerAccess(ctx context.Context, userID int) (bool, error)
+	// RefreshUsers fetches the users list from Plex, bypassing and repopulating the cache
+	RefreshUsers(ctx context.Context) ([]PlexUser, error)
+
+	// InvalidateUsers drops the cached users list so the next GetUsers call fetches it again
+	InvalidateUsers()
+
+	// UserHasServerAccess checks if a user is in the users list and has access to a server
+	UserHasServerAccess(ctx context.Context, machineIdentifier string, userID int) (bool, error)
 
 	// GetUserDetails retrieves detailed information about the authenticated user
 	GetUserDetails(ctx context.Context, plexToken string) (*PlexDetailedUserResponse, error)
@@ -43,11 +69,17 @@ type PlexServicer interface {
 	// AcceptInvite allows a user to accept a Plex library invitation using the invite token
 	AcceptInvite(ctx context.Context, plexToken string, inviteID int) error
 
+	// GetSessions retrieves the active playback sessions on a Plex server
+	GetSessions(ctx context.Context, machineIdentifier string) ([]PlexSession, error)
+
+	// TerminateSession stops a playback session on a Plex server, showing the reason to the user
+	TerminateSession(ctx context.Context, machineIdentifier, sessionID, reason string) error
+
 	// GetMachineIdentity returns the server's machineIdentifier from the identity endpoint
 	GetMachineIdentity(ctx context.Context, url, plexToken string) (string, error)
 
-	// CheckUserHasAccess checks if a user has access to the server
-	CheckUserHasAccess(users map[int]PlexUser, userID int) bool
+	// CheckUserHasAccess checks if a user has access to a server
+	CheckUserHasAccess(users map[int]PlexUser, machineIdentifier string, userID int) bool
 }
 
 // Verify that PlexService implements the PlexServicer interface
@@ -55,22 +87,114 @@ var _ PlexServicer = (*PlexService)(nil)
 
 // PlexService handles interactions with the Plex Media Server API
 type PlexService struct {
-	client *http.Client
-	token  string
+	exec  *requestExecutor // Requests to plex.tv
+	token string
+	users *usersCache
+
+	// Each Plex Media Server has its own executor, so that an unreachable
+	// server doesn't open the circuit breaker of plex.tv or other servers
+	client        *http.Client
+	policy        RetryPolicy
+	serverExecsMu sync.Mutex
+	serverExecs   map[string]*requestExecutor
+
+	sectionsMu       sync.Mutex
+	sharedSectionIDs map[string][]int
+}
+
+// ErrNotShared is returned when updating a share that doesn't exist
+var ErrNotShared = errors.New("server is not shared with user")
+
+// UnknownLibrariesError is returned when library names don't match any section on the server
+type UnknownLibrariesError struct {
+	Server    string
+	Unknown   []string
+	Available []string
+}
+
+func (e *UnknownLibrariesError) Error() string {
+	return fmt.Sprintf("unknown Plex libraries %q on server %s, available libraries are %q", e.Unknown, e.Server, e.Available)
+}
+
+// usersCache holds the most recently fetched users list
+type usersCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	users     []PlexUser
+	fetchedAt time.Time
+}
+
+func (c *usersCache) get() ([]PlexUser, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.users == nil || time.Since(c.fetchedAt) > c.ttl {
+		return nil, false
+	}
+	return c.users, true
+}
+
+func (c *usersCache) set(users []PlexUser) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users = users
+	c.fetchedAt = time.Now()
+}
+
+func (c *usersCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users = nil
 }
 
 // NewPlexService creates a new PlexService instance
 func NewPlexService(client *http.Client) *PlexService {
+	policy := RetryPolicy{
+		MaxRetries:       config.C.Plex.MaxRetries,
+		BaseDelay:        config.C.Plex.RetryBaseDelay,
+		MaxDelay:         config.C.Plex.RetryMaxDelay,
+		BreakerThreshold: config.C.Plex.CircuitBreakerThreshold,
+		BreakerCooldown:  config.C.Plex.CircuitBreakerCooldown,
+	}
 	return &PlexService{
-		client: client,
-		token:  config.C.Plex.Token.Value(),
+		exec:        newRequestExecutor(client, policy),
+		token:       config.C.Plex.Token.Value(),
+		users:       &usersCache{ttl: config.C.Plex.UsersCacheTTL},
+		client:      client,
+		policy:      policy,
+		serverExecs: make(map[string]*requestExecutor),
 	}
 }
 
-// UnshareLibrary removes a user's access to the Plex server
-func (p *PlexService) UnshareLibrary(ctx context.Context, userID int) error {
-	url := fmt.Sprintf("https://plex.tv/api/v2/sharings/%d", userID)
+// serverExec returns the executor of requests to the Plex Media Server at host
+func (p *PlexService) serverExec(host string) *requestExecutor {
+	p.serverExecsMu.Lock()
+	defer p.serverExecsMu.Unlock()
+	exec, ok := p.serverExecs[host]
+	if !ok {
+		exec = newRequestExecutor(p.client, p.policy)
+		p.serverExecs[host] = exec
+	}
+	return exec
+}
 
+// UnshareLibrary removes a user's access to a Plex server. Users the server
+// isn't shared with are ignored.
+func (p *PlexService) UnshareLibrary(ctx context.Context, machineIdentifier string, userID int) error {
+	sharedServerID, err := p.sharedServerID(ctx, machineIdentifier, userID)
+	if errors.Is(err, ErrNotShared) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.CancelShare(ctx, machineIdentifier, sharedServerID)
+}
+
+// CancelShare deletes a shared server record by its ID. This removes an accepted
+// share as well as cancelling an invite that hasn't been accepted yet.
+func (p *PlexService) CancelShare(ctx context.Context, machineIdentifier, sharedServerID string) error {
+	url := fmt.Sprintf("%s/api/servers/%s/shared_servers/%s", config.C.Plex.ApiUrl, machineIdentifier, sharedServerID)
 	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create unshare request: %w", err)
@@ -78,50 +202,147 @@ func (p *PlexService) UnshareLibrary(ctx context.Context, userID int) error {
 
 	p.setCommonHeaders(req)
 
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return fmt.Errorf("unshare request failed: %w", err)
 	}
-	defer resp.Body.Close()
+	p.InvalidateUsers()
+	return resp.expectStatus("unshare library", http.StatusOK, http.StatusNoContent)
+}
+
+// UpdateShare changes the libraries and sharing settings of an existing share in
+// place, so the user doesn't receive a new invite. When libraries is empty the
+// server's configured shared libraries are used.
+func (p *PlexService) UpdateShare(
+	ctx context.Context,
+	machineIdentifier string,
+	userID int,
+	libraries []string,
+	settings models.SharingSettings,
+) (*PlexShareResponse, error) {
+	sharedServerID, err := p.sharedServerID(ctx, machineIdentifier, userID)
+	if err != nil {
+		return nil, err
+	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		slog.Debug("Unshare library failed",
-			"status", resp.Status,
-			"response", string(body),
-			"userID", userID)
-		return fmt.Errorf("unshare API returned error status: %d %s", resp.StatusCode, resp.Status)
+	sectionIDs, err := p.sectionIDs(ctx, machineIdentifier, libraries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get section IDs: %w", err)
 	}
 
-	return nil
+	payloadBytes, err := json.Marshal(map[string]interface{}{
+		"librarySectionIds": sectionIDs,
+		"settings":          sharingSettingsPayload(settings),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		fmt.Sprintf("%s/api/v2/shared_servers/%s", config.C.Plex.ClientsUrl, sharedServerID),
+		bytes.NewReader(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create update share request: %w", err)
+	}
+	p.setCommonHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.exec.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("update share request failed: %w", err)
+	}
+	p.InvalidateUsers()
+	if err := resp.expectStatus("update share", http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var shareResponse PlexShareResponse
+	if err := json.Unmarshal(resp.Body, &shareResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse share response: %w", err)
+	}
+	return &shareResponse, nil
+}
+
+// sharedServerID looks up the shared server record of a user on a server
+func (p *PlexService) sharedServerID(ctx context.Context, machineIdentifier string, userID int) (string, error) {
+	users, err := p.RefreshUsers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get users: %w", err)
+	}
+	for _, user := range users {
+		if user.ID != userID {
+			continue
+		}
+		for _, server := range user.Servers {
+			if server.MachineIdentifier == machineIdentifier {
+				return server.ID, nil
+			}
+		}
+	}
+	return "", ErrNotShared
 }
 
-// ShareLibrary shares specific libraries with a Plex user
-func (p *PlexService) ShareLibrary(ctx context.Context, email string) (*PlexShareResponse, error) {
+// sharingSettingsPayload converts sharing settings to the shared_servers API format
+func sharingSettingsPayload(settings models.SharingSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"allowSync":          settings.AllowSync,
+		"allowChannels":      settings.AllowChannels,
+		"allowSubtitleAdmin": settings.AllowSubtitleAdmin,
+		"allowTuners":        settings.AllowTuners,
+		"filterMovies":       settings.FilterMovies.String(),
+		"filterMusic":        settings.FilterMusic.String(),
+		"filterPhotos":       "",
+		"filterTelevision":   settings.FilterTelevision.String(),
+	}
+}
+
+// ShareLibrary shares libraries with a Plex user using the given sharing
+// settings. When libraries is empty the server's configured shared libraries are used.
+func (p *PlexService) ShareLibrary(
+	ctx context.Context,
+	machineIdentifier, email string,
+	libraries []string,
+	settings models.SharingSettings,
+) (*PlexShareResponse, error) {
 	if email == "" {
 		return nil, fmt.Errorf("email cannot be empty")
 	}
+	return p.share(ctx, machineIdentifier, "invitedEmail", email, libraries, settings)
+}
+
+// ShareLibraryWithUser shares libraries with a Plex user by ID, for managed
+// users that have no email address. When libraries is empty the server's
+// configured shared libraries are used.
+func (p *PlexService) ShareLibraryWithUser(
+	ctx context.Context,
+	machineIdentifier string,
+	userID int,
+	libraries []string,
+	settings models.SharingSettings,
+) (*PlexShareResponse, error) {
+	return p.share(ctx, machineIdentifier, "invitedId", userID, libraries, settings)
+}
 
-	sectionIDs, err := p.GetSectionIDsByNames(ctx, config.C.Plex.SharedLibraries)
+// share creates a shared server record for the user identified by inviteeKey
+func (p *PlexService) share(
+	ctx context.Context,
+	machineIdentifier string,
+	inviteeKey string,
+	invitee interface{},
+	libraries []string,
+	settings models.SharingSettings,
+) (*PlexShareResponse, error) {
+	sectionIDs, err := p.sectionIDs(ctx, machineIdentifier, libraries)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get section IDs: %w", err)
 	}
 
 	payload := map[string]interface{}{
-		"invitedEmail":      email,
-		"machineIdentifier": config.C.Plex.MachineIdentifier,
+		inviteeKey:          invitee,
+		"machineIdentifier": machineIdentifier,
 		"librarySectionIds": sectionIDs,
 		"skipFriendship":    true,
-		"settings": map[string]interface{}{
-			"allowSync":          false,
-			"allowChannels":      false,
-			"allowSubtitleAdmin": false,
-			"allowTuners":        0,
-			"filterMovies":       "",
-			"filterMusic":        "",
-			"filterPhotos":       "",
-			"filterTelevision":   "",
-		},
+		"settings":          sharingSettingsPayload(settings),
 	}
 
 	payloadBytes, err := json.Marshal(payload)
@@ -129,8 +350,8 @@ func (p *PlexService) ShareLibrary(ctx context.Context, email string) (*PlexShar
 		return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://clients.plex.tv/api/v2/shared_servers",
-		bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.C.Plex.ClientsUrl+"/api/v2/shared_servers",
+		bytes.NewReader(payloadBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create share request: %w", err)
 	}
@@ -138,47 +359,82 @@ func (p *PlexService) ShareLibrary(ctx context.Context, email string) (*PlexShar
 	p.setCommonHeaders(req)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("share request failed: %w", err)
 	}
-	defer resp.Body.Close()
+	p.InvalidateUsers()
+
+	if err := resp.expectStatus("share library", http.StatusOK, http.StatusCreated); err != nil {
+		if IsUnauthorized(err) {
+			slog.Warn("Unauthorized Plex token", inviteeKey, invitee)
+		}
+		return nil, err
+	}
+
+	var shareResp PlexShareResponse
+	if err := json.Unmarshal(resp.Body, &shareResp); err != nil {
+		return nil, fmt.Errorf("failed to parse share response: %w", err)
+	}
+	return &shareResp, nil
+}
+
+// CreateManagedUser adds a managed user without their own Plex account to the
+// server owner's Plex Home, restricted by the given Home restriction profile
+func (p *PlexService) CreateManagedUser(ctx context.Context, name, restrictionProfile string) (*PlexHomeUser, error) {
+	if name == "" {
+		return nil, fmt.Errorf("name cannot be empty")
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	payloadBytes, err := json.Marshal(map[string]interface{}{
+		"friendlyName":       name,
+		"restrictionProfile": restrictionProfile,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
 	}
 
-	// Check response status code
-	switch resp.StatusCode {
-	case http.StatusOK, http.StatusCreated:
-		var shareResp PlexShareResponse
-		if err := json.Unmarshal(body, &shareResp); err != nil {
-			return nil, fmt.Errorf("failed to parse share response: %w", err)
-		}
-		return &shareResp, nil
-	case http.StatusUnauthorized:
-		slog.Warn("Unauthorized Plex token", "email", email)
-		return nil, fmt.Errorf("invalid Plex token")
-	case http.StatusBadRequest:
-		// Try to parse structured error if available
-		var plexErr PlexErrorResponse
-		if err := json.Unmarshal(body, &plexErr); err == nil && len(plexErr.Errors) > 0 {
-			return nil, fmt.Errorf("bad request: %s", plexErr.Errors[0].Message)
-		}
-		return nil, fmt.Errorf("bad request: %s", string(body))
-	default:
-		slog.Debug("Share library failed",
-			"status", resp.Status,
-			"response", string(body),
-			"email", email)
-		return nil, fmt.Errorf("API returned unexpected status: %d %s", resp.StatusCode, resp.Status)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.C.Plex.ApiUrl+"/api/v2/home/users/restricted",
+		bytes.NewReader(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create managed user request: %w", err)
+	}
+
+	p.setCommonHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.exec.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("managed user request failed: %w", err)
+	}
+	p.InvalidateUsers()
+	if err := resp.expectStatus("create managed user", http.StatusOK, http.StatusCreated); err != nil {
+		return nil, err
+	}
+
+	var user PlexHomeUser
+	if err := json.Unmarshal(resp.Body, &user); err != nil {
+		return nil, fmt.Errorf("failed to parse managed user response: %w", err)
 	}
+	return &user, nil
 }
 
-// GetUsers retrieves all users associated with the Plex server
+// GetUsers retrieves all users associated with the Plex server, served from cache when fresh
 func (p *PlexService) GetUsers(ctx context.Context) ([]PlexUser, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://clients.plex.tv/api/users", nil)
+	if users, ok := p.users.get(); ok {
+		return users, nil
+	}
+	return p.RefreshUsers(ctx)
+}
+
+// InvalidateUsers drops the cached users list so the next GetUsers call fetches it again
+func (p *PlexService) InvalidateUsers() {
+	p.users.invalidate()
+}
+
+// RefreshUsers fetches the users list from Plex, bypassing and repopulating the cache
+func (p *PlexService) RefreshUsers(ctx context.Context) ([]PlexUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.C.Plex.ClientsUrl+"/api/users", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -187,79 +443,167 @@ func (p *PlexService) GetUsers(ctx context.Context) ([]PlexUser, error) {
 	// Override the Accept header to ensure we get XML response
 	req.Header.Set("Accept", "application/xml")
 
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request to get users failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		slog.Debug("Get users failed",
-			"status", resp.Status,
-			"response", string(body))
-		return nil, fmt.Errorf("API returned error status: %d %s", resp.StatusCode, resp.Status)
+	if err := resp.expectStatus("get users", http.StatusOK); err != nil {
+		return nil, err
 	}
 
 	var usersResponse PlexUsersResponse
-	if err := xml.Unmarshal(body, &usersResponse); err != nil {
+	if err := xml.Unmarshal(resp.Body, &usersResponse); err != nil {
 		slog.Debug("Failed to unmarshal XML response",
 			"error", err,
-			"response_sample", string(body[:min(500, len(body))]))
+			"response_sample", string(resp.Body[:min(500, len(resp.Body))]))
 		return nil, fmt.Errorf("failed to parse XML response: %w", err)
 	}
 
-	return usersResponse.Users, nil
+	users := usersResponse.Users
+	if users == nil {
+		users = []PlexUser{}
+	}
+	p.users.set(users)
+	return users, nil
 }
 
-// GetSectionIDsByNames retrieves section IDs that match the provided section names
-func (p *PlexService) GetSectionIDsByNames(ctx context.Context, sectionNames []string) ([]int, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://plex.tv/api/v2/servers/%s", config.C.Plex.MachineIdentifier), nil)
+// GetLibrarySections retrieves all library sections on a Plex server
+func (p *PlexService) GetLibrarySections(ctx context.Context, machineIdentifier string) ([]PlexLibrarySection, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v2/servers/%s", config.C.Plex.ApiUrl, machineIdentifier), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	p.setCommonHeaders(req)
 
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		slog.Debug("Get section IDs failed",
-			"status", resp.Status,
-			"response", string(body))
-		return nil, fmt.Errorf("API returned error status: %d %s", resp.StatusCode, resp.Status)
+	if err := resp.expectStatus("get library sections", http.StatusOK); err != nil {
+		return nil, err
 	}
 
 	var serverInfo PlexServerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&serverInfo); err != nil {
+	if err := json.Unmarshal(resp.Body, &serverInfo); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
 	}
+	return serverInfo.LibrarySections, nil
+}
+
+// GetSectionIDsByNames retrieves section IDs on a server that match the provided
+// section names. Names are matched case-insensitively; if any name doesn't
+// match, the IDs of the matching sections are returned along with an
+// *UnknownLibrariesError.
+func (p *PlexService) GetSectionIDsByNames(ctx context.Context, machineIdentifier string, sectionNames []string) ([]int, error) {
+	sections, err := p.GetLibrarySections(ctx, machineIdentifier)
+	if err != nil {
+		return nil, err
+	}
 
 	// Find matching section IDs
-	sectionNameToID := make(map[string]int, len(serverInfo.LibrarySections))
-	for _, section := range serverInfo.LibrarySections {
+	sectionNameToID := make(map[string]int, len(sections))
+	available := make([]string, 0, len(sections))
+	for _, section := range sections {
 		sectionNameToID[strings.ToLower(section.Title)] = section.ID
+		available = append(available, section.Title)
 	}
 
 	sectionIDs := make([]int, 0, len(sectionNames))
+	var unknown []string
 	for _, name := range sectionNames {
-		if id, ok := sectionNameToID[strings.ToLower(name)]; ok {
+		if id, ok := sectionNameToID[strings.ToLower(strings.TrimSpace(name))]; ok {
 			sectionIDs = append(sectionIDs, id)
+		} else {
+			unknown = append(unknown, name)
 		}
 	}
+	if len(unknown) > 0 {
+		return sectionIDs, &UnknownLibrariesError{Server: machineIdentifier, Unknown: unknown, Available: available}
+	}
 	return sectionIDs, nil
 }
 
-// UserHasServerAccess checks if a user is in the users list and has access to the server
-func (p *PlexService) UserHasServerAccess(ctx context.Context, userID int) (bool, error) {
+// ResolveSharedLibraries validates the shared libraries of every configured
+// server and caches their section IDs, keyed by machine identifier, for
+// subsequent shares. Unknown libraries are an error unless
+// plex.strict_libraries is disabled, in which case they are logged and skipped.
+func (p *PlexService) ResolveSharedLibraries(ctx context.Context) (map[string][]int, error) {
+	resolved := make(map[string][]int, len(config.C.Plex.Servers))
+	for _, server := range config.C.Plex.Servers {
+		sectionIDs, err := p.resolveServerLibraries(ctx, server)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %w", server.Name, err)
+		}
+		resolved[server.MachineIdentifier] = sectionIDs
+	}
+
+	p.sectionsMu.Lock()
+	p.sharedSectionIDs = resolved
+	p.sectionsMu.Unlock()
+	return resolved, nil
+}
+
+func (p *PlexService) resolveServerLibraries(ctx context.Context, server config.PlexServerConfig) ([]int, error) {
+	if len(server.SharedLibraries) == 0 {
+		return nil, errors.New("no shared libraries configured")
+	}
+
+	sectionIDs, err := p.GetSectionIDsByNames(ctx, server.MachineIdentifier, server.SharedLibraries)
+	var unknownErr *UnknownLibrariesError
+	if errors.As(err, &unknownErr) && !config.C.Plex.StrictLibraries {
+		slog.Warn("Ignoring unknown shared libraries",
+			"server", server.Name,
+			"unknown", unknownErr.Unknown,
+			"available", unknownErr.Available)
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(sectionIDs) == 0 {
+		return nil, errors.New("none of the configured shared libraries exist on the server")
+	}
+	return sectionIDs, nil
+}
+
+// sectionIDs returns the section IDs of the named libraries on a server, or
+// of its configured shared libraries when libraries is empty
+func (p *PlexService) sectionIDs(ctx context.Context, machineIdentifier string, libraries []string) ([]int, error) {
+	if len(libraries) == 0 {
+		return p.resolvedSectionIDs(ctx, machineIdentifier)
+	}
+	return p.GetSectionIDsByNames(ctx, machineIdentifier, libraries)
+}
+
+// resolvedSectionIDs returns the cached shared section IDs of a server, resolving them on first use
+func (p *PlexService) resolvedSectionIDs(ctx context.Context, machineIdentifier string) ([]int, error) {
+	p.sectionsMu.Lock()
+	sectionIDs, ok := p.sharedSectionIDs[machineIdentifier]
+	p.sectionsMu.Unlock()
+	if ok {
+		return sectionIDs, nil
+	}
+
+	server, ok := config.C.Plex.Server(machineIdentifier)
+	if !ok {
+		return nil, fmt.Errorf("unknown Plex server %s", machineIdentifier)
+	}
+	sectionIDs, err := p.resolveServerLibraries(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	p.sectionsMu.Lock()
+	if p.sharedSectionIDs == nil {
+		p.sharedSectionIDs = make(map[string][]int)
+	}
+	p.sharedSectionIDs[machineIdentifier] = sectionIDs
+	p.sectionsMu.Unlock()
+	return sectionIDs, nil
+}
+
+// UserHasServerAccess checks if a user is in the users list and has access to a server
+func (p *PlexService) UserHasServerAccess(ctx context.Context, machineIdentifier string, userID int) (bool, error) {
 	users, err := p.GetUsers(ctx)
 	if err != nil {
 		return false, fmt.Errorf("failed to get users: %w", err)
@@ -268,10 +612,10 @@ func (p *PlexService) UserHasServerAccess(ctx context.Context, userID int) (bool
 	for _, user := range users {
 		userMap[user.ID] = user
 	}
-	return p.CheckUserHasAccess(userMap, userID), nil
+	return p.CheckUserHasAccess(userMap, machineIdentifier, userID), nil
 }
 
-func (p *PlexService) CheckUserHasAccess(users map[int]PlexUser, userID int) bool {
+func (p *PlexService) CheckUserHasAccess(users map[int]PlexUser, machineIdentifier string, userID int) bool {
 	if config.C.Plex.AdminUserID == userID {
 		return true
 	}
@@ -280,41 +624,34 @@ func (p *PlexService) CheckUserHasAccess(users map[int]PlexUser, userID int) boo
 		return false
 	}
 
-	serverID := config.C.Plex.MachineIdentifier
 	for _, server := range user.Servers {
-		if server.MachineIdentifier == serverID {
+		if server.MachineIdentifier == machineIdentifier {
 			return true
 		}
 	}
-	// User found but doesn't have access to our server
+	// User found but doesn't have access to the server
 	return false
 }
 
 // GetUserDetails retrieves detailed information about the authenticated user
 func (p *PlexService) GetUserDetails(ctx context.Context, plexToken string) (*PlexDetailedUserResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://plex.tv/api/v2/user", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.C.Plex.ApiUrl+"/api/v2/user", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user details request: %w", err)
 	}
 	p.setCommonHeaders(req)
 	req.Header.Set("X-Plex-Token", plexToken)
 
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("user details request failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		slog.Debug("Get user details failed",
-			"status", resp.Status,
-			"response", string(body))
-		return nil, fmt.Errorf("API returned error status: %d %s", resp.StatusCode, resp.Status)
+	if err := resp.expectStatus("get user details", http.StatusOK); err != nil {
+		return nil, err
 	}
 
 	var userDetails PlexDetailedUserResponse
-	if err := json.NewDecoder(resp.Body).Decode(&userDetails); err != nil {
+	if err := json.Unmarshal(resp.Body, &userDetails); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
 	}
 
@@ -323,11 +660,7 @@ func (p *PlexService) GetUserDetails(ctx context.Context, plexToken string) (*Pl
 
 func (p *PlexService) ClaimPin(c context.Context, pinID int) (*PlexPinResponse, error) {
 	// Create the request URL with the PIN ID
-	reqURL := fmt.Sprintf("https://plex.tv/api/v2/pins/%d", pinID)
-
-	// Create form data
-	formData := url.Values{}
-	formData.Set("X-Plex-Client-Identifier", config.C.Plex.ClientID)
+	reqURL := fmt.Sprintf("%s/api/v2/pins/%d", config.C.Plex.ApiUrl, pinID)
 
 	// Create the request with context
 	req, err := http.NewRequestWithContext(
@@ -342,21 +675,17 @@ func (p *PlexService) ClaimPin(c context.Context, pinID int) (*PlexPinResponse,
 	p.setCommonHeaders(req)
 
 	// Execute the request
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute PIN check request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	if err := resp.expectStatus("claim PIN", http.StatusOK); err != nil {
+		return nil, err
 	}
 
 	// Parse the response
 	var pinResponse PlexPinResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pinResponse); err != nil {
+	if err := json.Unmarshal(resp.Body, &pinResponse); err != nil {
 		return nil, fmt.Errorf("failed to parse PIN check response: %w", err)
 	}
 
@@ -375,8 +704,8 @@ func (p *PlexService) GeneratePin(c context.Context) (*PlexPinResponse, error) {
 	req, err := http.NewRequestWithContext(
 		c,
 		http.MethodPost,
-		"https://plex.tv/api/v2/pins",
-		bytes.NewBufferString(formData.Encode()),
+		config.C.Plex.ApiUrl+"/api/v2/pins",
+		strings.NewReader(formData.Encode()),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create PIN request: %w", err)
@@ -387,21 +716,17 @@ func (p *PlexService) GeneratePin(c context.Context) (*PlexPinResponse, error) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	// Execute the request
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute PIN request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	if err := resp.expectStatus("generate PIN", http.StatusOK, http.StatusCreated); err != nil {
+		return nil, err
 	}
 
 	// Parse the response
 	var pinResponse PlexPinResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pinResponse); err != nil {
+	if err := json.Unmarshal(resp.Body, &pinResponse); err != nil {
 		return nil, fmt.Errorf("failed to parse PIN response: %w", err)
 	}
 
@@ -410,7 +735,7 @@ func (p *PlexService) GeneratePin(c context.Context) (*PlexPinResponse, error) {
 
 // AcceptInvite allows a user to accept a Plex library invitation using the invite token
 func (p *PlexService) AcceptInvite(ctx context.Context, plexToken string, inviteID int) error {
-	reqURL := fmt.Sprintf("https://plex.tv/api/v2/shared_servers/%d/accept", inviteID)
+	reqURL := fmt.Sprintf("%s/api/v2/shared_servers/%d/accept", config.C.Plex.ApiUrl, inviteID)
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create accept invite request: %w", err)
@@ -418,21 +743,11 @@ func (p *PlexService) AcceptInvite(ctx context.Context, plexToken string, invite
 
 	p.setCommonHeaders(req)
 	req.Header.Set("X-Plex-Token", plexToken)
-	resp, err := p.client.Do(req)
+	resp, err := p.exec.do(req)
 	if err != nil {
 		return fmt.Errorf("accept invite request failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		slog.Debug("Accept invite failed",
-			"status", resp.Status,
-			"response", string(body))
-		return fmt.Errorf("accept invite API returned error status: %d %s", resp.StatusCode, resp.Status)
-	}
-
-	return nil
+	return resp.expectStatus("accept invite", http.StatusOK, http.StatusNoContent)
 }
 
 // GetMachineIdentity retrieves the machineIdentifier from the Plex identity endpoint
@@ -445,15 +760,12 @@ func (p *PlexService) GetMachineIdentity(ctx context.Context, url, plexToken str
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("X-Plex-Token", plexToken)
 
-	resp, err := p.client.Do(req)
+	resp, err := p.serverExec(req.URL.Host).do(req)
 	if err != nil {
 		return "", fmt.Errorf("identity request failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("unexpected status: %d %s", resp.StatusCode, string(body))
+	if err := resp.expectStatus("get machine identity", http.StatusOK); err != nil {
+		return "", err
 	}
 
 	var ir struct {
@@ -461,13 +773,68 @@ func (p *PlexService) GetMachineIdentity(ctx context.Context, url, plexToken str
 			MachineIdentifier string `json:"machineIdentifier"`
 		} `json:"MediaContainer"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&ir); err != nil {
+	if err := json.Unmarshal(resp.Body, &ir); err != nil {
 		return "", fmt.Errorf("failed to parse identity response: %w", err)
 	}
 
 	return ir.MediaContainer.MachineIdentifier, nil
 }
 
+// GetSessions retrieves the active playback sessions from the server's
+// /status/sessions endpoint, authenticated with the server's token
+func (p *PlexService) GetSessions(ctx context.Context, machineIdentifier string) ([]PlexSession, error) {
+	server, ok := config.C.Plex.Server(machineIdentifier)
+	if !ok {
+		return nil, fmt.Errorf("unknown server %q", machineIdentifier)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.Url+"/status/sessions", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sessions request: %w", err)
+	}
+	p.setCommonHeaders(req)
+	req.Header.Set("X-Plex-Token", server.Token.Value())
+
+	resp, err := p.serverExec(req.URL.Host).do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sessions request failed: %w", err)
+	}
+	if err := resp.expectStatus("get sessions", http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var sessions PlexSessionsResponse
+	if err := json.Unmarshal(resp.Body, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to parse sessions response: %w", err)
+	}
+	return sessions.MediaContainer.Metadata, nil
+}
+
+// TerminateSession stops a playback session through the server's
+// /status/sessions/terminate endpoint. The reason is shown to the user.
+func (p *PlexService) TerminateSession(ctx context.Context, machineIdentifier, sessionID, reason string) error {
+	server, ok := config.C.Plex.Server(machineIdentifier)
+	if !ok {
+		return fmt.Errorf("unknown server %q", machineIdentifier)
+	}
+
+	query := url.Values{}
+	query.Set("sessionId", sessionID)
+	query.Set("reason", reason)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.Url+"/status/sessions/terminate?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create terminate request: %w", err)
+	}
+	p.setCommonHeaders(req)
+	req.Header.Set("X-Plex-Token", server.Token.Value())
+
+	resp, err := p.serverExec(req.URL.Host).do(req)
+	if err != nil {
+		return fmt.Errorf("terminate request failed: %w", err)
+	}
+	return resp.expectStatus("terminate session", http.StatusOK, http.StatusNoContent)
+}
+
 // setCommonHeaders sets the common headers used in Plex API requests
 func (p *PlexService) setCommonHeaders(req *http.Request) {
 	req.Header.Set("X-Plex-Token", p.token)
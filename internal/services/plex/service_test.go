@@ -0,0 +1,388 @@
+package plex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"plefi/internal/config"
+	"plefi/internal/models"
+	"plefi/internal/services/plex"
+	"plefi/internal/services/plex/fake"
+)
+
+// newTestService starts a fake Plex server and configures a PlexService against it
+func newTestService(t *testing.T) (*plex.PlexService, *fake.Server) {
+	t.Helper()
+	fakeServer := fake.NewServer()
+	ts := httptest.NewServer(fakeServer)
+	t.Cleanup(ts.Close)
+
+	config.C.Plex = config.PlexConfig{
+		ClientID:    "plefi-test",
+		ProductName: "plefi",
+		AdminUserID: fakeServer.Owner().ID,
+		Token:       config.Secret(fake.OwnerToken),
+		ApiUrl:      ts.URL,
+		ClientsUrl:  ts.URL,
+		AppUrl:      ts.URL,
+		Servers: []config.PlexServerConfig{{
+			Name:              "main",
+			Url:               ts.URL,
+			Token:             config.Secret(fake.OwnerToken),
+			MachineIdentifier: fakeServer.MachineIdentifier(),
+			SharedLibraries:   []string{"Movies", "tv shows", "Missing"},
+		}},
+	}
+	return plex.NewPlexService(&http.Client{}), fakeServer
+}
+
+func TestPinLogin(t *testing.T) {
+	svc, fakeServer := newTestService(t)
+	ctx := context.Background()
+
+	pin, err := svc.GeneratePin(ctx)
+	if err != nil {
+		t.Fatalf("GeneratePin() error = %v", err)
+	}
+	claimed, err := svc.ClaimPin(ctx, pin.ID)
+	if err != nil {
+		t.Fatalf("ClaimPin() error = %v", err)
+	}
+	if claimed.AuthToken != "" {
+		t.Fatalf("ClaimPin() AuthToken = %q before sign in, want empty", claimed.AuthToken)
+	}
+
+	if err := fakeServer.ClaimPin(pin.Code, 2); err != nil {
+		t.Fatalf("fake ClaimPin() error = %v", err)
+	}
+	claimed, err = svc.ClaimPin(ctx, pin.ID)
+	if err != nil {
+		t.Fatalf("ClaimPin() error = %v", err)
+	}
+	user, err := svc.GetUserDetails(ctx, claimed.AuthToken)
+	if err != nil {
+		t.Fatalf("GetUserDetails() error = %v", err)
+	}
+	if user.ID != 2 || user.Username != "alice" {
+		t.Errorf("GetUserDetails() = %d %q, want 2 %q", user.ID, user.Username, "alice")
+	}
+}
+
+func TestShareLifecycle(t *testing.T) {
+	svc, fakeServer := newTestService(t)
+	ctx := context.Background()
+
+	main := config.C.Plex.Servers[0]
+	machineID, err := svc.GetMachineIdentity(ctx, main.Url, main.Token.Value())
+	if err != nil {
+		t.Fatalf("GetMachineIdentity() error = %v", err)
+	}
+	if machineID != fake.DefaultMachineIdentifier {
+		t.Errorf("GetMachineIdentity() = %q, want %q", machineID, fake.DefaultMachineIdentifier)
+	}
+
+	settings := models.SharingSettings{
+		AllowSync:   true,
+		AllowTuners: models.TunersLiveTV,
+		FilterMovies: models.LibraryFilter{
+			Labels:                []string{"kids"},
+			ExcludeContentRatings: []string{"R", "NC-17"},
+		},
+	}
+	share, err := svc.ShareLibrary(ctx, machineID, "bob@example.com", nil, settings)
+	if err != nil {
+		t.Fatalf("ShareLibrary() error = %v", err)
+	}
+	if share.InvitedID != 3 || share.NumLibraries != 2 {
+		t.Errorf("ShareLibrary() invited %d with %d libraries, want 3 with 2", share.InvitedID, share.NumLibraries)
+	}
+	sent := fakeServer.Shares()[0].Settings
+	if sent["allowSync"] != true || sent["filterMovies"] != "label=kids|contentRating!=R%2CNC-17" {
+		t.Errorf("ShareLibrary() sent settings %v, want sync allowed and movie filter", sent)
+	}
+	if err := svc.AcceptInvite(ctx, "fake-bob-token", share.ID); err != nil {
+		t.Fatalf("AcceptInvite() error = %v", err)
+	}
+
+	hasAccess, err := svc.UserHasServerAccess(ctx, machineID, 3)
+	if err != nil {
+		t.Fatalf("UserHasServerAccess() error = %v", err)
+	}
+	if !hasAccess {
+		t.Errorf("UserHasServerAccess() = false after share, want true")
+	}
+
+	if err := svc.UnshareLibrary(ctx, machineID, 3); err != nil {
+		t.Fatalf("UnshareLibrary() error = %v", err)
+	}
+	hasAccess, err = svc.UserHasServerAccess(ctx, machineID, 3)
+	if err != nil {
+		t.Fatalf("UserHasServerAccess() error = %v", err)
+	}
+	if hasAccess {
+		t.Errorf("UserHasServerAccess() = true after unshare, want false")
+	}
+}
+
+func TestShareLibraryUnknownUser(t *testing.T) {
+	svc, _ := newTestService(t)
+	if _, err := svc.ShareLibrary(context.Background(), fake.DefaultMachineIdentifier, "nobody@example.com", nil, models.SharingSettings{}); err == nil {
+		t.Fatal("ShareLibrary() error = nil for unknown user, want error")
+	}
+}
+
+func TestGetUsersCacheInvalidatedOnShare(t *testing.T) {
+	svc, _ := newTestService(t)
+	config.C.Plex.UsersCacheTTL = time.Hour
+	svc = plex.NewPlexService(&http.Client{})
+	ctx := context.Background()
+
+	users, err := svc.GetUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 0 {
+		t.Fatalf("GetUsers() = %d users, want 0", len(users))
+	}
+
+	if _, err := svc.ShareLibrary(ctx, fake.DefaultMachineIdentifier, "alice@example.com", nil, models.SharingSettings{}); err != nil {
+		t.Fatalf("ShareLibrary() error = %v", err)
+	}
+	users, err = svc.GetUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 1 || users[0].ID != 2 {
+		t.Errorf("GetUsers() after share = %+v, want alice", users)
+	}
+}
+
+func TestResolveSharedLibraries(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	config.C.Plex.StrictLibraries = true
+	_, err := svc.ResolveSharedLibraries(ctx)
+	var unknownErr *plex.UnknownLibrariesError
+	if !errors.As(err, &unknownErr) || len(unknownErr.Unknown) != 1 || unknownErr.Unknown[0] != "Missing" {
+		t.Fatalf("ResolveSharedLibraries() strict error = %v, want unknown library %q", err, "Missing")
+	}
+
+	config.C.Plex.StrictLibraries = false
+	resolved, err := svc.ResolveSharedLibraries(ctx)
+	if err != nil {
+		t.Fatalf("ResolveSharedLibraries() error = %v", err)
+	}
+	if sectionIDs := resolved[fake.DefaultMachineIdentifier]; len(sectionIDs) != 2 || sectionIDs[0] != 1 || sectionIDs[1] != 2 {
+		t.Errorf("ResolveSharedLibraries() = %v, want [1 2]", resolved)
+	}
+}
+
+func TestSharePerServer(t *testing.T) {
+	svc, fakeServer := newTestService(t)
+	fakeServer.AddServer("fake-4k", "4K", []fake.Library{{ID: 10, Title: "Movies 4K", Type: "movie"}})
+	config.C.Plex.Servers = append(config.C.Plex.Servers, config.PlexServerConfig{
+		Name:              "4k",
+		MachineIdentifier: "fake-4k",
+		SharedLibraries:   []string{"Movies 4K"},
+	})
+	ctx := context.Background()
+
+	for _, server := range config.C.Plex.Servers {
+		if _, err := svc.ShareLibrary(ctx, server.MachineIdentifier, "alice@example.com", nil, models.SharingSettings{}); err != nil {
+			t.Fatalf("ShareLibrary(%s) error = %v", server.Name, err)
+		}
+	}
+	if err := svc.UnshareLibrary(ctx, "fake-4k", 2); err != nil {
+		t.Fatalf("UnshareLibrary() error = %v", err)
+	}
+
+	for machineID, want := range map[string]bool{fake.DefaultMachineIdentifier: true, "fake-4k": false} {
+		hasAccess, err := svc.UserHasServerAccess(ctx, machineID, 2)
+		if err != nil {
+			t.Fatalf("UserHasServerAccess() error = %v", err)
+		}
+		if hasAccess != want {
+			t.Errorf("UserHasServerAccess(%s) = %v, want %v", machineID, hasAccess, want)
+		}
+	}
+}
+
+func TestUpdateShare(t *testing.T) {
+	svc, fakeServer := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.UpdateShare(ctx, fake.DefaultMachineIdentifier, 2, nil, models.SharingSettings{}); !errors.Is(err, plex.ErrNotShared) {
+		t.Fatalf("UpdateShare() before sharing error = %v, want ErrNotShared", err)
+	}
+
+	share, err := svc.ShareLibrary(ctx, fake.DefaultMachineIdentifier, "alice@example.com", nil, models.SharingSettings{})
+	if err != nil {
+		t.Fatalf("ShareLibrary() error = %v", err)
+	}
+	updated, err := svc.UpdateShare(ctx, fake.DefaultMachineIdentifier, 2, []string{"Music"}, models.SharingSettings{AllowSync: true})
+	if err != nil {
+		t.Fatalf("UpdateShare() error = %v", err)
+	}
+	if updated.ID != share.ID || updated.NumLibraries != 1 {
+		t.Errorf("UpdateShare() = share %d with %d libraries, want share %d with 1", updated.ID, updated.NumLibraries, share.ID)
+	}
+	if sent := fakeServer.Shares()[0].Settings; sent["allowSync"] != true {
+		t.Errorf("UpdateShare() sent settings %v, want sync allowed", sent)
+	}
+}
+
+func TestShareLibraries(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	share, err := svc.ShareLibrary(ctx, fake.DefaultMachineIdentifier, "alice@example.com", []string{"Music"}, models.SharingSettings{})
+	if err != nil {
+		t.Fatalf("ShareLibrary() error = %v", err)
+	}
+	if share.NumLibraries != 1 {
+		t.Errorf("ShareLibrary() shared %d libraries, want 1", share.NumLibraries)
+	}
+
+	var unknownErr *plex.UnknownLibrariesError
+	if _, err := svc.ShareLibrary(ctx, fake.DefaultMachineIdentifier, "bob@example.com", []string{"Anime"}, models.SharingSettings{}); !errors.As(err, &unknownErr) {
+		t.Errorf("ShareLibrary() with unknown library error = %v, want UnknownLibrariesError", err)
+	}
+}
+
+func TestCancelPendingShare(t *testing.T) {
+	svc, fakeServer := newTestService(t)
+	ctx := context.Background()
+
+	share, err := svc.ShareLibrary(ctx, fake.DefaultMachineIdentifier, "bob@example.com", nil, models.SharingSettings{})
+	if err != nil {
+		t.Fatalf("ShareLibrary() error = %v", err)
+	}
+	if err := svc.CancelShare(ctx, fake.DefaultMachineIdentifier, strconv.Itoa(share.ID)); err != nil {
+		t.Fatalf("CancelShare() error = %v", err)
+	}
+	if shares := fakeServer.Shares(); len(shares) != 0 {
+		t.Errorf("CancelShare() left %d shares, want 0", len(shares))
+	}
+	if err := svc.AcceptInvite(ctx, "fake-bob-token", share.ID); err == nil {
+		t.Error("AcceptInvite() error = nil for cancelled invite, want error")
+	}
+}
+
+func TestManagedUserShare(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	homeUser, err := svc.CreateManagedUser(ctx, "Kid", models.RestrictionProfileLittleKid)
+	if err != nil {
+		t.Fatalf("CreateManagedUser() error = %v", err)
+	}
+	if !homeUser.Home || homeUser.RestrictionProfile != models.RestrictionProfileLittleKid {
+		t.Errorf("CreateManagedUser() = %+v, want restricted Home user", homeUser)
+	}
+
+	share, err := svc.ShareLibraryWithUser(ctx, fake.DefaultMachineIdentifier, homeUser.ID, nil, models.SharingSettings{})
+	if err != nil {
+		t.Fatalf("ShareLibraryWithUser() error = %v", err)
+	}
+	if !share.Accepted || share.InvitedID != homeUser.ID {
+		t.Errorf("ShareLibraryWithUser() = invited %d accepted %v, want %d accepted", share.InvitedID, share.Accepted, homeUser.ID)
+	}
+
+	users, err := svc.GetUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 1 || users[0].Home != 1 || users[0].Email != "" {
+		t.Errorf("GetUsers() = %+v, want the managed Home user", users)
+	}
+}
+
+func TestGetSessions(t *testing.T) {
+	svc, fakeServer := newTestService(t)
+
+	var session plex.PlexSession
+	session.Type = "episode"
+	session.Title = "Pilot"
+	session.GrandparentTitle = "Show"
+	session.ParentIndex, session.Index = 1, 1
+	session.User.ID = "2"
+	session.Session.ID = "session-1"
+	session.Session.Bandwidth = 4000
+	fakeServer.AddSession(session)
+
+	sessions, err := svc.GetSessions(context.Background(), fake.DefaultMachineIdentifier)
+	if err != nil {
+		t.Fatalf("GetSessions() error = %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("GetSessions() = %d sessions, want 1", len(sessions))
+	}
+	got := sessions[0]
+	if got.UserID() != 2 || got.DisplayTitle() != "Show - S01E01 - Pilot" || got.Decision() != "directplay" {
+		t.Errorf("GetSessions() = user %d %q %s, want user 2 %q directplay",
+			got.UserID(), got.DisplayTitle(), got.Decision(), "Show - S01E01 - Pilot")
+	}
+}
+
+func TestServerCircuitBreakerIsolated(t *testing.T) {
+	_, fakeServer := newTestService(t)
+	ctx := context.Background()
+
+	offline := httptest.NewServer(http.NotFoundHandler())
+	offline.Close()
+	config.C.Plex.Servers = append(config.C.Plex.Servers, config.PlexServerConfig{
+		Name:              "offline",
+		Url:               offline.URL,
+		MachineIdentifier: "offline-machine",
+	})
+	config.C.Plex.CircuitBreakerThreshold = 1
+	config.C.Plex.CircuitBreakerCooldown = time.Hour
+	svc := plex.NewPlexService(&http.Client{})
+
+	if _, err := svc.GetSessions(ctx, "offline-machine"); err == nil {
+		t.Fatalf("GetSessions() of offline server error = nil, want connection error")
+	}
+	if _, err := svc.GetSessions(ctx, "offline-machine"); !errors.Is(err, plex.ErrCircuitOpen) {
+		t.Fatalf("GetSessions() of offline server error = %v, want ErrCircuitOpen", err)
+	}
+	if _, err := svc.GetMachineIdentity(ctx, offline.URL, ""); !errors.Is(err, plex.ErrCircuitOpen) {
+		t.Fatalf("GetMachineIdentity() of offline server error = %v, want ErrCircuitOpen", err)
+	}
+
+	// Neither plex.tv nor the other server are affected by the offline server
+	if _, err := svc.GetUsers(ctx); err != nil {
+		t.Errorf("GetUsers() error = %v", err)
+	}
+	if _, err := svc.GetSessions(ctx, fakeServer.MachineIdentifier()); err != nil {
+		t.Errorf("GetSessions() of online server error = %v", err)
+	}
+}
+
+func TestTerminateSession(t *testing.T) {
+	svc, fakeServer := newTestService(t)
+	ctx := context.Background()
+
+	var session plex.PlexSession
+	session.Session.ID = "session-1"
+	fakeServer.AddSession(session)
+
+	if err := svc.TerminateSession(ctx, fake.DefaultMachineIdentifier, "session-1", "Too many streams"); err != nil {
+		t.Fatalf("TerminateSession() error = %v", err)
+	}
+	if reason, ok := fakeServer.TerminationReason("session-1"); !ok || reason != "Too many streams" {
+		t.Errorf("TerminationReason() = %q, %v, want %q", reason, ok, "Too many streams")
+	}
+	sessions, err := svc.GetSessions(ctx, fake.DefaultMachineIdentifier)
+	if err != nil {
+		t.Fatalf("GetSessions() error = %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("GetSessions() after terminate = %d sessions, want 0", len(sessions))
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/checkout/session"
 	"github.com/stripe/stripe-go/v82/customer"
+	"github.com/stripe/stripe-go/v82/customerbalancetransaction"
 	"github.com/stripe/stripe-go/v82/subscription"
 )
 
@@ -44,8 +46,20 @@ type StripeServicer interface {
 
 	// GetActiveSubscriptions returns all active subscriptions for a user
 	GetActiveSubscription(ctx context.Context, user *models.UserInfo) (*models.SubscriptionSummary, error)
+
+	// GetSubscriberIDs returns the Plex user IDs of all customers with an active subscription
+	GetSubscriberIDs(ctx context.Context) (map[int]bool, error)
+
+	// CreditCustomer adds credit to a customer's balance, applied to their next invoices
+	CreditCustomer(ctx context.Context, customerID string, amount int64, currency, description, idempotencyKey string) error
+
+	// ApplySubscriptionCoupon applies a coupon to a user's active subscription
+	ApplySubscriptionCoupon(ctx context.Context, user *models.UserInfo, couponID, idempotencyKey string) error
 }
 
+// ErrNoActiveSubscription is returned when a user has no active subscription
+var ErrNoActiveSubscription = errors.New("no active subscription")
+
 // Verify that StripeService implements the StripeServicer interface
 var _ StripeServicer = (*StripeService)(nil)
 
@@ -255,6 +269,38 @@ func (s *StripeService) GetActiveSubscription(ctx context.Context, user *models.
 	return models.NewSubscriptionSummary(sub), nil
 }
 
+// GetSubscriberIDs returns the Plex user IDs of all customers with an active
+// or trialing subscription, read from the customers' plex_user_id metadata.
+// Only those subscriptions are listed, as Stripe filters by a single status.
+func (s *StripeService) GetSubscriberIDs(ctx context.Context) (map[int]bool, error) {
+	subscribers := make(map[int]bool)
+	for _, status := range []stripe.SubscriptionStatus{stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing} {
+		params := &stripe.SubscriptionListParams{
+			Status: stripe.String(string(status)),
+			ListParams: stripe.ListParams{
+				Context: ctx,
+			},
+		}
+		params.AddExpand("data.customer")
+		iter := subscription.List(params)
+		for iter.Next() {
+			sub := iter.Subscription()
+			if sub.Customer == nil {
+				continue
+			}
+			userID, err := strconv.Atoi(sub.Customer.Metadata["plex_user_id"])
+			if err != nil {
+				continue
+			}
+			subscribers[userID] = true
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return subscribers, nil
+}
+
 func (s *StripeService) CancelAtEndSubscription(ctx context.Context, subscriptionID string) (*models.SubscriptionSummary, error) {
 	// Cancel the subscription
 	sub, err := subscription.Update(subscriptionID, &stripe.SubscriptionParams{
@@ -268,3 +314,73 @@ func (s *StripeService) CancelAtEndSubscription(ctx context.Context, subscriptio
 	}
 	return models.NewSubscriptionSummary(sub), nil
 }
+
+// CreditCustomer adds credit to a customer's balance. Stripe applies the
+// balance to the customer's next invoices. The idempotency key makes retries
+// of the same credit safe.
+func (s *StripeService) CreditCustomer(ctx context.Context, customerID string, amount int64, currency, description, idempotencyKey string) error {
+	// A negative balance transaction is a credit the customer can spend
+	params := &stripe.CustomerBalanceTransactionParams{
+		Customer:    stripe.String(customerID),
+		Amount:      stripe.Int64(-amount),
+		Currency:    stripe.String(currency),
+		Description: stripe.String(description),
+		Params: stripe.Params{
+			Context:        ctx,
+			IdempotencyKey: stripe.String(idempotencyKey),
+		},
+	}
+	_, err := customerbalancetransaction.New(params)
+	return err
+}
+
+// ApplySubscriptionCoupon applies a coupon to the user's active subscription,
+// keeping the discounts it already has. It returns ErrNoActiveSubscription
+// when the user isn't subscribed.
+func (s *StripeService) ApplySubscriptionCoupon(ctx context.Context, user *models.UserInfo, couponID, idempotencyKey string) error {
+	customer, err := s.GetCustomer(ctx, user)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return ErrNoActiveSubscription
+	}
+
+	params := &stripe.SubscriptionListParams{
+		Customer: stripe.String(customer.ID),
+		ListParams: stripe.ListParams{
+			Context: ctx,
+		},
+	}
+	params.AddExpand("data.discounts")
+	iter := subscription.List(params)
+	var sub *stripe.Subscription
+	for iter.Next() {
+		candidate := iter.Subscription()
+		if candidate.Status == stripe.SubscriptionStatusActive || candidate.Status == stripe.SubscriptionStatusTrialing {
+			sub = candidate
+			break
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if sub == nil {
+		return ErrNoActiveSubscription
+	}
+
+	// Setting discounts replaces them, so the existing ones are passed along
+	discounts := make([]*stripe.SubscriptionDiscountParams, 0, len(sub.Discounts)+1)
+	for _, discount := range sub.Discounts {
+		discounts = append(discounts, &stripe.SubscriptionDiscountParams{Discount: stripe.String(discount.ID)})
+	}
+	discounts = append(discounts, &stripe.SubscriptionDiscountParams{Coupon: stripe.String(couponID)})
+	_, err = subscription.Update(sub.ID, &stripe.SubscriptionParams{
+		Discounts: discounts,
+		Params: stripe.Params{
+			Context:        ctx,
+			IdempotencyKey: stripe.String(idempotencyKey),
+		},
+	})
+	return err
+}
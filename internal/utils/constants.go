@@ -3,4 +3,5 @@ package utils
 const (
 	PlexSessionState = "plex_session"
 	UserInfoState    = "user_info"
+	ReferralState    = "referral_code"
 )
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS plex_shares;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS plex_shares (
+    user_id             INT NOT NULL,
+    machine_identifier  TEXT NOT NULL,
+    shared_server_id    TEXT NOT NULL,
+    num_libraries       INT NOT NULL DEFAULT 0,
+    all_libraries       BOOLEAN NOT NULL DEFAULT FALSE,
+    pending             BOOLEAN NOT NULL DEFAULT FALSE,
+    last_seen_at        TIMESTAMP NULL,
+    synced_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, machine_identifier)
+);
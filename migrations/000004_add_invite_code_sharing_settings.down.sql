@@ -0,0 +1 @@
+ALTER TABLE invite_codes DROP COLUMN sharing_settings;
\ No newline at end of file
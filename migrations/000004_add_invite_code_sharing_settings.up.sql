@@ -0,0 +1 @@
+ALTER TABLE invite_codes ADD COLUMN sharing_settings TEXT NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE plex_shares DROP COLUMN invited_at;
+ALTER TABLE plex_shares DROP COLUMN invite_token;
@@ -0,0 +1,2 @@
+ALTER TABLE plex_shares ADD COLUMN invite_token TEXT NULL;
+ALTER TABLE plex_shares ADD COLUMN invited_at TIMESTAMP NULL;
@@ -0,0 +1,4 @@
+DELETE FROM plex_users WHERE email IS NULL;
+ALTER TABLE plex_users DROP COLUMN restriction_profile;
+ALTER TABLE plex_users DROP COLUMN is_managed;
+ALTER TABLE plex_users ALTER COLUMN email SET NOT NULL;
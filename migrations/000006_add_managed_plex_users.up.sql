@@ -0,0 +1,3 @@
+ALTER TABLE plex_users ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE plex_users ADD COLUMN is_managed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE plex_users ADD COLUMN restriction_profile TEXT NULL;
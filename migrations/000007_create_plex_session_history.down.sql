@@ -0,0 +1 @@
+DROP TABLE IF EXISTS plex_session_history;
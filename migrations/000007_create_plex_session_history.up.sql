@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS plex_session_history (
+    id                  SERIAL PRIMARY KEY,
+    session_id          TEXT NOT NULL,
+    machine_identifier  TEXT NOT NULL,
+    user_id             INT NOT NULL,
+    username            TEXT NOT NULL,
+    title               TEXT NOT NULL,
+    media_type          TEXT NOT NULL,
+    player              TEXT NOT NULL,
+    platform            TEXT NOT NULL,
+    state               TEXT NOT NULL,
+    decision            TEXT NOT NULL,
+    bandwidth           INT NOT NULL DEFAULT 0,
+    local               BOOLEAN NOT NULL DEFAULT FALSE,
+    started_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_server_session UNIQUE (machine_identifier, session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_plex_session_history_user_id ON plex_session_history(user_id);
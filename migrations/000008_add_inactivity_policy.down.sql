@@ -0,0 +1,2 @@
+ALTER TABLE plex_users DROP COLUMN inactivity_warned_at;
+ALTER TABLE plex_users DROP COLUMN is_exempt;
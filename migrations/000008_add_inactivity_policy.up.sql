@@ -0,0 +1,2 @@
+ALTER TABLE plex_users ADD COLUMN is_exempt BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE plex_users ADD COLUMN inactivity_warned_at TIMESTAMP NULL;
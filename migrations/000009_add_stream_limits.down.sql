@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stream_enforcements;
+
+ALTER TABLE plex_users DROP COLUMN entitlement_name;
@@ -0,0 +1,17 @@
+ALTER TABLE plex_users ADD COLUMN entitlement_name TEXT NULL;
+
+CREATE TABLE IF NOT EXISTS stream_enforcements (
+    id                  SERIAL PRIMARY KEY,
+    user_id             INT NOT NULL,
+    username            TEXT NOT NULL,
+    machine_identifier  TEXT NOT NULL,
+    session_id          TEXT NOT NULL,
+    title               TEXT NOT NULL,
+    player              TEXT NOT NULL,
+    active_streams      INT NOT NULL,
+    max_streams         INT NOT NULL,
+    message             TEXT NOT NULL,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_enforcements_user_id ON stream_enforcements(user_id);
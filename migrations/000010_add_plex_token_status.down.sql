@@ -0,0 +1,3 @@
+ALTER TABLE plex_tokens DROP COLUMN invalidated_at;
+ALTER TABLE plex_tokens DROP COLUMN validated_at;
+ALTER TABLE plex_tokens DROP COLUMN is_valid;
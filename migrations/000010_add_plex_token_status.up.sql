@@ -0,0 +1,3 @@
+ALTER TABLE plex_tokens ADD COLUMN is_valid BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE plex_tokens ADD COLUMN validated_at TIMESTAMP NULL;
+ALTER TABLE plex_tokens ADD COLUMN invalidated_at TIMESTAMP NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE plex_tokens DROP COLUMN data_key;
+ALTER TABLE plex_tokens DROP COLUMN key_id;
@@ -0,0 +1,2 @@
+ALTER TABLE plex_tokens ADD COLUMN key_id TEXT NULL;
+ALTER TABLE plex_tokens ADD COLUMN data_key TEXT NULL;
@@ -0,0 +1 @@
+ALTER TABLE invite_codes DROP COLUMN sharing_profile;
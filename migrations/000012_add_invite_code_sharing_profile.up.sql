@@ -0,0 +1 @@
+ALTER TABLE invite_codes ADD COLUMN sharing_profile TEXT NULL;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_plex_user_invites_access_ends_at;
+
+ALTER TABLE plex_user_invites DROP COLUMN revoked_at;
+ALTER TABLE plex_user_invites DROP COLUMN access_ends_at;
+
+ALTER TABLE invite_codes ADD COLUMN duration TIMESTAMP NULL;
+UPDATE invite_codes
+   SET duration = created_at + duration_days * INTERVAL '1 day'
+ WHERE duration_days IS NOT NULL;
+ALTER TABLE invite_codes DROP COLUMN duration_days;
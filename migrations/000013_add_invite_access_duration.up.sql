@@ -0,0 +1,12 @@
+-- duration was a date compared against the claim time, convert it to the
+-- number of days of access it was meant to grant
+ALTER TABLE invite_codes ADD COLUMN duration_days INT NULL;
+UPDATE invite_codes
+   SET duration_days = GREATEST(1, CEIL(EXTRACT(EPOCH FROM (duration - created_at)) / 86400))
+ WHERE duration IS NOT NULL;
+ALTER TABLE invite_codes DROP COLUMN duration;
+
+ALTER TABLE plex_user_invites ADD COLUMN access_ends_at TIMESTAMP NULL;
+ALTER TABLE plex_user_invites ADD COLUMN revoked_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS idx_plex_user_invites_access_ends_at ON plex_user_invites(access_ends_at);
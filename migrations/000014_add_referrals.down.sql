@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS referral_rewards;
+
+DROP INDEX IF EXISTS idx_plex_users_referred_by;
+
+ALTER TABLE plex_users DROP CONSTRAINT fk_referred_by;
+ALTER TABLE plex_users DROP COLUMN referred_at;
+ALTER TABLE plex_users DROP COLUMN referred_by;
+ALTER TABLE plex_users DROP COLUMN referral_code;
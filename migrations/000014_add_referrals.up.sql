@@ -0,0 +1,24 @@
+ALTER TABLE plex_users ADD COLUMN referral_code TEXT NULL UNIQUE;
+ALTER TABLE plex_users ADD COLUMN referred_by INT NULL;
+ALTER TABLE plex_users ADD COLUMN referred_at TIMESTAMP NULL;
+ALTER TABLE plex_users ADD CONSTRAINT fk_referred_by
+    FOREIGN KEY (referred_by) REFERENCES plex_users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_plex_users_referred_by ON plex_users(referred_by);
+
+-- A referred user earns their referrer a single reward, for their first paid invoice
+CREATE TABLE IF NOT EXISTS referral_rewards (
+    id              SERIAL PRIMARY KEY,
+    referrer_id     INT NOT NULL,
+    referred_id     INT NULL UNIQUE,
+    invoice_id      TEXT NOT NULL,
+    reward_type     TEXT NOT NULL,
+    amount          BIGINT NOT NULL DEFAULT 0,
+    currency        TEXT NULL,
+    coupon_id       TEXT NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_referrer_id FOREIGN KEY (referrer_id) REFERENCES plex_users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_referred_id FOREIGN KEY (referred_id) REFERENCES plex_users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_referral_rewards_referrer_id ON referral_rewards(referrer_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_access_requests_status;
+DROP INDEX IF EXISTS idx_access_requests_pending_user_id;
+DROP TABLE IF EXISTS access_requests;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS access_requests (
+    id              SERIAL PRIMARY KEY,
+    user_id         INT NOT NULL,
+    message         TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    review_note     TEXT NULL,
+    reviewed_by     INT NULL,
+    reviewed_at     TIMESTAMP NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_access_request_user_id FOREIGN KEY (user_id) REFERENCES plex_users(id) ON DELETE CASCADE
+);
+
+-- A user has at most one request waiting for review
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_requests_pending_user_id
+    ON access_requests(user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_access_requests_status ON access_requests(status);
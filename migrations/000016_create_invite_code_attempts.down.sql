@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_invite_code_lockouts_locked_until;
+DROP INDEX IF EXISTS idx_invite_code_lockouts_subject;
+DROP TABLE IF EXISTS invite_code_lockouts;
+
+DROP INDEX IF EXISTS idx_invite_code_attempts_ip_address;
+DROP INDEX IF EXISTS idx_invite_code_attempts_user_id;
+DROP TABLE IF EXISTS invite_code_attempts;
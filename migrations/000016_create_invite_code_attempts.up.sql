@@ -0,0 +1,29 @@
+-- Failed attempts to claim an invite code
+CREATE TABLE IF NOT EXISTS invite_code_attempts (
+    id              SERIAL PRIMARY KEY,
+    user_id         INT NOT NULL,
+    ip_address      TEXT NOT NULL,
+    code            TEXT NOT NULL,
+    reason          TEXT NOT NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_invite_code_attempt_user_id FOREIGN KEY (user_id) REFERENCES plex_users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_code_attempts_user_id ON invite_code_attempts(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_invite_code_attempts_ip_address ON invite_code_attempts(ip_address, created_at);
+
+-- Users and IP addresses blocked from claiming invite codes after too many failed attempts
+CREATE TABLE IF NOT EXISTS invite_code_lockouts (
+    id              SERIAL PRIMARY KEY,
+    subject_type    TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    user_id         INT NULL,
+    failed_attempts INT NOT NULL,
+    locked_until    TIMESTAMP NOT NULL,
+    lifted_at       TIMESTAMP NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_invite_code_lockout_user_id FOREIGN KEY (user_id) REFERENCES plex_users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_code_lockouts_subject ON invite_code_lockouts(subject_type, subject, created_at);
+CREATE INDEX IF NOT EXISTS idx_invite_code_lockouts_locked_until ON invite_code_lockouts(locked_until);
@@ -0,0 +1 @@
+ALTER TABLE invite_codes DROP COLUMN allowed_users;
@@ -0,0 +1,3 @@
+-- JSON array of the Plex account IDs, emails and usernames allowed to claim
+-- the code, anyone when NULL
+ALTER TABLE invite_codes ADD COLUMN allowed_users TEXT NULL;
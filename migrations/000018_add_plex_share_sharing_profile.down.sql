@@ -0,0 +1 @@
+ALTER TABLE plex_shares DROP COLUMN sharing_profile;
@@ -0,0 +1,2 @@
+-- The sharing profile a share was made with, so it can be shared again alike
+ALTER TABLE plex_shares ADD COLUMN sharing_profile TEXT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE plex_shares DROP COLUMN sharing_settings;
+ALTER TABLE plex_shares DROP COLUMN libraries;
@@ -0,0 +1,4 @@
+-- The libraries and exact sharing settings a share was made with, as JSON, so
+-- it can be shared again without granting more than before
+ALTER TABLE plex_shares ADD COLUMN libraries TEXT NULL;
+ALTER TABLE plex_shares ADD COLUMN sharing_settings TEXT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE plex_users DROP COLUMN inactivity_warning_seen_at;
+ALTER TABLE plex_users DROP COLUMN inactivity_revoke_at;
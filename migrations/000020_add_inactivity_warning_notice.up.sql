@@ -0,0 +1,3 @@
+-- When a warned user's access is revoked, and when the warning was shown to them
+ALTER TABLE plex_users ADD COLUMN inactivity_revoke_at TIMESTAMP NULL;
+ALTER TABLE plex_users ADD COLUMN inactivity_warning_seen_at TIMESTAMP NULL;
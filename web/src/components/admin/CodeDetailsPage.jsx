@@ -267,7 +267,9 @@ function CodeDetailsPage({ codeId, onBack }) {
                   Duration
                 </p>
                 <p className="font-medium">
-                  {formatDate(codeDetails.duration) || "N/A"}
+                  {codeDetails.duration_days
+                    ? `${codeDetails.duration_days} days`
+                    : "Unlimited"}
                 </p>
               </div>
 
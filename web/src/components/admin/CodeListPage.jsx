@@ -77,6 +77,16 @@ function CodeListPage({ onViewCodeDetails }) {
     }
   };
 
+  const durationDays = {
+    "7days": 7,
+    "1month": 30,
+    "3months": 90,
+    "6months": 180,
+    "12months": 365,
+  };
+
+  const formatDuration = (days) => (days ? `${days} days` : "Unlimited");
+
   const handleCreateCode = async (e) => {
     e.preventDefault();
     setCreateError(null);
@@ -91,7 +101,7 @@ function CodeListPage({ onViewCodeDetails }) {
           : {}),
         ...(newCodeDurationRef.current &&
         newCodeDurationRef.current.value !== "never"
-          ? { duration: calculateDate(newCodeDurationRef.current.value) }
+          ? { duration_days: durationDays[newCodeDurationRef.current.value] }
           : {}),
         ...(newCodeExpirationRef.current &&
         newCodeExpirationRef.current.value !== "never"
@@ -130,8 +140,8 @@ function CodeListPage({ onViewCodeDetails }) {
 
   const confirmDeleteCode = async () => {
     try {
-      const response = await fetch(`/api/v1/codes/${codeToDelete}`, {
-        method: "DELETE",
+      const response = await fetch(`/api/v1/codes/${codeToDelete}/disable`, {
+        method: "POST",
       });
 
       if (!response.ok) {
@@ -495,7 +505,7 @@ function CodeListPage({ onViewCodeDetails }) {
                     </td>
                     <td className="px-6 py-4">{formatDate(code.created_at)}</td>
                     <td className="px-6 py-4">{formatDate(code.expires_at)}</td>
-                    <td className="px-6 py-4">{formatDate(code.duration)}</td>
+                    <td className="px-6 py-4">{formatDuration(code.duration_days)}</td>
                     <td className="px-6 py-4">
                       {code.entitlement_name || "N/A"}
                     </td>
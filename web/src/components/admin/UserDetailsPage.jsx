@@ -16,6 +16,9 @@ function UserDetailsPage({ userId, onBack }) {
   const [notesError, setNotesError] = useState(null);
   const [notesSuccess, setNotesSuccess] = useState(false);
   const [isNotesExpanded, setIsNotesExpanded] = useState(false);
+  const [isCreatingCode, setIsCreatingCode] = useState(false);
+  const [createdCode, setCreatedCode] = useState(null);
+  const [createCodeError, setCreateCodeError] = useState(null);
 
   useEffect(() => {
     if (userId) {
@@ -114,6 +117,34 @@ function UserDetailsPage({ userId, onBack }) {
     }
   };
 
+  const handleCreateCode = async () => {
+    setIsCreatingCode(true);
+    setCreateCodeError(null);
+    setCreatedCode(null);
+    try {
+      const response = await fetch(`/api/v1/plex/users/${userId}/codes`, {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({}),
+      });
+
+      if (!response.ok) {
+        const errorData = await response.json();
+        throw new Error(errorData.message || "Failed to create invite code");
+      }
+
+      const data = await response.json();
+      setCreatedCode(data.invite_code.code);
+    } catch (err) {
+      setCreateCodeError(err.message);
+      console.error("Error creating invite code:", err);
+    } finally {
+      setIsCreatingCode(false);
+    }
+  };
+
   const handleSaveNotes = async () => {
     setIsSavingNotes(true);
     setNotesError(null);
@@ -474,6 +505,20 @@ function UserDetailsPage({ userId, onBack }) {
                 )}
               </button>
             )}
+            <button
+              className="bg-blue-600 hover:bg-blue-700 text-white px-4 py-2 rounded-lg transition-colors flex items-center"
+              onClick={handleCreateCode}
+              disabled={isCreatingCode}
+            >
+              {isCreatingCode ? (
+                <>
+                  <div className="w-4 h-4 border-2 border-white border-t-transparent rounded-full animate-spin mr-2"></div>
+                  Creating Code...
+                </>
+              ) : (
+                "Create Invite Code for User"
+              )}
+            </button>
           </div>
 
           {grantError && (
@@ -481,6 +526,17 @@ function UserDetailsPage({ userId, onBack }) {
               {grantError}
             </div>
           )}
+          {createdCode && (
+            <div className="mt-4 p-3 bg-green-900/20 border border-green-900 text-green-300 rounded-lg">
+              Invite code <span className="font-mono font-semibold">{createdCode}</span>{" "}
+              can only be claimed by this user, once.
+            </div>
+          )}
+          {createCodeError && (
+            <div className="mt-4 p-3 bg-red-900/20 border border-red-900 text-red-400 rounded-lg">
+              {createCodeError}
+            </div>
+          )}
         </div>
       )}
 
@@ -16,6 +16,7 @@ export const AuthProvider = ({ children }) => {
     features: [],
   });
   const [user, setUser] = useState(null);
+  const [inactivityWarning, setInactivityWarning] = useState(null);
   const [isLoading, setIsLoading] = useState(true);
 
   useEffect(() => {
@@ -37,6 +38,7 @@ export const AuthProvider = ({ children }) => {
           const userData = await userResponse.json();
           if (userData.status === "success" && userData.user) {
             setUser(userData.user);
+            setInactivityWarning(userData.inactivity_warning ?? null);
           }
         }
       } catch (error) {
@@ -56,6 +58,7 @@ export const AuthProvider = ({ children }) => {
         const userData = await userResponse.json();
         if (userData.status === "success" && userData.user) {
           setUser(userData.user);
+          setInactivityWarning(userData.inactivity_warning ?? null);
           return userData.user;
         }
       }
@@ -70,6 +73,7 @@ export const AuthProvider = ({ children }) => {
     try {
       await fetch("/logout", { method: "POST" });
       setUser(null);
+      setInactivityWarning(null);
     } catch (error) {
       console.error("Error during logout:", error);
     }
@@ -79,12 +83,13 @@ export const AuthProvider = ({ children }) => {
     () => ({
       serverInfo,
       user,
+      inactivityWarning,
       isLoading,
       isAuthenticated: !!user,
       refreshUser,
       logout,
     }),
-    [serverInfo, user, isLoading]
+    [serverInfo, user, inactivityWarning, isLoading]
   );
 
   return <AuthContext.Provider value={value}>{children}</AuthContext.Provider>;
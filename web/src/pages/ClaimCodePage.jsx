@@ -71,7 +71,7 @@ function ClaimCodePage() {
         // Redirect to the onboarding wizard after animation completes
         setTimeout(() => navigate("/onboarding"), 3000);
       } else {
-        setMessage(data.error || "Failed to claim code");
+        setMessage(data.message || data.error || "Failed to claim code");
         setMessageType("error");
       }
     } catch (error) {
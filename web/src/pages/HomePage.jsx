@@ -4,7 +4,7 @@ import { useAuth } from "../context/AuthContext";
 import Footer from "../components/Footer";
 
 function HomePage() {
-  const { logout, user, serverInfo } = useAuth();
+  const { logout, user, serverInfo, inactivityWarning } = useAuth();
   const [isLoading, setIsLoading] = useState(true);
   const [hasPlexAccess, setHasPlexAccess] = useState(null);
   const [hasSubscriptions, setHasSubscriptions] = useState(false);
@@ -131,6 +131,17 @@ function HomePage() {
             : "You do not have access."}
         </p>
 
+        {hasPlexAccess && inactivityWarning && (
+          <div className="mb-6 bg-yellow-500/10 border border-yellow-500/40 text-yellow-300 rounded-lg p-4 text-sm">
+            You haven't watched anything in a while.
+            {inactivityWarning.revoke_at
+              ? ` Your access will be removed on ${new Date(
+                  inactivityWarning.revoke_at
+                ).toLocaleDateString()} unless you watch something before then.`
+              : " Watch something soon to keep your access."}
+          </div>
+        )}
+
         <div className="space-y-4 mb-6">
           {hasPlexAccess && (
             <>